@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// abortedModes are the accepted values of --aborted: keep the status-0
+// pair and list it, skip the entry, or replay it as a 504.
+var abortedModes = []string{"report", "skip", "504"}
+
+// abortedReason says why an entry never got a response: the network error
+// Chrome records in _error, or a status of 0 with nothing received. It
+// returns "" for entries that got one.
+func abortedReason(entry Entry) string {
+	res := entry.Response
+	if res.Status != 0 {
+		return ""
+	}
+	if res.Error != "" {
+		return res.Error
+	}
+	return "no response received"
+}
+
+// abortedResponse replaces the response of p, which HAR recorded as never
+// received, with a 504 Gateway Timeout. Hoverfly can't drop connections,
+// so a 504 naming the recorded error is the closest it gets to replaying
+// the failure.
+func abortedResponse(p *Pair, reason string) {
+	p.Response = Response{
+		Status:  504,
+		Body:    "Request failed during recording: " + reason + "\n",
+		Headers: Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+	}
+	p.Labels = append(p.Labels, "aborted")
+}
+
+// writeAbortedReport lists the entries that got no response and what was
+// done with them.
+func writeAbortedReport(aborted []string, mode string) {
+	if len(aborted) == 0 {
+		return
+	}
+	effect := map[string]string{
+		"report": "kept as status-0 pairs; use --aborted skip or 504",
+		"skip":   "skipped",
+		"504":    "replayed as 504 Gateway Timeout",
+	}[mode]
+	log.Printf("%d entr(ies) got no response during recording, %s:\n  %s", len(aborted), effect, strings.Join(aborted, "\n  "))
+}
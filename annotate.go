@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// annotator collects conversion problems and prints them as CI workflow
+// commands so they show up inline on pull requests. Only GitHub Actions
+// (--annotate=github) is supported.
+type annotator struct {
+	harFile    string
+	outputFile string
+	// lines holds the 1-based line each HAR entry starts on.
+	lines []int
+	notes []annotation
+}
+
+type annotation struct {
+	level   string
+	entry   int
+	line    int
+	message string
+}
+
+func newAnnotator(mode, harFile, outputFile string, data []byte) (*annotator, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "github":
+	default:
+		return nil, fmt.Errorf("unknown --annotate %q: expected github", mode)
+	}
+	return &annotator{harFile: harFile, outputFile: outputFile, lines: entryLines(data)}, nil
+}
+
+// entry records a problem with the HAR entry at index i. Calling it on a
+// nil annotator is a no-op so callers needn't check --annotate.
+func (a *annotator) entry(level string, i int, format string, args ...interface{}) {
+	if a == nil {
+		return
+	}
+	line := 0
+	if i < len(a.lines) {
+		line = a.lines[i]
+	}
+	a.notes = append(a.notes, annotation{level, i, line, fmt.Sprintf(format, args...)})
+}
+
+// parseError records a HAR that failed to parse, pointing at the offending
+// line when the error carries an offset.
+func (a *annotator) parseError(data []byte, err error) {
+	if a == nil {
+		return
+	}
+	line := 0
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntax) {
+		line = lineAt(data, syntax.Offset)
+	} else if errors.As(err, &typeErr) {
+		line = lineAt(data, typeErr.Offset)
+	}
+	a.notes = append(a.notes, annotation{"error", -1, line, "Failed to parse HAR: " + err.Error()})
+}
+
+func (a *annotator) write(w io.Writer) {
+	if a == nil {
+		return
+	}
+	for _, n := range a.notes {
+		props := []string{"file=" + escapeProperty(a.harFile)}
+		if n.line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", n.line))
+		}
+		title := "har-to-hoverfly"
+		if n.entry >= 0 {
+			title = fmt.Sprintf("HAR entry %d", n.entry)
+		}
+		if a.outputFile != "" {
+			title += " (" + a.outputFile + ")"
+		}
+		props = append(props, "title="+escapeProperty(title))
+		fmt.Fprintf(w, "::%s %s::%s\n", n.level, strings.Join(props, ","), escapeData(n.message))
+	}
+}
+
+// escapeData and escapeProperty apply the workflow command encoding GitHub
+// requires for messages and key=value properties respectively.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// entryLines walks the HAR with a streaming decoder and returns the line
+// each element of log.entries starts on. It returns nil if the document
+// doesn't have the expected shape.
+func entryLines(data []byte) []int {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if !enterObjectKey(dec, "log") || !enterObjectKey(dec, "entries") {
+		return nil
+	}
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil
+	}
+	var lines []int
+	for dec.More() {
+		off := dec.InputOffset()
+		for off < int64(len(data)) && strings.IndexByte(" \t\r\n,", data[off]) >= 0 {
+			off++
+		}
+		lines = append(lines, lineAt(data, off))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return lines
+		}
+	}
+	return lines
+}
+
+// enterObjectKey consumes an object's opening brace and its members up to
+// key, leaving the decoder positioned at key's value.
+func enterObjectKey(dec *json.Decoder, key string) bool {
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return false
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if t == key {
+			return true
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
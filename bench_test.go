@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The benchmarks time the conversion stages over a synthetic capture
+// representative of large browser recordings, or a real one:
+//
+//	go test -bench . -benchmem -bench-entries 50000
+//	go test -bench . -benchmem -bench-har capture.har
+//
+// Compare runs with benchstat to check performance refactors.
+var (
+	benchEntries   = flag.Int("bench-entries", 10000, "Number of entries in the synthetic HAR")
+	benchBodyBytes = flag.Int("bench-body-bytes", 4096, "Size of each synthetic response body")
+	benchHAR       = flag.String("bench-har", "", "Benchmark this HAR instead of a synthetic one")
+)
+
+var benchAllowedTypes = strings.Split("json,xml,text/html,text/javascript", ",")
+
+// benchFixture returns the HAR the benchmarks run over, parsed, and the
+// pairs it converts to.
+func benchFixture(b *testing.B) ([]byte, HAR, []Pair) {
+	b.Helper()
+	var data []byte
+	if *benchHAR != "" {
+		var err error
+		if data, err = os.ReadFile(*benchHAR); err != nil {
+			b.Fatal(err)
+		}
+	} else {
+		data = syntheticHAR(*benchEntries, *benchBodyBytes)
+	}
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		b.Fatal(err)
+	}
+	var pairs []Pair
+	for _, entry := range har.Log.Entries {
+		pairs = append(pairs, convertEntryToPair(entry, 0, benchAllowedTypes, "exact"))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	return data, har, pairs
+}
+
+func BenchmarkParse(b *testing.B) {
+	data, _, _ := benchFixture(b)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		var har HAR
+		if err := json.Unmarshal(data, &har); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConvert(b *testing.B) {
+	_, har, _ := benchFixture(b)
+	for i := 0; i < b.N; i++ {
+		for _, entry := range har.Log.Entries {
+			convertEntryToPair(entry, 0, benchAllowedTypes, "exact")
+		}
+	}
+}
+
+func BenchmarkDedupe(b *testing.B) {
+	_, _, pairs := benchFixture(b)
+	for i := 0; i < b.N; i++ {
+		pairIndex(pairs)
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	_, _, pairs := benchFixture(b)
+	sim := Simulation{}
+	sim.Meta.SchemaVersion = "v5.3"
+	sim.Data.Pairs = pairs
+	for i := 0; i < b.N; i++ {
+		if _, err := marshalSimulation(sim, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// syntheticHAR builds a capture representative of large browser recordings:
+// a mix of JSON API calls with query strings and request bodies, and static
+// assets, each with a body of roughly bodyBytes.
+func syntheticHAR(entries, bodyBytes int) []byte {
+	har := HAR{}
+	har.Log.Version = "1.2"
+	body := `{"items":[` + strings.Repeat(`{"id":1,"name":"item"},`, bodyBytes/24+1)
+	body = body[:len(body)-1] + "]}"
+	for i := 0; i < entries; i++ {
+		e := Entry{
+			StartedDateTime: "2024-01-01T00:00:00.000Z",
+			Time:            float64(i % 300),
+			Request: HarRequest{
+				Method: "GET",
+				URL:    fmt.Sprintf("https://api%d.example.com/v1/items/%d?page=%d&sort=name", i%5, i%500, i%10),
+				Headers: []HarHeader{
+					{Name: "Accept", Value: "application/json"},
+					{Name: "User-Agent", Value: "bench"},
+				},
+			},
+			Response: HarResponse{Status: 200},
+		}
+		e.Response.Content.MimeType = "application/json"
+		e.Response.Content.Text = body
+		switch i % 4 {
+		case 1:
+			e.Request.Method = "POST"
+			e.Request.PostData = &PostData{MimeType: "application/json", Text: `{"name":"item","n":` + fmt.Sprint(i) + `}`}
+		case 3:
+			e.Request.URL = fmt.Sprintf("https://cdn.example.com/static/%d.js", i%200)
+			e.Response.Content.MimeType = "text/javascript"
+			e.Response.Content.Text = strings.Repeat("x", bodyBytes)
+		}
+		har.Log.Entries = append(har.Log.Entries, e)
+	}
+	data, _ := json.Marshal(har)
+	return data
+}
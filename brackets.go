@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PHP, Rails and qs-style clients encode arrays and objects in the query
+// string with bracketed names: a[]=1&a[]=2, a[0]=1, filter[name]=x. Query
+// matchers are keyed by the unescaped name, so a%5B%5D and a[] are the same
+// key and every filter[...] member is matched on its own, in any order.
+// What stays order-sensitive is a list sent under one a[] name, whose
+// values Hoverfly joins with ";" in the order they arrive.
+
+// bracketParamModes are the accepted values of --bracket-params: keep
+// bracketed names as opaque keys, or treat a[] lists as sets.
+var bracketParamModes = []string{"opaque", "structured"}
+
+// maxUnorderedValues caps the list length matched regardless of order, as
+// the regex lists every permutation.
+const maxUnorderedValues = 5
+
+// structureBracketParams rewrites the exact matchers of p's a[]-style list
+// parameters into regexes accepting their values in any order, since
+// clients that build the query from a set needn't keep its order. It
+// returns the parameters rewritten, and those left exact because they
+// held more than maxUnorderedValues values.
+func structureBracketParams(p *Pair) (unordered, tooLong []string) {
+	for name, ms := range p.Request.Query {
+		if !strings.HasSuffix(name, "[]") || len(ms) != 1 || ms[0].Matcher != "exact" {
+			continue
+		}
+		values := strings.Split(ms[0].Value, ";")
+		if len(values) < 2 {
+			continue
+		}
+		if len(values) > maxUnorderedValues {
+			tooLong = append(tooLong, name)
+			continue
+		}
+		var alternatives []string
+		seen := map[string]bool{}
+		permute(values, func(order []string) {
+			quoted := make([]string, len(order))
+			for i, v := range order {
+				quoted[i] = regexp.QuoteMeta(v)
+			}
+			if alt := strings.Join(quoted, ";"); !seen[alt] {
+				seen[alt] = true
+				alternatives = append(alternatives, alt)
+			}
+		})
+		p.Request.Query[name] = []FieldMatcher{{Matcher: "regex", Value: "^(?:" + strings.Join(alternatives, "|") + ")$"}}
+		unordered = append(unordered, name)
+	}
+	return unordered, tooLong
+}
+
+// permute calls f with every ordering of values, in Heap's algorithm
+// order. f must not keep the slice.
+func permute(values []string, f func([]string)) {
+	order := append([]string{}, values...)
+	var generate func(n int)
+	generate = func(n int) {
+		if n <= 1 {
+			f(order)
+			return
+		}
+		for i := 0; i < n-1; i++ {
+			generate(n - 1)
+			if n%2 == 0 {
+				order[i], order[n-1] = order[n-1], order[i]
+			} else {
+				order[0], order[n-1] = order[n-1], order[0]
+			}
+		}
+		generate(n - 1)
+	}
+	generate(len(order))
+}
+
+// writeBracketReport logs the list parameters matched regardless of order
+// and those too long to be, with the number of pairs each was in.
+func writeBracketReport(unordered, tooLong map[string]int) {
+	counts := func(m map[string]int) string {
+		names := make([]string, 0, len(m))
+		for name, n := range m {
+			names = append(names, fmt.Sprintf("%s (%d)", name, n))
+		}
+		sort.Strings(names)
+		return strings.Join(names, ", ")
+	}
+	if len(unordered) > 0 {
+		log.Printf("Matched list query parameters in any order: %s", counts(unordered))
+	}
+	if len(tooLong) > 0 {
+		log.Printf("List query parameters with over %d values are still matched in recorded order: %s", maxUnorderedValues, counts(tooLong))
+	}
+}
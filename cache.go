@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// cacheKeyEnv names the environment variable holding the secret used to
+// encrypt cache entries. Cached simulations carry the same sensitive data
+// as the HAR they came from.
+const cacheKeyEnv = "HAR_TO_HOVERFLY_CACHE_KEY"
+
+// encryptedCacheMagic prefixes entries sealed with AES-256-GCM.
+var encryptedCacheMagic = []byte("h2h-aesgcm-v1\x00")
+
+// conversionCache stores rendered conversion output keyed by a hash of the
+// input HAR and every option that affects the result, so unchanged captures
+// in batch runs and pipelines aren't converted again.
+type conversionCache struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// newConversionCache opens the cache in dir, defaulting to a
+// har-to-hoverfly directory under the user cache directory. Entries are
+// encrypted when $HAR_TO_HOVERFLY_CACHE_KEY is set.
+func newConversionCache(dir string) (*conversionCache, error) {
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(base, "har-to-hoverfly")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	c := &conversionCache{dir: dir}
+	if secret := os.Getenv(cacheKeyEnv); secret != "" {
+		// Any secret is accepted; hashing it gives the 256-bit AES key.
+		key := sha256.Sum256([]byte(secret))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		if c.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// buildHash identifies the running binary. Builds outside a release all
+// report "dev" as their version, so the executable itself is hashed:
+// entries written by any other build, which may convert differently, are
+// then misses.
+func buildHash() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// conversionKey hashes the build, the HAR, any extra input files the
+// options reference, and every flag value except those naming where output
+// and the cache live. Only the base name of --input is hashed, since
+// --provenance labels pairs with it.
+func conversionKey(build string, data []byte, flags *flag.FlagSet, extraFiles ...string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "version=%s\nbuild=%s\n", version, build)
+	h.Write(data)
+	flags.VisitAll(func(f *flag.Flag) {
+		switch f.Name {
+		case "output", "no-cache", "cache-dir":
+			return
+		case "input":
+			fmt.Fprintf(h, "\n%s=%s", f.Name, filepath.Base(f.Value.String()))
+			return
+		}
+		fmt.Fprintf(h, "\n%s=%s", f.Name, f.Value.String())
+	})
+	for _, path := range extraFiles {
+		if path == "" {
+			continue
+		}
+		extra, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "\nfile=%s\n", path)
+		h.Write(extra)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// reportWatcher passes a conversion's stderr output through, noting
+// whether there was any. Runs that printed a warning or report aren't
+// cached, so a later identical run prints it again rather than hitting.
+type reportWatcher struct {
+	w       io.Writer
+	written bool
+}
+
+func (r *reportWatcher) Write(p []byte) (int, error) {
+	r.written = r.written || len(p) > 0
+	return r.w.Write(p)
+}
+
+func (c *conversionCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// get returns the entry for key. Entries that don't decrypt with the
+// current key, or plaintext entries when encryption is on (and the
+// reverse), are treated as misses and rewritten by the next put.
+func (c *conversionCache) get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	encrypted := bytes.HasPrefix(data, encryptedCacheMagic)
+	if c.aead == nil {
+		return data, !encrypted
+	}
+	if !encrypted {
+		return nil, false
+	}
+	sealed := data[len(encryptedCacheMagic):]
+	size := c.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, false
+	}
+	// The entry key is authenticated so entries can't be swapped.
+	plain, err := c.aead.Open(nil, sealed[:size], sealed[size:], []byte(key))
+	return plain, err == nil
+}
+
+// put stores output under key, writing to a temporary file first so a
+// concurrent reader never sees a partial entry.
+func (c *conversionCache) put(key string, output []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		sealed := append(append([]byte(nil), encryptedCacheMagic...), nonce...)
+		output = c.aead.Seal(sealed, nonce, output, []byte(key))
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(output); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
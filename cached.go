@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// HarCache is the HAR cache section: the cache entry before and after the
+// request, when the browser had one.
+type HarCache struct {
+	BeforeRequest json.RawMessage `json:"beforeRequest,omitempty"`
+	AfterRequest  json.RawMessage `json:"afterRequest,omitempty"`
+}
+
+func (c *HarCache) populated() bool {
+	if c == nil {
+		return false
+	}
+	for _, raw := range []json.RawMessage{c.BeforeRequest, c.AfterRequest} {
+		if v := strings.TrimSpace(string(raw)); v != "" && v != "null" && v != "{}" {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedReason says why an entry looks served from the browser cache rather
+// than the network, or returns "" for real exchanges. Chrome marks such
+// entries with _fromCache; other browsers leave status 0 without a network
+// _error, or fill in the cache section while recording no wire activity or
+// only a 304.
+func cachedReason(entry Entry) string {
+	if entry.FromCache != "" {
+		return entry.FromCache + " cache"
+	}
+	if entry.Response.Status == 0 && entry.Response.Error == "" {
+		return "status 0"
+	}
+	if !entry.Cache.populated() {
+		return ""
+	}
+	if entry.Response.Status == 304 {
+		return "cached 304"
+	}
+	if t := entry.Timings; t != nil && t.Wait <= 0 && t.Receive <= 0 {
+		return "cache hit"
+	}
+	return ""
+}
+
+// writeCachedReport logs how many cached entries were skipped and why.
+func writeCachedReport(skipped map[string]int) {
+	if len(skipped) == 0 {
+		return
+	}
+	total := 0
+	var reasons []string
+	for reason, n := range skipped {
+		total += n
+		reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+	}
+	sort.Strings(reasons)
+	log.Printf("Skipped %d entr(ies) served from the browser cache (%s)", total, strings.Join(reasons, ", "))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Initiator is Chrome's _initiator extension naming what triggered a
+// request.
+type Initiator struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+// requestParents reconstructs which entry triggered each entry, returning
+// the parent index or -1 for roots. Evidence is used in order of
+// reliability: Chrome's _initiator URL, the Referer header, and finally
+// the page the entry belongs to, whose first HTML entry is taken as the
+// navigation that started it. Parents must have started earlier.
+func requestParents(entries []Entry) []int {
+	parents := make([]int, len(entries))
+	lastByURL := map[string]int{}
+	pageRoots := map[string]int{}
+
+	starts := make([]time.Time, len(entries))
+	for i, e := range entries {
+		starts[i], _ = time.Parse(time.RFC3339Nano, e.StartedDateTime)
+	}
+	before := func(p, i int) bool {
+		return p != i && (starts[p].IsZero() || starts[i].IsZero() || !starts[p].After(starts[i]))
+	}
+
+	for i, e := range entries {
+		parents[i] = -1
+		candidates := []string{}
+		if e.Initiator != nil && e.Initiator.URL != "" {
+			candidates = append(candidates, e.Initiator.URL)
+		}
+		if referer := headerValue(e.Request.Headers, "Referer"); referer != "" {
+			candidates = append(candidates, referer)
+		}
+		for _, u := range candidates {
+			if p, ok := lastByURL[stripFragment(u)]; ok && before(p, i) {
+				parents[i] = p
+				break
+			}
+		}
+		if parents[i] == -1 && e.Pageref != "" {
+			if p, ok := pageRoots[e.Pageref]; ok && before(p, i) {
+				parents[i] = p
+			}
+		}
+
+		lastByURL[stripFragment(e.Request.URL)] = i
+		if _, ok := pageRoots[e.Pageref]; !ok && e.Pageref != "" && strings.Contains(e.Response.Content.MimeType, "html") {
+			pageRoots[e.Pageref] = i
+		}
+	}
+	return parents
+}
+
+// chainRoots maps every entry to the root of its chain.
+func chainRoots(parents []int) []int {
+	roots := make([]int, len(parents))
+	for i := range parents {
+		r := i
+		for depth := 0; parents[r] >= 0 && depth < len(parents); depth++ {
+			r = parents[r]
+		}
+		roots[i] = r
+	}
+	return roots
+}
+
+func chainName(root int) string {
+	return fmt.Sprintf("chain-%d", root)
+}
+
+// writeRequestTree prints the reconstructed chains as an indented tree.
+// included limits output to the entries that survived filtering; their
+// ancestors are still shown so the tree stays connected.
+func writeRequestTree(w io.Writer, entries []Entry, parents []int, included map[int]bool) {
+	children := map[int][]int{}
+	for i, p := range parents {
+		children[p] = append(children[p], i)
+	}
+	visible := map[int]bool{}
+	for i := range included {
+		for n, depth := i, 0; n >= 0 && !visible[n] && depth <= len(entries); n, depth = parents[n], depth+1 {
+			visible[n] = true
+		}
+	}
+
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if !visible[i] {
+			return
+		}
+		e := entries[i]
+		u := parseURL(e.Request.URL)
+		marker := ""
+		if !included[i] {
+			marker = " (filtered)"
+		}
+		fmt.Fprintf(w, "%s%-7s %d %s%s%s\n", strings.Repeat("  ", depth), e.Request.Method, e.Response.Status, u.Host, truncate(u.Path, 80), marker)
+		for _, c := range children[i] {
+			walk(c, depth+1)
+		}
+	}
+	for _, root := range children[-1] {
+		walk(root, 0)
+	}
+}
+
+func headerValue(headers []HarHeader, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func stripFragment(u string) string {
+	if i := strings.IndexByte(u, '#'); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Hoverfly serves a plain body as its UTF-8 bytes, so a recorded
+// Content-Type declaring ISO-8859-1, Shift_JIS and the like makes clients
+// decode those bytes in the wrong charset. Bodies are therefore transcoded
+// to UTF-8 and their charset rewritten to match. Charset names are looked
+// up as browsers do, so ISO-8859-1 is read as windows-1252.
+
+// transcodeResponseBody converts a body declared in a charset other than
+// UTF-8 to UTF-8 text and rewrites the charset of its mimeType and
+// Content-Type header. It returns the charset converted from, or "" when
+// the body is UTF-8 already; on error the body is left as recorded.
+func transcodeResponseBody(res *HarResponse) (string, error) {
+	charset := responseCharset(*res)
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return "", nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return charset, fmt.Errorf("unknown charset %s", charset)
+	}
+	name, _ := htmlindex.Name(enc)
+
+	var raw []byte
+	switch {
+	case res.Content.Encoding == "base64":
+		if raw, err = base64.StdEncoding.DecodeString(res.Content.Text); err != nil {
+			return charset, fmt.Errorf("invalid base64 body: %v", err)
+		}
+	case storedAsBytes(res.Content.Text, name):
+		raw = make([]byte, 0, len(res.Content.Text))
+		for _, r := range res.Content.Text {
+			raw = append(raw, byte(r))
+		}
+	}
+	if raw != nil {
+		out, err := enc.NewDecoder().Bytes(raw)
+		if err != nil {
+			return charset, err
+		}
+		if !utf8.Valid(out) {
+			return charset, fmt.Errorf("body isn't valid %s", charset)
+		}
+		if looksBinary(string(out)) {
+			// Binary labelled as text, which the sniffing after this
+			// serves as encodedBody.
+			return "", nil
+		}
+		res.Content.Text, res.Content.Encoding = string(out), ""
+	}
+	// Other text was decoded by the browser when recording and only the
+	// declared charset is wrong.
+
+	res.Content.MimeType = withUTF8Charset(res.Content.MimeType)
+	headers := make([]HarHeader, 0, len(res.Headers))
+	for _, h := range res.Headers {
+		switch {
+		case strings.EqualFold(h.Name, "Content-Type"):
+			h.Value = withUTF8Charset(h.Value)
+		case strings.EqualFold(h.Name, "Content-Length"):
+			continue
+		}
+		headers = append(headers, h)
+	}
+	res.Headers = headers
+	return name, nil
+}
+
+// storedAsBytes reports whether text holds the body's bytes one per
+// character, as some proxies record it, rather than text a browser decoded.
+// Only then are all characters below 0x100; beyond that, C1 controls are
+// never decoded text, and for multibyte charsets the bytes must decode.
+func storedAsBytes(text, charset string) bool {
+	high, c1 := false, false
+	for _, r := range text {
+		if r > 0xff {
+			return false
+		}
+		high = high || r >= 0x80
+		c1 = c1 || r >= 0x80 && r < 0xa0
+	}
+	if !high {
+		return false
+	}
+	switch charset {
+	case "shift_jis", "euc-jp", "iso-2022-jp", "euc-kr", "gbk", "gb18030", "big5", "utf-16le", "utf-16be":
+		return true
+	}
+	return c1
+}
+
+// withUTF8Charset sets the charset parameter of a media type to utf-8.
+func withUTF8Charset(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] == "" {
+		return contentType
+	}
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// writeCharsetReport logs how many bodies were transcoded per charset and
+// those that couldn't be.
+func writeCharsetReport(transcoded map[string]int, failed []string) {
+	if len(transcoded) > 0 {
+		charsets := make([]string, 0, len(transcoded))
+		total := 0
+		for c, n := range transcoded {
+			charsets = append(charsets, fmt.Sprintf("%s %d", c, n))
+			total += n
+		}
+		sort.Strings(charsets)
+		log.Printf("Transcoded %d response body(ies) to UTF-8 (%s)", total, strings.Join(charsets, ", "))
+	}
+	if len(failed) > 0 {
+		log.Printf("%d response body(ies) couldn't be transcoded to UTF-8 and keep their charset:\n  %s",
+			len(failed), strings.Join(failed, "\n  "))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Entry classes used by --only and the summarise CLASS column.
+const (
+	classAPI      = "api"
+	classAsset    = "asset"
+	classTracking = "tracking"
+)
+
+type entryClass struct {
+	kind       string
+	confidence float64
+}
+
+func (c entryClass) String() string {
+	return fmt.Sprintf("%s (%.2f)", c.kind, c.confidence)
+}
+
+var (
+	assetExtensions = map[string]bool{
+		".js": true, ".mjs": true, ".css": true, ".map": true, ".png": true, ".jpg": true, ".jpeg": true,
+		".gif": true, ".svg": true, ".webp": true, ".avif": true, ".ico": true, ".woff": true, ".woff2": true,
+		".ttf": true, ".otf": true, ".eot": true, ".mp4": true, ".webm": true, ".mp3": true, ".html": true, ".htm": true,
+	}
+	apiPathPattern   = regexp.MustCompile(`(?i)(^|/)(api|rest|graphql|gql|rpc|v[0-9]+)(/|$)`)
+	trackingHosts    = []string{"google-analytics.com", "googletagmanager.com", "doubleclick.net", "segment.io", "segment.com", "mixpanel.com", "hotjar.com", "amplitude.com", "newrelic.com", "nr-data.net", "sentry.io", "fullstory.com", "clarity.ms", "facebook.net", "bat.bing.com"}
+	trackingPathWord = regexp.MustCompile(`(?i)(^|/)(collect|track|tracking|pixel|beacon|analytics|telemetry|events?|log|rum|g/collect|tr)(/|$|\.gif)`)
+)
+
+// classifyEntry scores an entry as an API call, a static asset or a
+// tracking beacon from its content type, URL shape and payload, and returns
+// the best class with its share of the total score as a confidence.
+func classifyEntry(entry Entry, u *url.URL) entryClass {
+	scores := map[string]float64{classAPI: 0, classAsset: 0, classTracking: 0}
+	mime := strings.ToLower(entry.Response.Content.MimeType)
+	host := strings.ToLower(u.Hostname())
+
+	switch {
+	case strings.Contains(mime, "json"), strings.Contains(mime, "grpc"), strings.Contains(mime, "protobuf"):
+		scores[classAPI] += 3
+	case strings.Contains(mime, "xml") && !strings.Contains(mime, "svg"):
+		scores[classAPI] += 2
+	case strings.HasPrefix(mime, "image/"), strings.HasPrefix(mime, "font/"), strings.Contains(mime, "css"),
+		strings.Contains(mime, "javascript"), strings.HasPrefix(mime, "video/"), strings.HasPrefix(mime, "audio/"):
+		scores[classAsset] += 3
+	case strings.Contains(mime, "html"):
+		scores[classAsset] += 1.5
+	}
+
+	if assetExtensions[strings.ToLower(path.Ext(u.Path))] {
+		scores[classAsset] += 2
+	}
+	if apiPathPattern.MatchString(u.Path) {
+		scores[classAPI] += 2
+	}
+	if entry.Request.Method != "GET" && entry.Request.Method != "HEAD" {
+		scores[classAPI] += 1
+	}
+	if entry.Request.PostData != nil && json.Valid([]byte(entry.Request.PostData.Text)) {
+		scores[classAPI] += 1
+	}
+	if body := strings.TrimSpace(entry.Response.Content.Text); body != "" && (body[0] == '{' || body[0] == '[') && json.Valid([]byte(body)) {
+		scores[classAPI] += 1
+	}
+
+	for _, t := range trackingHosts {
+		if host == t || strings.HasSuffix(host, "."+t) {
+			scores[classTracking] += 4
+		}
+	}
+	if trackingPathWord.MatchString(u.Path) {
+		scores[classTracking] += 2
+	}
+	if entry.Response.Status == 204 || (strings.HasPrefix(mime, "image/gif") && len(entry.Response.Content.Text) < 100) {
+		scores[classTracking] += 1
+	}
+
+	best, total := classAPI, 0.0
+	for _, kind := range []string{classAPI, classAsset, classTracking} {
+		total += scores[kind]
+		if scores[kind] > scores[best] {
+			best = kind
+		}
+	}
+	if total == 0 {
+		// Nothing to go on: unknown payloads are most often API calls.
+		return entryClass{kind: classAPI, confidence: 0}
+	}
+	return entryClass{kind: best, confidence: scores[best] / total}
+}
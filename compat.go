@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// HAR 1.2 only added optional fields (comments, content.encoding,
+// timings.ssl, serverIPAddress, connection) to 1.1, so both parse the same
+// way. What differs in practice is what exporters fill in: 1.1-era tools
+// and hand-rolled ones often leave out fields the conversion relies on,
+// which the shims below default from the rest of the entry.
+
+// harVersions are the log.version values the converter knows.
+var harVersions = []string{"1.1", "1.2"}
+
+// harCompat records the detected HAR version and the fields shimEntry had
+// to default, counted per field.
+type harCompat struct {
+	version   string
+	creator   string
+	defaulted map[string]int
+}
+
+// applyHARShims defaults missing fields in every entry of har.
+func applyHARShims(har *HAR) harCompat {
+	c := harCompat{version: har.Log.Version, defaulted: map[string]int{}}
+	if cr := har.Log.Creator; cr != nil {
+		c.creator = strings.TrimSpace(cr.Name + " " + cr.Version)
+	}
+	for i := range har.Log.Entries {
+		for _, field := range shimEntry(&har.Log.Entries[i]) {
+			c.defaulted[field]++
+		}
+	}
+	return c
+}
+
+// shimEntry defaults the fields of e that exporters commonly omit and
+// returns a description of each one it filled in.
+func shimEntry(e *Entry) []string {
+	var defaulted []string
+	req, res := &e.Request, &e.Response
+
+	defaulted = append(defaulted, shimPseudoHeaders(req, res)...)
+
+	// HTTP methods are case-sensitive and Hoverfly matches them exactly,
+	// but some exporters write them in lower case.
+	if upper := strings.ToUpper(req.Method); upper != req.Method {
+		req.Method = upper
+		defaulted = append(defaulted, "request.method upper-cased")
+	}
+	if req.PostData != nil && req.PostData.MimeType == "" {
+		if v := headerValue(req.Headers, "Content-Type"); v != "" {
+			req.PostData.MimeType = v
+			defaulted = append(defaulted, "request.postData.mimeType from Content-Type")
+		}
+	}
+	if res.Content.MimeType == "" {
+		if v := headerValue(res.Headers, "Content-Type"); v != "" {
+			res.Content.MimeType = v
+			defaulted = append(defaulted, "response.content.mimeType from Content-Type")
+		}
+	}
+	// The entry time is the sum of its timings, -1 marking those that
+	// don't apply; ssl is already included in connect.
+	if e.Time == 0 && e.Timings != nil {
+		total := 0.0
+		for _, t := range []float64{e.Timings.Blocked, e.Timings.DNS, e.Timings.Connect, e.Timings.Send, e.Timings.Wait, e.Timings.Receive} {
+			if t > 0 {
+				total += t
+			}
+		}
+		if total > 0 {
+			e.Time = total
+			defaulted = append(defaulted, "time from timings")
+		}
+	}
+	return defaulted
+}
+
+// shimPseudoHeaders normalises entries captured over HTTP/2 or HTTP/3.
+// Some exporters record the :method, :scheme, :authority and :path
+// pseudo-headers alongside a relative or empty URL, and write httpVersion
+// as h2 or h3. The URL and method are derived from the pseudo-headers,
+// which are then dropped: they aren't headers an HTTP/1.1 client sends,
+// so matching them would never succeed.
+func shimPseudoHeaders(req *HarRequest, res *HarResponse) []string {
+	var defaulted []string
+	pseudo := map[string]string{}
+	headers := req.Headers[:0:0]
+	for _, h := range req.Headers {
+		if strings.HasPrefix(h.Name, ":") {
+			pseudo[strings.ToLower(h.Name)] = h.Value
+			continue
+		}
+		headers = append(headers, h)
+	}
+	if len(pseudo) > 0 {
+		req.Headers = headers
+		defaulted = append(defaulted, "request pseudo-headers dropped")
+	}
+	if url := strings.TrimSpace(req.URL); (url == "" || isRelativeURL(url)) && pseudo[":authority"] != "" {
+		scheme := pseudo[":scheme"]
+		if scheme == "" {
+			// Browsers only speak HTTP/2 and HTTP/3 over TLS.
+			scheme = "https"
+		}
+		if url == "" || strings.HasPrefix(url, "?") {
+			url = pseudo[":path"]
+		}
+		if url == "" {
+			url = "/"
+		}
+		req.URL = scheme + "://" + pseudo[":authority"] + url
+		defaulted = append(defaulted, "request.url from :authority")
+	}
+	if req.Method == "" && pseudo[":method"] != "" {
+		req.Method = pseudo[":method"]
+		defaulted = append(defaulted, "request.method from :method")
+	}
+	resHeaders := res.Headers[:0:0]
+	for _, h := range res.Headers {
+		if !strings.HasPrefix(h.Name, ":") {
+			resHeaders = append(resHeaders, h)
+		}
+	}
+	if len(resHeaders) < len(res.Headers) {
+		res.Headers = resHeaders
+		defaulted = append(defaulted, "response pseudo-headers dropped")
+	}
+	for _, version := range []*string{&req.HTTPVersion, &res.HTTPVersion} {
+		if v := normaliseHTTPVersion(*version); v != *version {
+			defaulted = append(defaulted, fmt.Sprintf("httpVersion %s normalised to %s", *version, v))
+			*version = v
+		}
+	}
+	return defaulted
+}
+
+// normaliseHTTPVersion spells the HTTP/2 and HTTP/3 versions recorders
+// write as h2, h3, h3-29 or http/2.0 the way HAR does for HTTP/1.1.
+func normaliseHTTPVersion(version string) string {
+	if !isMultiplexedHTTP(version) {
+		return version
+	}
+	v := strings.ToLower(version)
+	if strings.HasPrefix(v, "h3") || strings.HasPrefix(v, "http/3") {
+		return "HTTP/3"
+	}
+	return "HTTP/2"
+}
+
+// write logs the HAR version when it isn't plain 1.2 or fields had to be
+// defaulted, followed by the defaulted fields.
+func (c harCompat) write() {
+	version := "HAR " + c.version
+	switch {
+	case c.version == "":
+		version = "HAR without log.version (read as 1.2)"
+	case !containsString(harVersions, c.version):
+		version = fmt.Sprintf("HAR version %q unknown (read as 1.2)", c.version)
+	case c.version == "1.2" && len(c.defaulted) == 0:
+		return
+	}
+	if c.creator != "" {
+		version += " from " + c.creator
+	}
+	if len(c.defaulted) == 0 {
+		log.Print(version)
+		return
+	}
+	fields := make([]string, 0, len(c.defaulted))
+	for field, n := range c.defaulted {
+		fields = append(fields, fmt.Sprintf("%s (%d)", field, n))
+	}
+	sort.Strings(fields)
+	log.Printf("%s; fields defaulted or normalised:\n  %s", version, strings.Join(fields, "\n  "))
+}
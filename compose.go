@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// scenario declares a simulation assembled from fragments, typically one
+// converted file per user journey. Steps are laid out in order; with a
+// sequence name they are wired together with Hoverfly state so each step's
+// pairs only match once the previous step's advancing request was made.
+// Shared fragments match in every step.
+type scenario struct {
+	Sequence  string             `json:"sequence,omitempty"`
+	Fragments map[string]string  `json:"fragments"`
+	Shared    []string           `json:"shared,omitempty"`
+	Steps     []scenarioStep     `json:"steps"`
+	Overrides []scenarioOverride `json:"overrides,omitempty"`
+}
+
+// scenarioStep places a fragment. AdvanceOn selects the pair whose response
+// moves the scenario to the next step, by default the fragment's last pair.
+type scenarioStep struct {
+	Fragment  string     `json:"fragment"`
+	AdvanceOn *pairMatch `json:"advanceOn,omitempty"`
+}
+
+// pairMatch selects pairs the way the edit commands' flags do.
+type pairMatch struct {
+	Host   string `json:"host,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Method string `json:"method,omitempty"`
+	Label  string `json:"label,omitempty"`
+}
+
+func (m pairMatch) selector() *pairSelector {
+	return &pairSelector{host: m.Host, path: m.Path, method: m.Method, label: m.Label}
+}
+
+// scenarioOverride changes the responses of the composed pairs it selects,
+// optionally only those from one fragment.
+type scenarioOverride struct {
+	pairMatch
+	Fragment string              `json:"fragment,omitempty"`
+	Status   int                 `json:"status,omitempty"`
+	Headers  map[string][]string `json:"headers,omitempty"`
+	Body     *string             `json:"body,omitempty"`
+	Delay    *int                `json:"delay,omitempty"`
+	Labels   []string            `json:"labels,omitempty"`
+}
+
+// fragmentLabel marks composed pairs with the fragment they came from.
+const fragmentLabel = "fragment:"
+
+func runCompose(args []string) {
+	flags := flag.NewFlagSet("compose", flag.ExitOnError)
+	scenarioFile := flags.String("scenario", "", "Path to the JSON or YAML scenario declaring fragments, steps and overrides")
+	outputFile := flags.String("output", "", "Path to write the composed simulation (optional, defaults to stdout)")
+	flags.Parse(args)
+
+	if *scenarioFile == "" {
+		log.Fatal("compose needs --scenario")
+	}
+	sc, err := readScenario(*scenarioFile)
+	if err != nil {
+		log.Fatalf("Failed to read scenario: %v", err)
+	}
+
+	// Fragment paths are relative to the scenario file.
+	dir := filepath.Dir(*scenarioFile)
+	fragments := map[string]Simulation{}
+	for name, path := range sc.Fragments {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if fragments[name], err = readSimulation(path); err != nil {
+			log.Fatalf("Failed to parse fragment %s: %v", name, err)
+		}
+	}
+
+	sim, err := composeScenario(sc, fragments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output, err := marshalSimulation(sim, isYAMLPath(*outputFile))
+	if err != nil {
+		log.Fatalf("Failed to serialize simulation: %v", err)
+	}
+	if err := writeOutput(*outputFile, output); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+	log.Printf("compose: %d pair(s) from %d step(s) and %d shared fragment(s)", len(sim.Data.Pairs), len(sc.Steps), len(sc.Shared))
+}
+
+func readScenario(path string) (scenario, error) {
+	var sc scenario
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sc, err
+	}
+	if isYAMLPath(path) {
+		if data, err = yamlToJSON(data); err != nil {
+			return sc, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return sc, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(sc.Steps) == 0 {
+		return sc, fmt.Errorf("%s: no steps", path)
+	}
+	known := func(name string) error {
+		if _, ok := sc.Fragments[name]; !ok {
+			return fmt.Errorf("%s: unknown fragment %q", path, name)
+		}
+		return nil
+	}
+	for i, step := range sc.Steps {
+		if err := known(step.Fragment); err != nil {
+			return sc, err
+		}
+		if step.AdvanceOn != nil && sc.Sequence == "" {
+			return sc, fmt.Errorf("%s: step %d: advanceOn needs a sequence", path, i+1)
+		}
+	}
+	for _, name := range sc.Shared {
+		if err := known(name); err != nil {
+			return sc, err
+		}
+	}
+	for _, o := range sc.Overrides {
+		if o.Fragment != "" {
+			if err := known(o.Fragment); err != nil {
+				return sc, err
+			}
+		}
+	}
+	return sc, nil
+}
+
+// composeScenario lays out the steps' pairs in order, then the shared
+// fragments', wiring step state and applying the overrides. Hoverfly serves
+// the first matching pair, so earlier steps win among unwired duplicates.
+func composeScenario(sc scenario, fragments map[string]Simulation) (Simulation, error) {
+	var sim Simulation
+	sim.Meta.SchemaVersion = "v5.3"
+	sim.Data.Pairs = []Pair{}
+	sim.Data.GlobalActions.Delays = []GlobalDelay{}
+	if v := fragments[sc.Steps[0].Fragment].Meta.SchemaVersion; v != "" {
+		sim.Meta.SchemaVersion = v
+	}
+
+	stateKey := "sequence:" + sc.Sequence
+	used := map[string]bool{}
+	add := func(name string, wire func(pairs []Pair) error) error {
+		pairs := make([]Pair, 0, len(fragments[name].Data.Pairs))
+		for _, p := range fragments[name].Data.Pairs {
+			p = copyPair(p)
+			// Steps may reuse a fragment, so state is wired on copies.
+			p.Request.RequiresState = copyState(p.Request.RequiresState)
+			p.Response.TransitionsState = copyState(p.Response.TransitionsState)
+			if !hasLabel(p, fragmentLabel+name) {
+				p.Labels = append(p.Labels, fragmentLabel+name)
+			}
+			pairs = append(pairs, p)
+		}
+		if wire != nil {
+			if err := wire(pairs); err != nil {
+				return err
+			}
+		}
+		sim.Data.Pairs = append(sim.Data.Pairs, pairs...)
+		if !used[name] {
+			used[name] = true
+			sim.Data.GlobalActions.Delays = append(sim.Data.GlobalActions.Delays, fragments[name].Data.GlobalActions.Delays...)
+			sim.Data.GlobalActions.DelaysLogNormal = append(sim.Data.GlobalActions.DelaysLogNormal, fragments[name].Data.GlobalActions.DelaysLogNormal...)
+		}
+		return nil
+	}
+
+	for i, step := range sc.Steps {
+		var wire func([]Pair) error
+		if sc.Sequence != "" {
+			// Hoverfly initialises "sequence:" keys to "1" on load.
+			current, next := strconv.Itoa(i+1), strconv.Itoa(i+2)
+			last := i == len(sc.Steps)-1
+			wire = func(pairs []Pair) error {
+				advance := -1
+				for j := range pairs {
+					if pairs[j].Request.RequiresState == nil {
+						pairs[j].Request.RequiresState = map[string]string{}
+					}
+					pairs[j].Request.RequiresState[stateKey] = current
+					if step.AdvanceOn == nil {
+						advance = j
+					} else if advance < 0 && step.AdvanceOn.selector().matches(pairs[j]) {
+						advance = j
+					}
+				}
+				if last {
+					return nil
+				}
+				if advance < 0 {
+					return fmt.Errorf("step %d (%s): no pair to advance the scenario on", i+1, step.Fragment)
+				}
+				p := &pairs[advance]
+				if p.Response.TransitionsState == nil {
+					p.Response.TransitionsState = map[string]string{}
+				}
+				p.Response.TransitionsState[stateKey] = next
+				return nil
+			}
+		}
+		if err := add(step.Fragment, wire); err != nil {
+			return sim, err
+		}
+	}
+	for _, name := range sc.Shared {
+		if err := add(name, nil); err != nil {
+			return sim, err
+		}
+	}
+
+	for _, o := range sc.Overrides {
+		matched := 0
+		for i := range sim.Data.Pairs {
+			p := &sim.Data.Pairs[i]
+			if o.Fragment != "" && !hasLabel(*p, fragmentLabel+o.Fragment) || !o.selector().matches(*p) {
+				continue
+			}
+			matched++
+			o.apply(p)
+		}
+		if matched == 0 {
+			log.Printf("Override %+v matched no pairs", o.pairMatch)
+		}
+	}
+	return sim, nil
+}
+
+func (o scenarioOverride) apply(p *Pair) {
+	if o.Status != 0 {
+		p.Response.Status = o.Status
+	}
+	if len(o.Headers) > 0 && p.Response.Headers == nil {
+		p.Response.Headers = Header{}
+	}
+	for name, values := range o.Headers {
+		p.Response.Headers[name] = values
+	}
+	if o.Body != nil {
+		p.Response.Body, p.Response.EncodedBody = *o.Body, false
+	}
+	if o.Delay != nil {
+		p.Response.FixedDelay = *o.Delay
+	}
+	for _, l := range o.Labels {
+		if !hasLabel(*p, l) {
+			p.Labels = append(p.Labels, l)
+		}
+	}
+}
+
+func copyState(state map[string]string) map[string]string {
+	if state == nil {
+		return nil
+	}
+	c := make(map[string]string, len(state))
+	for k, v := range state {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,28 @@
+package main
+
+// connectionLabelsFor describes where an entry was served from: the server
+// IP, the recorder's connection ID (and whether an earlier entry already
+// used it), and the TLS protocol and cipher when the recorder captured
+// them. seen tracks connection IDs across entries.
+func connectionLabelsFor(entry Entry, seen map[string]bool) []string {
+	var labels []string
+	if entry.ServerIPAddress != "" {
+		labels = append(labels, "server-ip:"+entry.ServerIPAddress)
+	}
+	if entry.Connection != "" {
+		labels = append(labels, "connection:"+entry.Connection)
+		if seen[entry.Connection] {
+			labels = append(labels, "connection-reused")
+		}
+		seen[entry.Connection] = true
+	}
+	if sd := entry.SecurityDetails; sd != nil {
+		if sd.Protocol != "" {
+			labels = append(labels, "tls:"+sd.Protocol)
+		}
+		if sd.Cipher != "" {
+			labels = append(labels, "tls-cipher:"+sd.Cipher)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cookieMatchModes are the accepted values of --cookie-matchers: the Cookie
+// header matched exactly as recorded, each cookie matched on its own
+// whatever the order and other cookies, or no cookie matching.
+var cookieMatchModes = []string{"header", "each", "none"}
+
+// defaultSessionCookies are the names, as case-insensitive globs, of
+// cookies that identify a login session and change with every capture.
+const defaultSessionCookies = "JSESSIONID,PHPSESSID,ASP.NET_SessionId,ASPSESSIONID*,connect.sid,sessionid,session,_session_id,*_session,sid"
+
+// cookiePolicy is how request and response cookies are converted.
+type cookiePolicy struct {
+	matchers      string
+	setCookies    bool
+	stripSessions bool
+	sessionNames  []string
+}
+
+func (c cookiePolicy) isSession(name string) bool {
+	for _, pattern := range c.sessionNames {
+		if globMatch(strings.ToLower(pattern), strings.ToLower(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestCookies returns the cookies the request sent: the ones HAR
+// records, or those in its Cookie headers when the recorder left them out.
+// HTTP/2 recorders may split cookies over several Cookie headers.
+func requestCookies(req HarRequest) []HarCookie {
+	if len(req.Cookies) > 0 {
+		return req.Cookies
+	}
+	var cookies []HarCookie
+	for _, h := range req.Headers {
+		if !strings.EqualFold(h.Name, "Cookie") {
+			continue
+		}
+		for _, part := range strings.Split(h.Value, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				cookies = append(cookies, HarCookie{Name: name, Value: value})
+			}
+		}
+	}
+	return cookies
+}
+
+// applyRequest rewrites the Cookie header matcher of p according to the
+// policy and returns the session cookies it stopped matching. When session
+// cookies are stripped from an exact Cookie header, the remaining cookies
+// are matched one by one instead.
+func (c cookiePolicy) applyRequest(p *Pair, req HarRequest) []string {
+	var kept []HarCookie
+	var stripped []string
+	for _, cookie := range requestCookies(req) {
+		if c.stripSessions && c.isSession(cookie.Name) {
+			stripped = append(stripped, cookie.Name)
+			continue
+		}
+		kept = append(kept, cookie)
+	}
+	if c.matchers == "header" && len(stripped) == 0 {
+		return nil
+	}
+
+	for name := range p.Request.Headers {
+		if strings.EqualFold(name, "Cookie") {
+			delete(p.Request.Headers, name)
+		}
+	}
+	if c.matchers == "none" || len(kept) == 0 {
+		return stripped
+	}
+	// Hoverfly joins repeated headers with ";", which the regex allows for.
+	var matchers []FieldMatcher
+	for _, cookie := range kept {
+		matchers = append(matchers, FieldMatcher{
+			Matcher: "regex",
+			Value:   `(^|;\s*)` + regexp.QuoteMeta(cookie.Name+"="+cookie.Value) + `(;|$)`,
+		})
+	}
+	if p.Request.Headers == nil {
+		p.Request.Headers = map[string][]FieldMatcher{}
+	}
+	p.Request.Headers["Cookie"] = matchers
+	return stripped
+}
+
+// applyResponse rebuilds the Set-Cookie headers of p from the cookies HAR
+// recorded for the response, with --set-cookies, and drops session cookies
+// from them when those are stripped. It returns the session cookies dropped.
+func (c cookiePolicy) applyResponse(p *Pair, res HarResponse) []string {
+	if c.setCookies && len(res.Cookies) > 0 {
+		var values []string
+		for _, cookie := range res.Cookies {
+			values = append(values, setCookieValue(cookie))
+		}
+		p.Response.Headers["Set-Cookie"] = values
+	}
+	if !c.stripSessions {
+		return nil
+	}
+	var kept, stripped []string
+	for _, v := range p.Response.Headers["Set-Cookie"] {
+		name, _, _ := strings.Cut(v, "=")
+		if name = strings.TrimSpace(name); c.isSession(name) {
+			stripped = append(stripped, name)
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if len(kept) > 0 {
+		p.Response.Headers["Set-Cookie"] = kept
+	} else {
+		delete(p.Response.Headers, "Set-Cookie")
+	}
+	return stripped
+}
+
+// setCookieValue formats a HAR cookie as a Set-Cookie header value. HAR
+// records expiry as an ISO 8601 timestamp; values that don't parse are
+// left out rather than sent malformed.
+func setCookieValue(cookie HarCookie) string {
+	attrs := []string{cookie.Name + "=" + cookie.Value}
+	if cookie.Path != "" {
+		attrs = append(attrs, "Path="+cookie.Path)
+	}
+	if cookie.Domain != "" {
+		attrs = append(attrs, "Domain="+cookie.Domain)
+	}
+	if cookie.Expires != "" {
+		if t, err := time.Parse(time.RFC3339, cookie.Expires); err == nil {
+			attrs = append(attrs, "Expires="+t.UTC().Format(http.TimeFormat))
+		}
+	}
+	if cookie.HTTPOnly {
+		attrs = append(attrs, "HttpOnly")
+	}
+	if cookie.Secure {
+		attrs = append(attrs, "Secure")
+	}
+	if cookie.SameSite != "" {
+		attrs = append(attrs, "SameSite="+cookie.SameSite)
+	}
+	return strings.Join(attrs, "; ")
+}
+
+// writeCookieReport logs which session cookies were stripped from how many
+// pairs.
+func writeCookieReport(stripped map[string]int, pairs int) {
+	if pairs == 0 {
+		return
+	}
+	names := make([]string, 0, len(stripped))
+	for name := range stripped {
+		names = append(names, fmt.Sprintf("%s (%d)", name, stripped[name]))
+	}
+	sort.Strings(names)
+	log.Printf("Stripped session cookies from %d pair(s): %s", pairs, strings.Join(names, ", "))
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// dataURIModes are the accepted values of --data-uris: keep the base64
+// data URIs inlined in HTML and CSS, strip their payloads, or externalise
+// them into pairs of their own.
+var dataURIModes = []string{"keep", "strip", "externalise"}
+
+// dataURI matches a base64 data URI, capturing the media type and the
+// prefix before the payload.
+var dataURI = regexp.MustCompile(`(?i)(data:([a-z0-9.+/-]*)(?:;[a-z0-9=.+-]+)*;base64,)([a-z0-9+/=]+)`)
+
+// inlinedAssetPath is where externalised data URIs are served from, on the
+// host of the response that inlined them.
+const inlinedAssetPath = "/_inlined/"
+
+// inlinedAsset is an externalised data URI, served by its own pair.
+type inlinedAsset struct {
+	host     string
+	path     string
+	mimeType string
+	payload  string
+	// pair is the first pair that referenced the asset, whose split part
+	// the asset's pair joins.
+	pair int
+}
+
+// dataURIs finds base64 data URIs in HTML and CSS responses and applies
+// --data-uris to them. Browsers inline icons, fonts and images this way,
+// and in captures they often make up most of the body bytes.
+type dataURIs struct {
+	mode      string
+	found     int
+	responses int
+	uriBytes  int
+	bodyBytes int
+	assets    map[string]*inlinedAsset
+	order     []*inlinedAsset
+}
+
+// isInliningResponse reports whether p serves an HTML or CSS text body.
+func isInliningResponse(p Pair) bool {
+	if p.Response.EncodedBody || p.Response.Body == "" {
+		return false
+	}
+	for name, values := range p.Response.Headers {
+		if strings.EqualFold(name, "Content-Type") {
+			for _, v := range values {
+				if v = strings.ToLower(v); strings.Contains(v, "html") || strings.Contains(v, "css") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// apply counts the data URIs of pair index and, unless keeping them,
+// strips or externalises them. It reports whether the body changed.
+func (d *dataURIs) apply(p *Pair, index int) bool {
+	if !isInliningResponse(*p) {
+		return false
+	}
+	matches := dataURI.FindAllStringSubmatchIndex(p.Response.Body, -1)
+	if len(matches) == 0 {
+		return false
+	}
+	d.found += len(matches)
+	d.responses++
+	d.bodyBytes += len(p.Response.Body)
+	for _, m := range matches {
+		d.uriBytes += m[1] - m[0]
+	}
+	switch d.mode {
+	case "strip":
+		p.Response.Body = stripDataURIs(p.Response.Body)
+	case "externalise":
+		host := exactValue(p.Request.Destination)
+		p.Response.Body = dataURI.ReplaceAllStringFunc(p.Response.Body, func(uri string) string {
+			m := dataURI.FindStringSubmatch(uri)
+			if _, err := base64.StdEncoding.DecodeString(m[3]); err != nil {
+				return uri
+			}
+			return d.externalise(host, strings.ToLower(m[2]), m[3], index).path
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// externalise returns the asset serving payload on host, adding it the
+// first time the payload is seen there.
+func (d *dataURIs) externalise(host, mimeType, payload string, pair int) *inlinedAsset {
+	sum := sha256.Sum256([]byte(payload))
+	key := host + " " + mimeType + " " + string(sum[:])
+	if a, ok := d.assets[key]; ok {
+		return a
+	}
+	if d.assets == nil {
+		d.assets = map[string]*inlinedAsset{}
+	}
+	ext := ""
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	a := &inlinedAsset{host: host, path: fmt.Sprintf("%s%x%s", inlinedAssetPath, sum[:8], ext), mimeType: mimeType, payload: payload, pair: pair}
+	d.assets[key] = a
+	d.order = append(d.order, a)
+	return a
+}
+
+// pairs returns a pair serving every externalised asset.
+func (d *dataURIs) pairs() []Pair {
+	pairs := make([]Pair, len(d.order))
+	for i, a := range d.order {
+		mimeType := a.mimeType
+		if mimeType == "" {
+			mimeType = "text/plain"
+		}
+		pairs[i] = Pair{
+			Request: Request{
+				Method:      []FieldMatcher{{Matcher: "exact", Value: "GET"}},
+				Destination: []FieldMatcher{{Matcher: "exact", Value: a.host}},
+				Path:        []FieldMatcher{{Matcher: "exact", Value: a.path}},
+			},
+			Response: Response{
+				Status:      200,
+				Body:        a.payload,
+				EncodedBody: true,
+				Headers:     Header{"Content-Type": []string{mimeType}},
+			},
+			Labels: []string{"GET", "inlined-asset"},
+		}
+	}
+	return pairs
+}
+
+// stripDataURIs drops the payload of every base64 data URI in body,
+// leaving data:<type>;base64, so the markup around it is unchanged.
+func stripDataURIs(body string) string {
+	return dataURI.ReplaceAllString(body, "$1")
+}
+
+func (d *dataURIs) write() {
+	if d.found == 0 {
+		return
+	}
+	share := fmt.Sprintf("%d data URI(s) in %d HTML or CSS response(s) made up %d of their %d bytes",
+		d.found, d.responses, d.uriBytes, d.bodyBytes)
+	switch d.mode {
+	case "strip":
+		log.Printf("%s and were stripped", share)
+	case "externalise":
+		log.Printf("%s and were externalised into %d pair(s) under %s", share, len(d.order), inlinedAssetPath)
+	default:
+		log.Printf("%s; --data-uris strip or externalise shrinks them", share)
+	}
+}
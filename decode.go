@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Most recorders store response bodies decoded even though the
+// Content-Encoding header is kept, but some proxies store the compressed
+// bytes, including the brotli and zstd that modern browsers negotiate.
+// Hoverfly serves bodies as given and never adds a Content-Encoding header,
+// so such bodies are decompressed during conversion.
+
+// contentCodings returns the codings of the response's Content-Encoding
+// header in the order they were applied, without identity.
+func contentCodings(res HarResponse) []string {
+	var codings []string
+	for _, h := range res.Headers {
+		if !strings.EqualFold(h.Name, "Content-Encoding") {
+			continue
+		}
+		for _, c := range strings.Split(h.Value, ",") {
+			if c = strings.ToLower(strings.TrimSpace(c)); c != "" && c != "identity" {
+				codings = append(codings, c)
+			}
+		}
+	}
+	return codings
+}
+
+// encodedBytes returns the recorded body as bytes and whether they look
+// compressed with coding. Recorders that store compressed bytes as text map
+// each byte to a Latin-1 character, so those are recovered too. Bodies that
+// don't look compressed were already decoded by the recorder.
+func encodedBytes(res HarResponse, coding string) ([]byte, bool) {
+	text := res.Content.Text
+	if text == "" {
+		return nil, false
+	}
+	if res.Content.Encoding == "base64" {
+		raw, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, false
+		}
+		switch coding {
+		case "gzip", "x-gzip":
+			return raw, hasGzipMagic(raw)
+		case "zstd":
+			return raw, hasZstdMagic(raw)
+		case "br":
+			return raw, !utf8.Valid(raw) || brotliDecodes(raw)
+		default:
+			// Deflate has no reliable magic number, but compressed
+			// bytes are almost never valid UTF-8.
+			return raw, hasZlibHeader(raw) || !utf8.Valid(raw)
+		}
+	}
+
+	raw := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xff {
+			return nil, false
+		}
+		raw = append(raw, byte(r))
+	}
+	switch coding {
+	case "gzip", "x-gzip":
+		return raw, hasGzipMagic(raw)
+	case "deflate":
+		return raw, hasZlibHeader(raw)
+	case "zstd":
+		return raw, hasZstdMagic(raw)
+	case "br":
+		return raw, looksBinary(text) || brotliDecodes(raw)
+	}
+	return nil, false
+}
+
+func hasGzipMagic(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b
+}
+
+func hasZstdMagic(b []byte) bool {
+	return len(b) >= 4 && b[0] == 0x28 && b[1] == 0xb5 && b[2] == 0x2f && b[3] == 0xfd
+}
+
+func hasZlibHeader(b []byte) bool {
+	return len(b) >= 2 && b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// brotliDecodes reports whether raw is a complete brotli stream. Brotli has
+// no magic number, and small bodies compress to mostly literal bytes that
+// look like text, so a trial decode is the only reliable test.
+func brotliDecodes(raw []byte) bool {
+	_, err := io.ReadAll(brotli.NewReader(bytes.NewReader(raw)))
+	return err == nil
+}
+
+// decompress reverses a single content coding. Deflate is meant to be
+// zlib-wrapped, but some servers send raw deflate, so both are accepted.
+func decompress(coding string, raw []byte) ([]byte, error) {
+	var r io.Reader
+	switch coding {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case "deflate":
+		if hasZlibHeader(raw) {
+			if z, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+				if out, err := io.ReadAll(z); err == nil {
+					return out, nil
+				}
+			}
+		}
+		r = flate.NewReader(bytes.NewReader(raw))
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(raw))
+	case "zstd":
+		z, err := zstd.NewReader(bytes.NewReader(raw), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		r = z
+	default:
+		return nil, fmt.Errorf("unsupported content coding %q", coding)
+	}
+	return io.ReadAll(r)
+}
+
+// decodeResponseBody decompresses a response body the HAR holds still
+// encoded, storing the result as text, or as base64 when it isn't UTF-8,
+// and dropping the Content-Encoding header. It returns the codings removed;
+// on error the body is left as recorded.
+func decodeResponseBody(res *HarResponse) ([]string, error) {
+	codings := contentCodings(*res)
+	if len(codings) == 0 {
+		return nil, nil
+	}
+	raw, ok := encodedBytes(*res, codings[len(codings)-1])
+	if !ok {
+		return nil, nil
+	}
+	for i := len(codings) - 1; i >= 0; i-- {
+		out, err := decompress(codings[i], raw)
+		if err != nil {
+			return codings, fmt.Errorf("%s: %v", codings[i], err)
+		}
+		raw = out
+	}
+
+	if utf8.Valid(raw) {
+		res.Content.Text, res.Content.Encoding = string(raw), ""
+	} else {
+		res.Content.Text, res.Content.Encoding = base64.StdEncoding.EncodeToString(raw), "base64"
+	}
+	headers := make([]HarHeader, 0, len(res.Headers))
+	for _, h := range res.Headers {
+		if !strings.EqualFold(h.Name, "Content-Encoding") && !strings.EqualFold(h.Name, "Content-Length") {
+			headers = append(headers, h)
+		}
+	}
+	res.Headers = headers
+	return codings, nil
+}
+
+// writeDecodeReport logs how many bodies were decompressed per coding and
+// the bodies that couldn't be, which are served still encoded.
+func writeDecodeReport(decoded map[string]int, undecoded []string) {
+	if len(decoded) > 0 {
+		codings := make([]string, 0, len(decoded))
+		total := 0
+		for c, n := range decoded {
+			codings = append(codings, fmt.Sprintf("%s %d", c, n))
+			total += n
+		}
+		sort.Strings(codings)
+		log.Printf("Decompressed %d response body(ies) recorded still encoded (%s)", total, strings.Join(codings, ", "))
+	}
+	if len(undecoded) > 0 {
+		log.Printf("%d response body(ies) couldn't be decompressed and keep their Content-Encoding header:\n  %s",
+			len(undecoded), strings.Join(undecoded, "\n  "))
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxRecordedDelay clamps delays taken from recorded timings. Entries
+// that took longer were usually left hanging by the recording browser,
+// and clients under test would have timed out on them long before.
+const maxRecordedDelay = 60000
+
+// recordedDelay returns the entry's total time in whole milliseconds,
+// clamped to maxRecordedDelay, or -1 when the HAR records none.
+func recordedDelay(entry Entry) int {
+	if entry.Time <= 0 {
+		return -1
+	}
+	return int(math.Min(math.Round(entry.Time), maxRecordedDelay))
+}
+
+// applyRecordedDelay sets p's fixedDelay to the entry's recorded time,
+// keeping a longer delay an earlier option already set.
+func applyRecordedDelay(p *Pair, entry Entry) {
+	if d := recordedDelay(entry); d > p.Response.FixedDelay {
+		p.Response.FixedDelay = d
+	}
+}
+
+// logNormalScopes are the accepted values of --lognormal-delays: fit one
+// distribution per destination host, or per host and path.
+var logNormalScopes = []string{"host", "path"}
+
+// latencySamples collects the recorded times of the entries behind each
+// pair, grouped by --lognormal-delays scope, so every group can be given a
+// logNormal delay fitted to what was observed.
+type latencySamples struct {
+	scope   string
+	samples map[string][]int
+	pairs   map[string][]int
+	order   []string
+}
+
+func newLatencySamples(scope string) *latencySamples {
+	if scope == "" {
+		return nil
+	}
+	return &latencySamples{scope: scope, samples: map[string][]int{}, pairs: map[string][]int{}}
+}
+
+// add records the entry converted into pair index. A nil collector
+// ignores it.
+func (l *latencySamples) add(index int, p Pair, entry Entry) {
+	if l == nil {
+		return
+	}
+	key := exactValue(p.Request.Destination)
+	if l.scope == "path" {
+		key += exactValue(p.Request.Path)
+	}
+	if _, ok := l.pairs[key]; !ok {
+		l.order = append(l.order, key)
+	}
+	l.pairs[key] = append(l.pairs[key], index)
+	if d := recordedDelay(entry); d >= 0 {
+		l.samples[key] = append(l.samples[key], d)
+	}
+}
+
+// fitLogNormal summarises samples as Hoverfly's logNormalDelay. Hoverfly
+// derives sigma from ln(mean/median), so a mean below the median, which
+// left-skewed samples give, is raised to it.
+func fitLogNormal(samples []int) LogNormalDelay {
+	sorted := append([]int{}, samples...)
+	sort.Ints(sorted)
+	n := len(sorted)
+	median := sorted[n/2]
+	if n%2 == 0 {
+		median = int(math.Round(float64(sorted[n/2-1]+sorted[n/2]) / 2))
+	}
+	total := 0
+	for _, s := range sorted {
+		total += s
+	}
+	mean := int(math.Round(float64(total) / float64(n)))
+	if mean < median {
+		mean = median
+	}
+	return LogNormalDelay{Min: sorted[0], Max: sorted[n-1], Mean: mean, Median: median}
+}
+
+// apply gives every pair of a group the group's fitted delay, returning a
+// line per group for the report. Groups without recorded times are left
+// without a delay.
+func (l *latencySamples) apply(pairs []Pair) []string {
+	if l == nil {
+		return nil
+	}
+	var fitted []string
+	for _, key := range l.order {
+		samples := l.samples[key]
+		if len(samples) == 0 {
+			continue
+		}
+		d := fitLogNormal(samples)
+		for _, i := range l.pairs[key] {
+			delay := d
+			pairs[i].Response.LogNormalDelay = &delay
+		}
+		fitted = append(fitted, fmt.Sprintf("%s: median %dms, mean %dms, %d-%dms over %d entr(ies)", key, d.Median, d.Mean, d.Min, d.Max, len(samples)))
+	}
+	return fitted
+}
+
+func writeLogNormalReport(fitted []string) {
+	if len(fitted) == 0 {
+		return
+	}
+	log.Printf("Fitted logNormal delays for %d destination(s):\n  %s", len(fitted), strings.Join(fitted, "\n  "))
+}
+
+// delayScaling implements --delay-multiplier and --delay-cap-ms for the
+// delays taken from the HAR, e.g. to replay a capture ten times faster in
+// CI without one outlier slowing every run.
+type delayScaling struct {
+	multiplier float64
+	cap        int
+}
+
+// limit is the cap, which defaults to the clamp on recorded delays.
+func (s delayScaling) limit() int {
+	if s.cap == 0 {
+		return maxRecordedDelay
+	}
+	return s.cap
+}
+
+func (s delayScaling) scale(ms int) int {
+	return int(math.Min(math.Round(float64(ms)*s.multiplier), float64(s.limit())))
+}
+
+func (s delayScaling) logNormal(d LogNormalDelay) LogNormalDelay {
+	return LogNormalDelay{Min: s.scale(d.Min), Max: s.scale(d.Max), Mean: s.scale(d.Mean), Median: s.scale(d.Median)}
+}
+
+// apply scales the fixed and logNormal delays of pairs, returning how many
+// pairs it changed.
+func (s delayScaling) apply(pairs []Pair) int {
+	if s.multiplier == 1 && s.cap == 0 {
+		return 0
+	}
+	changed := 0
+	for i := range pairs {
+		res := &pairs[i].Response
+		before := *res
+		res.FixedDelay = s.scale(res.FixedDelay)
+		if d := res.LogNormalDelay; d != nil {
+			scaled := s.logNormal(*d)
+			res.LogNormalDelay = &scaled
+		}
+		if res.FixedDelay != before.FixedDelay || (res.LogNormalDelay != nil && *res.LogNormalDelay != *before.LogNormalDelay) {
+			changed++
+		}
+	}
+	return changed
+}
+
+// globalDelays builds the global delays of --global-delay: one matching
+// every request, or one per host glob of --delay-host. Hoverfly matches
+// urlPattern against the destination followed by the path, so each glob
+// is anchored to the host, with any port.
+func globalDelays(ms int, hosts string) []GlobalDelay {
+	if hosts == "" {
+		return []GlobalDelay{{URLPattern: ".", Delay: ms}}
+	}
+	var delays []GlobalDelay
+	for _, host := range splitList(hosts) {
+		parts := strings.Split(host, "*")
+		for i, p := range parts {
+			parts[i] = regexp.QuoteMeta(p)
+		}
+		delays = append(delays, GlobalDelay{URLPattern: "^" + strings.Join(parts, "[^/:]*") + "(:[0-9]+)?(/|$)", Delay: ms})
+	}
+	return delays
+}
+
+// globalLogNormalDelays builds the global delay of --global-lognormal-delay:
+// one logNormal delay fitted to the recorded times of every converted entry
+// and matching every request, for captures with too many endpoints to give
+// each pair a delay of its own.
+func globalLogNormalDelays(samples []int, scaling delayScaling) []GlobalLogNormalDelay {
+	if len(samples) == 0 {
+		log.Print("No converted entry records its time; --global-lognormal-delay added no delay")
+		return nil
+	}
+	d := scaling.logNormal(fitLogNormal(samples))
+	log.Printf("Fitted a global logNormal delay to %d entr(ies): median %dms, mean %dms, %d-%dms", len(samples), d.Median, d.Mean, d.Min, d.Max)
+	return []GlobalLogNormalDelay{{URLPattern: ".", LogNormalDelay: d}}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestFitLogNormal(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []int
+		want    LogNormalDelay
+	}{
+		{"single sample", []int{5}, LogNormalDelay{Min: 5, Max: 5, Mean: 5, Median: 5}},
+		{"odd count", []int{30, 10, 20}, LogNormalDelay{Min: 10, Max: 30, Mean: 20, Median: 20}},
+		{"even count averages the middle two", []int{10, 20, 30, 41}, LogNormalDelay{Min: 10, Max: 41, Mean: 25, Median: 25}},
+		{"right-skewed", []int{1, 2, 3, 1000}, LogNormalDelay{Min: 1, Max: 1000, Mean: 252, Median: 3}},
+		{"mean raised to the median", []int{100, 100, 100, 1}, LogNormalDelay{Min: 1, Max: 100, Mean: 100, Median: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitLogNormal(tt.samples); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobalDelays(t *testing.T) {
+	if got, want := globalDelays(50, ""), []GlobalDelay{{URLPattern: ".", Delay: 50}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without hosts got %+v, want %+v", got, want)
+	}
+
+	tests := []struct {
+		hosts   string
+		url     string
+		matched bool
+	}{
+		{"api.example.com", "api.example.com/users", true},
+		{"api.example.com", "api.example.com", true},
+		{"api.example.com", "api.example.com:8443/users", true},
+		{"api.example.com", "xapi.example.com/users", false},
+		{"api.example.com", "api.example.com.attacker.net/users", false},
+		{"api.example.com", "apixexample.com/users", false},
+		{"api.example.com", "evil.net/api.example.com/users", false},
+		{"*.example.com", "api.example.com/users", true},
+		{"*.example.com", "cdn.example.com:443/", true},
+		{"*.example.com", "example.com/users", false},
+		{"*.example.com", "evil.net/x.example.com/users", false},
+		{"api.example.com, cdn.example.com", "cdn.example.com/app.js", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hosts+" "+tt.url, func(t *testing.T) {
+			matched := false
+			for _, d := range globalDelays(50, tt.hosts) {
+				if d.Delay != 50 {
+					t.Errorf("%s has delay %d, want 50", d.URLPattern, d.Delay)
+				}
+				if regexp.MustCompile(d.URLPattern).MatchString(tt.url) {
+					matched = true
+				}
+			}
+			if matched != tt.matched {
+				t.Errorf("matched %v, want %v", matched, tt.matched)
+			}
+		})
+	}
+}
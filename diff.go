@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pairDiff describes how one request's pair differs between two
+// simulations. Old and New are pair positions, -1 when absent.
+type pairDiff struct {
+	Request string       `json:"request"`
+	Status  string       `json:"status"`
+	Old     int          `json:"old"`
+	New     int          `json:"new"`
+	Changes []jsonChange `json:"changes,omitempty"`
+}
+
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := flags.String("format", "tree", "Output format: tree, json, or patch for an RFC 6902 JSON Patch turning old into new")
+	arrayKeys := flags.String("array-keys", strings.Join(defaultArrayKeys, ","), "Fields used to match JSON array elements across versions")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatal("Usage: har-to-hoverfly diff [flags] old.json new.json")
+	}
+	old, err := readSimulation(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+	new, err := readSimulation(flags.Arg(1))
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+
+	var diffs []pairDiff
+	if *format != "patch" {
+		diffs = diffSimulations(old, new, splitList(*arrayKeys))
+	}
+	switch *format {
+	case "tree":
+		writeDiffTree(os.Stdout, diffs)
+	case "json":
+		out, _ := json.MarshalIndent(diffs, "", "  ")
+		fmt.Println(string(out))
+	case "patch":
+		ops, reordered, err := simulationPatch(old, new)
+		if err != nil {
+			log.Fatalf("Failed to build patch: %v", err)
+		}
+		if reordered {
+			log.Print("Pairs were reordered; the patch keeps the old order, which can change which pair Hoverfly matches first")
+		}
+		out, _ := json.MarshalIndent(ops, "", "  ")
+		fmt.Println(string(out))
+	default:
+		log.Fatalf("Unknown --format %q: expected tree, json or patch", *format)
+	}
+}
+
+// diffSimulations pairs up requests by their matchers and compares the
+// responses structurally, with JSON bodies decoded so field-level changes
+// are reported instead of a changed string.
+func diffSimulations(old, new Simulation, arrayKeys []string) []pairDiff {
+	newIndex := pairIndex(new.Data.Pairs)
+	oldIndex := pairIndex(old.Data.Pairs)
+
+	var diffs []pairDiff
+	for i, p := range old.Data.Pairs {
+		key := requestKey(p)
+		if oldIndex[key] != i {
+			continue
+		}
+		j, ok := newIndex[key]
+		if !ok {
+			diffs = append(diffs, pairDiff{Request: describeRequest(p), Status: "removed", Old: i, New: -1})
+			continue
+		}
+		changes := diffJSON(responseView(p.Response), responseView(new.Data.Pairs[j].Response), arrayKeys)
+		if len(changes) > 0 {
+			diffs = append(diffs, pairDiff{Request: describeRequest(p), Status: "changed", Old: i, New: j, Changes: changes})
+		}
+	}
+	for j, p := range new.Data.Pairs {
+		key := requestKey(p)
+		if _, ok := oldIndex[key]; !ok && newIndex[key] == j {
+			diffs = append(diffs, pairDiff{Request: describeRequest(p), Status: "added", Old: -1, New: j})
+		}
+	}
+	return diffs
+}
+
+// responseView is the response as generic JSON with a JSON body decoded in
+// place of its string form.
+func responseView(res Response) interface{} {
+	data, _ := json.Marshal(res)
+	var view map[string]interface{}
+	json.Unmarshal(data, &view)
+	var body interface{}
+	if !res.EncodedBody && json.Unmarshal([]byte(res.Body), &body) == nil {
+		view["body"] = body
+	}
+	return view
+}
+
+func writeDiffTree(w io.Writer, diffs []pairDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+	marks := map[string]string{"added": "+", "removed": "-", "changed": "~"}
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s %s\n", marks[d.Status], d.Request)
+		// Changes are in patch order; the tree reads better by path.
+		changes := append([]jsonChange(nil), d.Changes...)
+		sort.SliceStable(changes, func(i, j int) bool { return changes[i].Display < changes[j].Display })
+		for _, c := range changes {
+			path := c.Display
+			switch c.Op {
+			case "add":
+				fmt.Fprintf(w, "    + %s: %s\n", path, diffValue(c.Value))
+			case "remove":
+				fmt.Fprintf(w, "    - %s: %s\n", path, diffValue(c.Old))
+			default:
+				fmt.Fprintf(w, "    ~ %s: %s → %s\n", path, diffValue(c.Old), diffValue(c.Value))
+			}
+		}
+	}
+}
+
+// diffValue renders a value on one line, shortening large ones.
+func diffValue(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return truncate(string(data), 80)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// Hoverfly replays over HTTP/1.1, so pairs recorded over HTTP/2 or HTTP/3
+// are downgraded: pseudo-headers and connection-specific headers that only
+// exist per hop are dropped from the matchers, and Alt-Svc is dropped from
+// responses so clients don't try to upgrade to a protocol Hoverfly lacks.
+
+var connectionHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Http2-Settings":    true,
+	"Te":                true,
+}
+
+// isMultiplexedHTTP reports whether a HAR httpVersion is HTTP/2 or HTTP/3,
+// which recorders write variously as HTTP/2.0, h2, h3 or http/3.
+func isMultiplexedHTTP(version string) bool {
+	v := strings.ToLower(version)
+	return strings.HasPrefix(v, "http/2") || strings.HasPrefix(v, "http/3") || v == "h2" || v == "h3" || strings.HasPrefix(v, "h3-")
+}
+
+// downgradePair removes what an HTTP/1.1 replay can't honour from a pair
+// recorded over HTTP/2 or HTTP/3, returning the header names dropped.
+func downgradePair(p *Pair) []string {
+	var dropped []string
+	for name := range p.Request.Headers {
+		if strings.HasPrefix(name, ":") || connectionHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			delete(p.Request.Headers, name)
+			dropped = append(dropped, name)
+		}
+	}
+	for name := range p.Response.Headers {
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		if strings.HasPrefix(name, ":") || connectionHeaders[canonical] || canonical == "Alt-Svc" {
+			delete(p.Response.Headers, name)
+			dropped = append(dropped, name)
+		}
+	}
+	return dropped
+}
+
+// wasPushed reports whether Chrome marked the entry as an HTTP/2 server
+// push. Over HTTP/1.1 the client requests such resources itself.
+func wasPushed(raw json.RawMessage) bool {
+	v := strings.TrimSpace(string(raw))
+	return v != "" && v != "0" && v != "false" && v != "null"
+}
+
+// writeDowngradeReport logs how many pairs were downgraded, which headers
+// were dropped how often, and the server-pushed entries.
+func writeDowngradeReport(downgraded int, dropped map[string]int, pushed []string) {
+	names := make([]string, 0, len(dropped))
+	for name := range dropped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var counts []string
+	for _, name := range names {
+		counts = append(counts, fmt.Sprintf("%s (%d)", name, dropped[name]))
+	}
+	if downgraded > 0 {
+		msg := fmt.Sprintf("Downgraded %d HTTP/2 or HTTP/3 pair(s) for HTTP/1.1 replay", downgraded)
+		if len(counts) > 0 {
+			msg += "; dropped " + strings.Join(counts, ", ")
+		}
+		log.Print(msg)
+	}
+	if len(pushed) > 0 {
+		log.Printf("%d entr(ies) were HTTP/2 server pushes; HTTP/1.1 clients must request them, so check they are matched:\n  %s", len(pushed), strings.Join(pushed, "\n  "))
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+// pairSelector picks the pairs an edit command applies to. Empty fields
+// match everything, so a selector with no flags set selects every pair.
+type pairSelector struct {
+	host   string
+	path   string
+	method string
+	label  string
+}
+
+func addSelectorFlags(flags *flag.FlagSet) *pairSelector {
+	s := &pairSelector{}
+	flags.StringVar(&s.host, "host", "", "Only edit pairs whose destination contains this host")
+	flags.StringVar(&s.path, "path", "", "Only edit pairs whose path matches this glob (e.g. /api/users/*)")
+	flags.StringVar(&s.method, "method", "", "Only edit pairs with this HTTP method")
+	flags.StringVar(&s.label, "label", "", "Only edit pairs carrying this label")
+	return s
+}
+
+// empty reports whether s has no criteria, so selects every pair.
+func (s *pairSelector) empty() bool {
+	return *s == pairSelector{}
+}
+
+func (s *pairSelector) matches(p Pair) bool {
+	if s.host != "" && !matcherContains(p.Request.Destination, s.host) {
+		return false
+	}
+	if s.path != "" {
+		ok := false
+		for _, m := range p.Request.Path {
+			if matched, _ := path.Match(s.path, m.Value); matched {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if s.method != "" {
+		ok := false
+		for _, m := range p.Request.Method {
+			if strings.EqualFold(m.Value, s.method) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if s.label != "" && !hasLabel(p, s.label) {
+		return false
+	}
+	return true
+}
+
+func matcherContains(matchers []FieldMatcher, substr string) bool {
+	for _, m := range matchers {
+		if strings.Contains(m.Value, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLabel(p Pair, label string) bool {
+	for _, l := range p.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// editSimulation implements the shared plumbing for the edit commands:
+// parse flags, load the simulation, apply edit to each selected pair and
+// write the result. edit returns false to drop the pair from the output.
+// Pairs are kept as raw JSON and only the fields an edit changed are
+// rewritten, so what the Simulation types don't model, such as bodyFile,
+// postServeAction or meta.hoverflyVersion, survives.
+func editSimulation(name string, args []string, addFlags func(*flag.FlagSet, *pairSelector) func() error, edit func(*Pair) bool) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file to edit")
+	outputFile := flags.String("output", "", "Path to write the edited simulation (optional, defaults to editing --input in place)")
+	selector := addSelectorFlags(flags)
+	validate := addFlags(flags, selector)
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a simulation file with --input")
+	}
+	if err := validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := readSimulationJSON(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to read simulation: %v", err)
+	}
+	var sim rawSimulation
+	if err := json.Unmarshal(data, &sim); err != nil {
+		log.Fatalf("Failed to parse simulation: %s: %v", *inputFile, err)
+	}
+
+	edited := 0
+	kept := sim.Data.Pairs[:0]
+	for i, raw := range sim.Data.Pairs {
+		var pair Pair
+		if err := json.Unmarshal(raw, &pair); err != nil {
+			log.Fatalf("Failed to parse simulation: pair %d: %v", i, err)
+		}
+		if !selector.matches(pair) {
+			kept = append(kept, raw)
+			continue
+		}
+		edited++
+		before, err := json.Marshal(pair)
+		if err != nil {
+			log.Fatalf("Failed to serialize pair %d: %v", i, err)
+		}
+		if !edit(&pair) {
+			continue
+		}
+		after, err := json.Marshal(pair)
+		if err != nil {
+			log.Fatalf("Failed to serialize pair %d: %v", i, err)
+		}
+		if raw, err = patchJSON(raw, before, after); err != nil {
+			log.Fatalf("Failed to serialize pair %d: %v", i, err)
+		}
+		kept = append(kept, raw)
+	}
+	sim.Data.Pairs = kept
+
+	if *outputFile == "" {
+		*outputFile = *inputFile
+	}
+	output, err := json.MarshalIndent(sim, "", "  ")
+	if err == nil && isYAMLPath(*outputFile) {
+		output, err = jsonToYAML(output)
+	}
+	if err != nil {
+		log.Fatalf("Failed to serialize simulation: %v", err)
+	}
+	if err := writeOutput(*outputFile, output); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+	log.Printf("%s: %d pair(s) matched", name, edited)
+}
+
+// patchJSON applies the change from before to after, two encodings of a
+// value, to raw, the JSON that value was read from. Object members the
+// change leaves alone keep their original JSON, including members the
+// encodings don't have at all.
+func patchJSON(raw, before, after json.RawMessage) (json.RawMessage, error) {
+	if bytes.Equal(before, after) {
+		return raw, nil
+	}
+	var r, b, a map[string]json.RawMessage
+	if json.Unmarshal(raw, &r) != nil || json.Unmarshal(before, &b) != nil || json.Unmarshal(after, &a) != nil || r == nil || b == nil || a == nil {
+		return after, nil
+	}
+	for k, v := range a {
+		old, ok := r[k]
+		if !ok {
+			r[k] = v
+			continue
+		}
+		patched, err := patchJSON(old, b[k], v)
+		if err != nil {
+			return nil, err
+		}
+		r[k] = patched
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			delete(r, k)
+		}
+	}
+	return json.Marshal(r)
+}
+
+func runSetStatus(args []string) {
+	var status int
+	editSimulation("set-status", args, func(flags *flag.FlagSet, _ *pairSelector) func() error {
+		flags.IntVar(&status, "status", 0, "HTTP status code to set on matching pairs")
+		return func() error {
+			if status < 100 || status > 599 {
+				return fmt.Errorf("--status must be a valid HTTP status code, got %d", status)
+			}
+			return nil
+		}
+	}, func(p *Pair) bool {
+		p.Response.Status = status
+		return true
+	})
+}
+
+func runSetDelay(args []string) {
+	var delay int
+	editSimulation("set-delay", args, func(flags *flag.FlagSet, _ *pairSelector) func() error {
+		flags.IntVar(&delay, "delay", 0, "Fixed delay in milliseconds to set on matching pairs (0 removes it)")
+		return func() error {
+			if delay < 0 {
+				return fmt.Errorf("--delay must not be negative")
+			}
+			return nil
+		}
+	}, func(p *Pair) bool {
+		p.Response.FixedDelay = delay
+		return true
+	})
+}
+
+func runRelabel(args []string) {
+	var add, remove string
+	editSimulation("relabel", args, func(flags *flag.FlagSet, _ *pairSelector) func() error {
+		flags.StringVar(&add, "add", "", "Comma-separated labels to add to matching pairs")
+		flags.StringVar(&remove, "remove", "", "Comma-separated labels to remove from matching pairs")
+		return func() error {
+			if add == "" && remove == "" {
+				return fmt.Errorf("relabel needs --add and/or --remove")
+			}
+			return nil
+		}
+	}, func(p *Pair) bool {
+		for _, l := range splitList(remove) {
+			p.Labels = removeLabel(p.Labels, l)
+		}
+		for _, l := range splitList(add) {
+			if !hasLabel(*p, l) {
+				p.Labels = append(p.Labels, l)
+			}
+		}
+		return true
+	})
+}
+
+func runDelete(args []string) {
+	var all bool
+	editSimulation("delete", args, func(flags *flag.FlagSet, selector *pairSelector) func() error {
+		flags.BoolVar(&all, "all", false, "Delete every pair; needed when no --host, --path, --method or --label is given")
+		return func() error {
+			if selector.empty() && !all {
+				return fmt.Errorf("delete needs --host, --path, --method or --label to select pairs, or --all to delete every pair")
+			}
+			return nil
+		}
+	}, func(p *Pair) bool {
+		return false
+	})
+}
+
+func removeLabel(labels []string, label string) []string {
+	kept := labels[:0]
+	for _, l := range labels {
+		if l != label {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
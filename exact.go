@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// exactResponseBody returns the response body exactly as it went over the
+// wire, for --byte-exact. Hoverfly serves a plain body as its UTF-8 bytes,
+// so bodies that were recorded base64-encoded, or decoded by the recorder
+// from a single-byte charset, are returned as an encodedBody instead.
+func exactResponseBody(res HarResponse) (body string, encoded bool, err error) {
+	text := res.Content.Text
+	if res.Content.Encoding != "" {
+		if res.Content.Encoding != "base64" {
+			return "", false, fmt.Errorf("unsupported content encoding %q", res.Content.Encoding)
+		}
+		raw, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid base64 body: %v", err)
+		}
+		// Re-encode so Hoverfly's decoder sees canonical padding.
+		return base64.StdEncoding.EncodeToString(raw), true, nil
+	}
+
+	switch charset := responseCharset(res); charset {
+	case "", "utf-8", "utf8":
+		return text, false, nil
+	case "us-ascii", "ascii":
+		for i := 0; i < len(text); i++ {
+			if text[i] >= utf8.RuneSelf {
+				return "", false, fmt.Errorf("body has non-ASCII characters but declares charset %s", charset)
+			}
+		}
+		return text, false, nil
+	case "iso-8859-1", "latin1", "l1":
+		raw := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xff {
+				return "", false, fmt.Errorf("body has characters outside charset %s", charset)
+			}
+			raw = append(raw, byte(r))
+		}
+		return base64.StdEncoding.EncodeToString(raw), true, nil
+	default:
+		return "", false, fmt.Errorf("the HAR holds text decoded from charset %s, so the original bytes are unknown", charset)
+	}
+}
+
+// responseCharset returns the lower-cased charset of the response, taken
+// from its Content-Type header or, failing that, the content mimeType.
+func responseCharset(res HarResponse) string {
+	contentType := res.Content.MimeType
+	for _, h := range res.Headers {
+		if strings.EqualFold(h.Name, "Content-Type") {
+			contentType = h.Value
+			break
+		}
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(params["charset"])
+}
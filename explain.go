@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// headerList collects repeated --header "Name: value" flags.
+type headerList []string
+
+func (h *headerList) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerList) Set(v string) error {
+	if !strings.Contains(v, ":") {
+		return fmt.Errorf("expected Name: value, got %q", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+func runExplain(args []string) {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file")
+	method := flags.String("method", "GET", "Request method")
+	rawURL := flags.String("url", "", "Request URL, e.g. https://api.example.com/users?id=1")
+	body := flags.String("body", "", "Request body")
+	var headers headerList
+	flags.Var(&headers, "header", "Request header as \"Name: value\" (repeatable)")
+	top := flags.Int("top", 3, "Number of closest pairs to explain when nothing matches")
+	indexFile := flags.String("index", "", "Read only the pairs for the request's host using an index written by --index during conversion")
+	docs := flags.Bool("matchers", false, "Print how Hoverfly evaluates each matcher type and request field, then exit")
+	flags.Parse(args)
+
+	if *docs {
+		printMatcherDocs()
+		return
+	}
+	if (*inputFile == "" && *indexFile == "") || *rawURL == "" {
+		log.Fatal("explain needs --input (or --index) and --url")
+	}
+
+	u := parseURL(*rawURL)
+	req := liveRequest{
+		Method:  strings.ToUpper(*method),
+		Scheme:  u.Scheme,
+		Host:    u.Host,
+		Path:    u.Path,
+		Query:   u.Query(),
+		Headers: http.Header{},
+		Body:    *body,
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	var ids []int
+	var pairs []Pair
+	if *indexFile != "" {
+		idx, err := readIndex(*indexFile)
+		if err != nil {
+			log.Fatalf("Failed to read index: %v", err)
+		}
+		// Pairs without an exact destination are indexed under "" and
+		// could match any host, so they are read too unless the request
+		// has no host and they already were.
+		ids = append(ids, idx.Hosts[u.Host]...)
+		if u.Host != "" {
+			ids = append(ids, idx.Hosts[""]...)
+		}
+		sort.Ints(ids)
+		if pairs, err = readIndexedPairs(idx, ids); err != nil {
+			log.Fatalf("Failed to read indexed pairs: %v", err)
+		}
+	} else {
+		sim, err := readSimulation(*inputFile)
+		if err != nil {
+			log.Fatalf("Failed to parse simulation: %v", err)
+		}
+		pairs = sim.Data.Pairs
+		for i := range pairs {
+			ids = append(ids, i)
+		}
+	}
+
+	type scored struct {
+		index   int
+		pair    Pair
+		results []fieldResult
+		matched int
+	}
+	var candidates []scored
+	for i, p := range pairs {
+		results := matchPair(p, req, nil)
+		if pairMatches(results) {
+			fmt.Printf("Pair %d (%s) matches; Hoverfly serves the first matching pair in simulation order.\n", ids[i], describeRequest(p))
+			printResults(results)
+			return
+		}
+		n := 0
+		for _, r := range results {
+			if r.Matched {
+				n++
+			}
+		}
+		candidates = append(candidates, scored{ids[i], p, results, n})
+	}
+
+	// Hoverfly reports the closest miss by how many matchers agreed.
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].matched > candidates[j].matched })
+	fmt.Printf("No pair matches %s %s. Closest pairs:\n", req.Method, *rawURL)
+	for i, c := range candidates {
+		if i >= *top {
+			break
+		}
+		fmt.Printf("\nPair %d (%s): %d/%d matchers agree\n", c.index, describeRequest(c.pair), c.matched, len(c.results))
+		printResults(c.results)
+	}
+}
+
+func printResults(results []fieldResult) {
+	explained := map[string]bool{}
+	for _, r := range results {
+		field := r.Field
+		if r.Key != "" {
+			field += "[" + r.Key + "]"
+		}
+		status := "ok  "
+		if !r.Matched {
+			status = "MISS"
+		}
+		fmt.Printf("  %s %-28s %-11s %q", status, field, r.Matcher.Matcher, r.Matcher.Value)
+		if !r.Matched {
+			fmt.Printf(" vs %q: %s", r.Actual, r.Reason)
+		}
+		fmt.Println()
+		if !r.Matched {
+			if doc, ok := fieldDocs[r.Field]; ok && !explained["field:"+r.Field] {
+				fmt.Printf("         %s: %s\n", r.Field, doc)
+				explained["field:"+r.Field] = true
+			}
+			if doc, ok := matcherDocs[strings.ToLower(r.Matcher.Matcher)]; ok && !explained["matcher:"+r.Matcher.Matcher] {
+				fmt.Printf("         %s matcher: %s\n", r.Matcher.Matcher, doc)
+				explained["matcher:"+r.Matcher.Matcher] = true
+			}
+		}
+	}
+}
+
+func printMatcherDocs() {
+	fmt.Println("Request fields:")
+	for _, f := range []string{"method", "scheme", "destination", "path", "query", "headers", "body", "requiresState"} {
+		fmt.Printf("  %-14s %s\n", f, fieldDocs[f])
+	}
+	fmt.Println("\nMatchers:")
+	names := make([]string, 0, len(matcherDocs))
+	for name := range matcherDocs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-14s %s\n", name, matcherDocs[name])
+	}
+}
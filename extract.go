@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+// extractFilter selects the pairs extract copies out. Each flag takes a
+// comma-separated list; a pair must match one value of every flag given.
+type extractFilter struct {
+	labels, hosts, paths, methods []string
+}
+
+func runExtract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file to extract from")
+	outputFile := flags.String("output", "", "Path to write the extracted simulation (optional, defaults to stdout)")
+	labels := flags.String("label", "", "Comma-separated labels; extract pairs carrying any of them")
+	hosts := flags.String("host", "", "Comma-separated hosts; extract pairs whose destination contains any of them")
+	paths := flags.String("path", "", "Comma-separated path globs (e.g. /api/users/*); extract pairs matching any of them")
+	methods := flags.String("method", "", "Comma-separated HTTP methods; extract pairs with any of them")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a simulation file with --input")
+	}
+	f := extractFilter{splitList(*labels), splitList(*hosts), splitList(*paths), splitList(*methods)}
+	if len(f.labels)+len(f.hosts)+len(f.paths)+len(f.methods) == 0 {
+		log.Fatal("extract needs at least one of --label, --host, --path or --method")
+	}
+
+	sim, err := readSimulation(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+	total := len(sim.Data.Pairs)
+	extracted := []Pair{}
+	for _, p := range sim.Data.Pairs {
+		if f.matches(p) {
+			extracted = append(extracted, p)
+		}
+	}
+	// The subset is a standalone simulation, so it keeps the global
+	// actions and schema version of the master.
+	sim.Data.Pairs = extracted
+	if missing := unsetState(extracted); len(missing) > 0 {
+		log.Printf("Extracted pairs require state no extracted pair sets, so they can only match once it is set another way: %s", strings.Join(missing, ", "))
+	}
+
+	output, err := marshalSimulation(sim, isYAMLPath(*outputFile))
+	if err != nil {
+		log.Fatalf("Failed to serialize simulation: %v", err)
+	}
+	if err := writeOutput(*outputFile, output); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+	log.Printf("extract: %d of %d pair(s) extracted", len(extracted), total)
+}
+
+func (f extractFilter) matches(p Pair) bool {
+	if len(f.labels) > 0 && !anyString(f.labels, func(l string) bool { return hasLabel(p, l) }) {
+		return false
+	}
+	if len(f.hosts) > 0 && !anyString(f.hosts, func(h string) bool { return matcherContains(p.Request.Destination, h) }) {
+		return false
+	}
+	if len(f.paths) > 0 && !anyString(f.paths, func(glob string) bool {
+		for _, m := range p.Request.Path {
+			if ok, _ := path.Match(glob, m.Value); ok {
+				return true
+			}
+		}
+		return false
+	}) {
+		return false
+	}
+	if len(f.methods) > 0 && !anyString(f.methods, func(method string) bool {
+		for _, m := range p.Request.Method {
+			if strings.EqualFold(m.Value, method) {
+				return true
+			}
+		}
+		return false
+	}) {
+		return false
+	}
+	return true
+}
+
+func anyString(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// unsetState returns the state keys that pairs require but none of them
+// transition, which happens when the pairs setting them were left behind.
+func unsetState(pairs []Pair) []string {
+	set := map[string]bool{}
+	for _, p := range pairs {
+		for k := range p.Response.TransitionsState {
+			set[k] = true
+		}
+	}
+	var missing []string
+	seen := map[string]bool{}
+	for _, p := range pairs {
+		for k := range p.Request.RequiresState {
+			if !set[k] && !seen[k] {
+				seen[k] = true
+				missing = append(missing, k)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Form-encoded bodies are matched with one regex per field rather than the
+// exact body: browsers and HTTP clients order fields differently, and
+// encode the same value as "+" or "%20", or with upper or lower case hex.
+// Each regex accepts its field anywhere in the body under any of those
+// encodings; Hoverfly ANDs them, so extra fields are allowed, as for
+// query matchers.
+
+func isFormEncoded(mimeType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(mimeType)), "application/x-www-form-urlencoded")
+}
+
+// formMatchers returns the field matchers for a form-encoded postData, from
+// its params or else its text. It returns nil when there are no fields.
+func formMatchers(post PostData) []FieldMatcher {
+	type field struct{ name, value string }
+	var fields []field
+	if len(post.Params) > 0 {
+		for _, p := range post.Params {
+			fields = append(fields, field{p.Name, p.Value})
+		}
+	} else {
+		for _, kv := range strings.Split(post.Text, "&") {
+			k, v, _ := strings.Cut(kv, "=")
+			k, kerr := url.QueryUnescape(k)
+			v, verr := url.QueryUnescape(v)
+			if k == "" || kerr != nil || verr != nil {
+				continue
+			}
+			fields = append(fields, field{k, v})
+		}
+	}
+	var matchers []FieldMatcher
+	for _, f := range fields {
+		if f.name == "" {
+			continue
+		}
+		matchers = append(matchers, FieldMatcher{
+			Matcher: "regex",
+			Value:   `(^|&)` + formPattern(f.name) + `=` + formPattern(f.value) + `(&|$)`,
+		})
+	}
+	return matchers
+}
+
+// formPattern matches s under every form encoding of it.
+func formPattern(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ':
+			b.WriteString(`(?:\+|%20)`)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c < 0x80 && c > 0x20 && c != '&' && c != '=' && c != '+' && c != '%' && c != '#':
+			// Other printable characters may be sent as is or escaped.
+			fmt.Fprintf(&b, `(?:%s|%%(?i:%02x))`, regexp.QuoteMeta(string(c)), c)
+		default:
+			fmt.Fprintf(&b, `%%(?i:%02x)`, c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// outputOptions carries the settings individual output formats need beyond
+// the simulation itself.
+type outputOptions struct {
+	goPackage     string
+	pactConsumer  string
+	pactProvider  string
+	k8sName       string
+	k8sNamespace  string
+	hoverflyImage string
+}
+
+// outputFormats maps --format values to the writers that render a converted
+// simulation.
+var outputFormats = map[string]func(Simulation, outputOptions) ([]byte, error){
+	"json": func(sim Simulation, _ outputOptions) ([]byte, error) {
+		return marshalSimulation(sim, false)
+	},
+	"yaml": func(sim Simulation, _ outputOptions) ([]byte, error) {
+		return marshalSimulation(sim, true)
+	},
+	"gotest": renderGoTest,
+	"pact":   renderPact,
+	"karate": renderKarate,
+
+	"k8s-configmap":  renderK8sConfigMap,
+	"testcontainers": renderTestcontainers,
+}
+
+func outputFormatNames() string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
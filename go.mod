@@ -1,3 +1,11 @@
 module github.com/iocosolutions/har-to-hoverfly
 
 go 1.23.0
+
+require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/klauspost/compress v1.17.9
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.16.0
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"go/format"
+	"strconv"
+	"text/template"
+)
+
+// goFixture is the flattened view of a pair used by the gotest template.
+type goFixture struct {
+	Method  string
+	Path    string
+	Query   map[string]string
+	Status  int
+	Headers map[string][]string
+	Body    string
+}
+
+// renderGoTest emits a Go source file with an httptest handler table built
+// from the simulation's pairs, so unit tests can serve captured behaviour
+// without running Hoverfly. Only exact method/path/query matchers are
+// reproduced; pairs without an exact path are skipped.
+func renderGoTest(sim Simulation, opts outputOptions) ([]byte, error) {
+	var fixtures []goFixture
+	for _, pair := range sim.Data.Pairs {
+		path := exactValue(pair.Request.Path)
+		if path == "" {
+			continue
+		}
+		f := goFixture{
+			Method:  exactValue(pair.Request.Method),
+			Path:    path,
+			Query:   map[string]string{},
+			Status:  pair.Response.Status,
+			Headers: pair.Response.Headers,
+			Body:    pair.Response.Body,
+		}
+		for k, matchers := range pair.Request.Query {
+			f.Query[k] = exactValue(matchers)
+		}
+		if pair.Response.EncodedBody {
+			decoded, err := base64.StdEncoding.DecodeString(f.Body)
+			if err != nil {
+				return nil, fmt.Errorf("pair %s %s: invalid encoded body: %v", f.Method, f.Path, err)
+			}
+			f.Body = string(decoded)
+		}
+		fixtures = append(fixtures, f)
+	}
+
+	pkg := opts.goPackage
+	if pkg == "" {
+		pkg = "fixtures"
+	}
+
+	var buf bytes.Buffer
+	err := goTestTemplate.Execute(&buf, struct {
+		Package  string
+		Fixtures []goFixture
+	}{pkg, fixtures})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+var goTestTemplate = template.Must(template.New("gotest").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`// Code generated by har-to-hoverfly; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// Fixture is a captured request/response exchange. Repeated query values
+// are joined with ";", as in the simulation's query matchers.
+type Fixture struct {
+	Method  string
+	Path    string
+	Query   map[string]string
+	Status  int
+	Headers map[string][]string
+	Body    string
+}
+
+// Fixtures lists every captured exchange in recording order.
+var Fixtures = []Fixture{
+{{- range .Fixtures}}
+	{
+		Method: {{quote .Method}},
+		Path:   {{quote .Path}},
+		Query:  map[string]string{ {{- range $k, $v := .Query}}{{quote $k}}: {{quote $v}}, {{end -}} },
+		Status: {{.Status}},
+		Headers: map[string][]string{
+		{{- range $k, $vs := .Headers}}
+			{{quote $k}}: { {{- range $vs}}{{quote .}}, {{end -}} },
+		{{- end}}
+		},
+		Body: {{quote .Body}},
+	},
+{{- end}}
+}
+
+// Handler serves the first fixture whose method, path and query match the
+// request, or 404 when none do.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, f := range Fixtures {
+			if !matches(f, r) {
+				continue
+			}
+			for k, vs := range f.Headers {
+				for _, v := range vs {
+					w.Header().Add(k, v)
+				}
+			}
+			w.WriteHeader(f.Status)
+			w.Write([]byte(f.Body))
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// NewServer starts an httptest.Server backed by Handler. Callers must Close it.
+func NewServer() *httptest.Server {
+	return httptest.NewServer(Handler())
+}
+
+func matches(f Fixture, r *http.Request) bool {
+	if f.Method != "" && f.Method != r.Method {
+		return false
+	}
+	if f.Path != r.URL.Path {
+		return false
+	}
+	query := r.URL.Query()
+	for k, v := range f.Query {
+		if strings.Join(query[k], ";") != v {
+			return false
+		}
+	}
+	return true
+}
+`))
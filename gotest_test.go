@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// goTestPair is a pair whose request matches method and path exactly.
+func goTestPair(method, path string, status int, body string) Pair {
+	return Pair{
+		Request: Request{
+			Method: []FieldMatcher{{Matcher: "exact", Value: method}},
+			Path:   []FieldMatcher{{Matcher: "exact", Value: path}},
+		},
+		Response: Response{Status: status, Body: body},
+	}
+}
+
+func TestRenderGoTest(t *testing.T) {
+	glob := goTestPair("GET", "", 200, "skipped")
+	glob.Request.Path = []FieldMatcher{{Matcher: "glob", Value: "/static/*"}}
+	encoded := goTestPair("GET", "/logo.png", 200, "aGVsbG8=")
+	encoded.Response.EncodedBody = true
+	queried := goTestPair("GET", "/search", 200, "[]")
+	queried.Request.Query = map[string][]FieldMatcher{"q": {{Matcher: "exact", Value: "shoes"}}}
+	queried.Response.Headers = Header{"Content-Type": {"application/json"}}
+	invalid := goTestPair("GET", "/broken", 200, "not base64!")
+	invalid.Response.EncodedBody = true
+	repeated := goTestPair("GET", "/tags", 200, "")
+	repeated.Request.Query = map[string][]FieldMatcher{"tag": {{Matcher: "exact", Value: "a;b"}}}
+
+	tests := []struct {
+		name    string
+		pairs   []Pair
+		pkg     string
+		want    []string
+		notWant []string
+		wantErr string
+	}{
+		{
+			name:  "default package",
+			pairs: []Pair{goTestPair("GET", "/users", 200, `{"id":1}`)},
+			want:  []string{"package fixtures ", `Path: "/users"`, `Body: "{\"id\":1}"`},
+		},
+		{
+			name:  "named package",
+			pairs: []Pair{goTestPair("POST", "/users", 201, "")},
+			pkg:   "apifake",
+			want:  []string{"package apifake ", `Method: "POST"`, "Status: 201"},
+		},
+		{
+			name:    "pairs without an exact path are skipped",
+			pairs:   []Pair{glob, goTestPair("GET", "/users", 200, "")},
+			want:    []string{`Path: "/users"`},
+			notWant: []string{"/static/", "skipped"},
+		},
+		{
+			name:  "encoded bodies are decoded",
+			pairs: []Pair{encoded},
+			want:  []string{`Body: "hello"`},
+		},
+		{
+			name:  "query and headers",
+			pairs: []Pair{queried},
+			want:  []string{`Query: map[string]string{"q": "shoes"}`, `"Content-Type": {"application/json"}`},
+		},
+		{
+			name:  "repeated query parameter",
+			pairs: []Pair{repeated},
+			want:  []string{`Query: map[string]string{"tag": "a;b"}`, `strings.Join(query[k], ";") != v`},
+		},
+		{
+			name:    "invalid encoded body",
+			pairs:   []Pair{invalid},
+			wantErr: "pair GET /broken: invalid encoded body",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sim Simulation
+			sim.Data.Pairs = tt.pairs
+			out, err := renderGoTest(sim, outputOptions{goPackage: tt.pkg})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// gofmt aligns the fixture fields, so compare with runs of
+			// spaces collapsed.
+			flat := strings.Join(strings.Fields(string(out)), " ")
+			for _, s := range tt.want {
+				if !strings.Contains(flat, s) {
+					t.Errorf("output lacks %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(flat, s) {
+					t.Errorf("output contains %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+// TestRenderGoTestCompiles builds the generated package in a module of its
+// own and runs a test against its server, so template changes that produce
+// code gofmt accepts but the compiler doesn't are caught.
+func TestRenderGoTestCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a module with the go tool")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	encoded := goTestPair("GET", "/logo.png", 200, "aGVsbG8=")
+	encoded.Response.EncodedBody = true
+	queried := goTestPair("GET", "/search", 200, `["shoes"]`)
+	queried.Request.Query = map[string][]FieldMatcher{"q": {{Matcher: "exact", Value: "shoes"}}}
+	queried.Response.Headers = Header{"Content-Type": {"application/json"}}
+	repeated := goTestPair("GET", "/tags", 200, "tagged")
+	repeated.Request.Query = map[string][]FieldMatcher{"tag": {{Matcher: "exact", Value: "a;b"}}}
+	var sim Simulation
+	sim.Data.Pairs = []Pair{queried, encoded, repeated, goTestPair("DELETE", "/users/1", 204, "")}
+	out, err := renderGoTest(sim, outputOptions{goPackage: "fixtures"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module example.com/fixtures\n\ngo 1.21\n",
+		"fixtures.go": string(out),
+		"fixtures_test.go": `package fixtures
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	for _, tt := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/search?q=shoes", 200, ` + "`" + `["shoes"]` + "`" + `},
+		{"GET", "/search?q=hats", 404, "404 page not found\n"},
+		{"GET", "/logo.png", 200, "hello"},
+		{"GET", "/tags?tag=a&tag=b", 200, "tagged"},
+		{"GET", "/tags?tag=a", 404, "404 page not found\n"},
+		{"DELETE", "/users/1", 204, ""},
+		{"GET", "/users/1", 404, "404 page not found\n"},
+	} {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || string(body) != tt.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"vet", "./..."}, {"test", "./..."}} {
+		cmd := exec.Command(goTool, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s\ngenerated source:\n%s", strings.Join(args, " "), err, out, files["fixtures.go"])
+		}
+	}
+}
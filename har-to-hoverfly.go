@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/url"
@@ -13,13 +15,54 @@ import (
 
 type HAR struct {
 	Log struct {
-		Entries []Entry `json:"entries"`
+		Version string   `json:"version,omitempty"`
+		Creator *Creator `json:"creator,omitempty"`
+		Pages   []Page   `json:"pages,omitempty"`
+		Entries []Entry  `json:"entries"`
 	} `json:"log"`
 }
 
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Page struct {
+	ID              string `json:"id"`
+	Title           string `json:"title"`
+	StartedDateTime string `json:"startedDateTime,omitempty"`
+	Comment         string `json:"comment,omitempty"`
+}
+
 type Entry struct {
-	Request  HarRequest  `json:"request"`
-	Response HarResponse `json:"response"`
+	Pageref         string      `json:"pageref,omitempty"`
+	StartedDateTime string      `json:"startedDateTime,omitempty"`
+	Time            float64     `json:"time"`
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+	Timings         *Timings    `json:"timings,omitempty"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Connection      string      `json:"connection,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+	Cache           *HarCache   `json:"cache,omitempty"`
+
+	// Chrome-specific extensions carrying the negotiated TLS parameters
+	// and what triggered the request.
+	SecurityDetails *SecurityDetails `json:"_securityDetails,omitempty"`
+	Initiator       *Initiator       `json:"_initiator,omitempty"`
+	WasPushed       json.RawMessage  `json:"_was_pushed,omitempty"`
+	FromCache       string           `json:"_fromCache,omitempty"`
+	ResourceType    string           `json:"_resourceType,omitempty"`
+
+	WebSocketMessages []WebSocketMessage `json:"_webSocketMessages,omitempty"`
+}
+
+type SecurityDetails struct {
+	Protocol    string `json:"protocol"`
+	Cipher      string `json:"cipher"`
+	KeyExchange string `json:"keyExchange,omitempty"`
+	SubjectName string `json:"subjectName,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`
 }
 
 type HarHeader struct {
@@ -27,24 +70,62 @@ type HarHeader struct {
 	Value string `json:"value"`
 }
 
+// HarCookie is a cookie as HAR records it next to the Cookie and
+// Set-Cookie headers.
+type HarCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	SameSite string `json:"sameSite,omitempty"`
+}
+
 type PostData struct {
-	MimeType string `json:"mimeType"`
-	Text     string `json:"text"`
+	MimeType string     `json:"mimeType"`
+	Text     string     `json:"text"`
+	Params   []HarParam `json:"params,omitempty"`
+}
+
+// HarParam is a posted form field; multipart file fields also carry the
+// uploaded file's name and type.
+type HarParam struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
 }
 
 type HarRequest struct {
-	Method   string      `json:"method"`
-	URL      string      `json:"url"`
-	Headers  []HarHeader `json:"headers"`
-	PostData PostData    `json:"postData,omitempty"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion,omitempty"`
+	Headers     []HarHeader `json:"headers"`
+	QueryString []HarHeader `json:"queryString,omitempty"`
+	Cookies     []HarCookie `json:"cookies,omitempty"`
+	PostData    *PostData   `json:"postData,omitempty"`
 }
 
 type HarResponse struct {
-	Status  int `json:"status"`
-	Content struct {
+	Status      int         `json:"status"`
+	HTTPVersion string      `json:"httpVersion,omitempty"`
+	Headers     []HarHeader `json:"headers,omitempty"`
+	Cookies     []HarCookie `json:"cookies,omitempty"`
+	Content     struct {
 		MimeType string `json:"mimeType"`
 		Text     string `json:"text"`
+		Encoding string `json:"encoding,omitempty"`
 	} `json:"content"`
+	RedirectURL string `json:"redirectURL,omitempty"`
+
+	// Trailers is a non-standard extension some recording proxies write.
+	Trailers []HarHeader `json:"_trailers,omitempty"`
+
+	// Error is the network error Chrome records for requests that failed
+	// or were cancelled, e.g. net::ERR_ABORTED.
+	Error string `json:"_error,omitempty"`
 }
 
 type FieldMatcher struct {
@@ -55,18 +136,33 @@ type FieldMatcher struct {
 type Header map[string][]string
 
 type Request struct {
-	Method      []FieldMatcher            `json:"method"`
-	Destination []FieldMatcher            `json:"destination"`
-	Path        []FieldMatcher            `json:"path"`
-	Body        []FieldMatcher            `json:"body,omitempty"`
-	Headers     map[string][]FieldMatcher `json:"headers,omitempty"`
-	Query       map[string][]FieldMatcher `json:"query,omitempty"`
+	Method        []FieldMatcher            `json:"method"`
+	Scheme        []FieldMatcher            `json:"scheme,omitempty"`
+	Destination   []FieldMatcher            `json:"destination"`
+	Path          []FieldMatcher            `json:"path"`
+	Body          []FieldMatcher            `json:"body,omitempty"`
+	Headers       map[string][]FieldMatcher `json:"headers,omitempty"`
+	Query         map[string][]FieldMatcher `json:"query,omitempty"`
+	RequiresState map[string]string         `json:"requiresState,omitempty"`
 }
 
 type Response struct {
-	Status  int    `json:"status"`
-	Body    string `json:"body,omitempty"`
-	Headers Header `json:"headers,omitempty"`
+	Status           int               `json:"status"`
+	Body             string            `json:"body,omitempty"`
+	EncodedBody      bool              `json:"encodedBody,omitempty"`
+	Headers          Header            `json:"headers,omitempty"`
+	Templated        bool              `json:"templated,omitempty"`
+	FixedDelay       int               `json:"fixedDelay,omitempty"`
+	LogNormalDelay   *LogNormalDelay   `json:"logNormalDelay,omitempty"`
+	TransitionsState map[string]string `json:"transitionsState,omitempty"`
+	RemovesState     []string          `json:"removesState,omitempty"`
+}
+
+type LogNormalDelay struct {
+	Min    int `json:"min"`
+	Max    int `json:"max"`
+	Mean   int `json:"mean"`
+	Median int `json:"median"`
 }
 
 type Pair struct {
@@ -76,7 +172,24 @@ type Pair struct {
 }
 
 type GlobalActions struct {
-	Delays []string `json:"delays"`
+	Delays          []GlobalDelay          `json:"delays"`
+	DelaysLogNormal []GlobalLogNormalDelay `json:"delaysLogNormal,omitempty"`
+}
+
+// GlobalDelay delays the responses to requests whose destination and path
+// match URLPattern, a regular expression, and HTTPMethod when set.
+type GlobalDelay struct {
+	URLPattern string `json:"urlPattern"`
+	HTTPMethod string `json:"httpMethod,omitempty"`
+	Delay      int    `json:"delay"`
+}
+
+// GlobalLogNormalDelay is a GlobalDelay whose delay is sampled from a
+// log-normal distribution, as a pair's logNormalDelay is.
+type GlobalLogNormalDelay struct {
+	URLPattern string `json:"urlPattern"`
+	HTTPMethod string `json:"httpMethod,omitempty"`
+	LogNormalDelay
 }
 
 type Simulation struct {
@@ -89,95 +202,664 @@ type Simulation struct {
 	} `json:"meta"`
 }
 
+// version is reported in exported HAR files; release builds override it
+// with -ldflags "-X main.version=...".
+var version = "dev"
+
+// commands maps subcommand names to their entry points. Anything else on the
+// command line is treated as flags for the default HAR conversion.
+var commands = map[string]func(args []string){
+	"push":   runPush,
+	"pull":   runPull,
+	"to-har": runToHAR,
+	"merge":  runMerge,
+	"diff":   runDiff,
+	"blame":  runBlame,
+
+	"explain": runExplain,
+	"watch":   runWatch,
+	"shadow":  runShadow,
+	"serve":   runServe,
+
+	"tls-report": runTLSReport,
+	"variance":   runVariance,
+	"stats":      runStats,
+
+	"set-status": runSetStatus,
+	"set-delay":  runSetDelay,
+	"relabel":    runRelabel,
+	"delete":     runDelete,
+	"prune":      runPrune,
+	"extract":    runExtract,
+	"compose":    runCompose,
+
+	"escape-templates": runEscapeTemplates,
+	"apply-patch":      runApplyPatch,
+}
+
 func main() {
-	inputFile := flag.String("input", "", "Path to HAR file")
-	outputFile := flag.String("output", "", "Path to output simulation JSON file (optional)")
-	sizeLimit := flag.Int("max-body-bytes", 0, "Optional maximum body size (in bytes). Larger responses will be replaced with an empty body.")
-	ignoreNonText := flag.Bool("ignore-non-text", false, "If set, non-textual content types will be excluded entirely from the simulation")
-	allowedTypes := flag.String("allowed-content-types", "json,xml,text/html,text/javascript", "Comma-separated list of MIME substrings considered text-based")
-	restrictHost := flag.String("host", "", "Restrict to entries for this destination host only")
-	summarise := flag.Bool("summarise", false, "Summarise request/response pairs grouped by host")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	runConvert(os.Args[1:])
+}
+
+func runConvert(args []string) {
+	flags := flag.NewFlagSet("har-to-hoverfly", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to HAR file")
+	outputFile := flags.String("output", "", "Path to output simulation JSON file (optional)")
+	format := flags.String("format", "", "Output format: "+outputFormatNames()+" (defaults to yaml for .yaml/.yml outputs, json otherwise)")
+	goPackage := flags.String("go-package", "fixtures", "Package name for --format=gotest output")
+	pactConsumer := flags.String("pact-consumer", "consumer", "Consumer name for --format=pact output")
+	pactProvider := flags.String("pact-provider", "", "Provider name for --format=pact output (defaults to the captured host)")
+	k8sName := flags.String("k8s-name", defaultK8sName, "ConfigMap name for --format=k8s-configmap output")
+	k8sNamespace := flags.String("k8s-namespace", "", "ConfigMap namespace for --format=k8s-configmap output")
+	hoverflyImage := flags.String("hoverfly-image", "spectolabs/hoverfly:latest", "Hoverfly image started by --format=testcontainers output")
+	entryOpts := addEntryFlags(flags)
+	summarise := flags.Bool("summarise", false, "Summarise request/response pairs grouped by host")
+	slo := flags.String("slo", "", "Comma-separated latency thresholds (pattern=ms, or ms for all endpoints); endpoints exceeding them are reported")
+	sloLabel := flags.Bool("slo-label", false, "Label pairs whose recorded latency breached --slo with slo-breach")
+	traceEntry := flags.Int("trace-entry", -1, "Print every conversion stage's decision for the HAR entry with this index (from 0) and the pair it became")
+	rejectsFile := flags.String("rejects", "", "Write every skipped entry to this HAR file, with its skip reason in _skipReason and _skipDetail")
+	sidecarFile := flags.String("har-sidecar", "", "Write the original HAR entries and log fields to this file so to-har can rebuild them losslessly")
+	page := flags.String("page", "", "Only convert entries of this HAR page: its ID (e.g. page_2) or a regex matched against page titles")
+	webSocketFrames := flags.String("websocket-frames", "", "Write the frames of the skipped WebSocket connections to this JSON file")
+	emitWeights := flags.Bool("emit-weights", false, "Label every pair weight:<share> with the share of the recorded entries it stands for, to reproduce the traffic mix under load")
+	notModified := flags.String("not-modified", "keep", "304 Not Modified responses: keep, backfill with the body and headers of a 200 for the same request, or 200 to serve them as 200s")
+	flattenRedirectsFlag := flags.Bool("flatten-redirects", false, "Answer each recorded redirect with the response that ended its chain instead of the 3xx")
+	weightedResponses := flags.Bool("weighted-responses", false, "Cycle endpoints that returned several distinct responses through them with Hoverfly state, in proportion to how often each was recorded")
+	weightedCycle := flags.Int("weighted-cycle", 20, "With --weighted-responses, the most slots an endpoint's cycle gets")
+	groupByResponse := flags.Bool("group-by-response", false, "Keep one pair per endpoint for each distinct status and response body, labelled occurrences:<n> with how many entries returned it")
+	logNormalDelays := flags.String("lognormal-delays", "", "Give pairs a logNormalDelay fitted to the recorded times of their destination: host, or path for host and path")
+	delayMultiplier := flags.Float64("delay-multiplier", 1, "Scale the delays taken from the HAR by this factor, e.g. 0.1 to replay ten times faster")
+	delayCap := flags.Int("delay-cap-ms", 0, "Cap the delays taken from the HAR at this many milliseconds, after --delay-multiplier (0: a minute)")
+	globalDelay := flags.Int("global-delay", 0, "Add a global delay of this many milliseconds to every response, or with --delay-host to those of matching hosts")
+	globalLogNormal := flags.Bool("global-lognormal-delay", false, "Add a global logNormal delay fitted to the recorded times of every entry, instead of giving each pair its own")
+	delayHosts := flags.String("delay-host", "", "With --global-delay, comma-separated host globs the delay applies to, e.g. *.example.com")
+	connectionLabels := flags.Bool("connection-labels", false, "Label pairs with serverIPAddress, connection ID/reuse and TLS details from the HAR")
+	dataURIMode := flags.String("data-uris", "keep", "Base64 data URIs inlined in HTML and CSS responses: keep, strip their payloads, or externalise them into pairs of their own")
+	sessionGap := flags.Duration("session-gap", 0, "Idle time between entries (e.g. 5m) that starts a new session")
+	sessionLabels := flags.Bool("session-labels", false, "With --session-gap, label pairs with session-N")
+	splitSessions := flags.Bool("split-sessions", false, "With --session-gap, write one simulation per session next to --output")
+	tree := flags.Bool("tree", false, "With --summarise, print the reconstructed request chains (initiator, Referer, page) as a tree")
+	chainLabels := flags.Bool("chain-labels", false, "Label pairs with chain-N, N being the entry that started their request chain")
+	splitChains := flags.Bool("split-chains", false, "Write one simulation per request chain next to --output")
+	splitHosts := flags.Bool("split-hosts", false, "Write one simulation per destination host next to --output")
+	splitPorts := flags.Bool("split-ports", false, "With --split-hosts, treat each host:port as a separate service")
+	annotate := flags.String("annotate", "", "Also print warnings as CI annotations keyed to HAR entries: github")
+	noCache := flags.Bool("no-cache", false, "Always convert, ignoring and not updating the conversion cache")
+	cacheDir := flags.String("cache-dir", "", "Directory for cached conversions (defaults to the user cache directory)")
+	methodDefaultsFile := flags.String("method-defaults", "", "JSON/YAML rules overriding or synthesising responses per method, e.g. OPTIONS -> 204 with CORS, HEAD mirroring GET")
+	openapiFile := flags.String("openapi", "", "OpenAPI 3 or Swagger 2 spec (JSON/YAML) used to match paths by their templates, drop undeclared query parameters and validate recorded bodies")
+	jsonSchemas := flags.String("json-schema", "", "Comma-separated pattern=file JSON Schemas (or a bare file for every endpoint) that successful JSON responses are validated against")
+	schemaViolations := flags.String("schema-violations", "warn", "What OpenAPI and --json-schema violations in recorded bodies do: warn, or fail before any output is written")
+	policyFile := flags.String("policy", "", "JSON/YAML policy rules every pair must pass; violations fail the run before any output is written")
+	strictHAR := flags.Bool("strict-har", false, "Fail instead of skipping HAR entries that can't be parsed or converting what precedes a cut-off HAR")
+	strictURLs := flags.Bool("strict-urls", false, "Fail instead of repairing malformed request URLs or skipping entries whose URL can't be repaired")
+	indexFile := flags.String("index", "", "Also write an index of endpoints to pair IDs and byte offsets in --output (JSON output only)")
+	pprofCPU := flags.String("pprof-cpu", "", "Write a CPU profile of the conversion to this file")
+	pprofMem := flags.String("pprof-mem", "", "Write a heap profile taken after the conversion to this file")
+	flags.Parse(args)
+	stopProfiles = startProfiling(*pprofCPU, *pprofMem)
+	defer stopProfiles()
 
-	allowedContentTypes := strings.Split(*allowedTypes, ",")
+	if *format == "" {
+		*format = "json"
+		if isYAMLPath(*outputFile) {
+			*format = "yaml"
+		}
+	}
+	render, ok := outputFormats[*format]
+	if !ok {
+		fatalf("Unknown --format %q: expected one of %s", *format, outputFormatNames())
+	}
 
 	if *inputFile == "" {
-		log.Fatal("You must provide a HAR file with --input")
+		fatal("You must provide a HAR file with --input")
 	}
 
+	delaysTaken := entryOpts.delaysFromHAR || entryOpts.ttfbDelay || *logNormalDelays != "" || *globalLogNormal
+	delayHint := "only applies to delays taken from the HAR; add --delays-from-har, --ttfb-delay, --lognormal-delays or --global-lognormal-delay"
+	summarised := func(name string) optionRule {
+		return optionRule{name, !*summarise, "can't be combined with --summarise, which prints a summary instead of writing a simulation"}
+	}
+	checkOptions(givenFlags(flags), append(entryOpts.rules(), []optionRule{
+		summarised("output"),
+		summarised("format"),
+		summarised("index"),
+		summarised("split-sessions"),
+		summarised("split-chains"),
+		summarised("split-hosts"),
+		summarised("method-defaults"),
+		summarised("policy"),
+		{"tree", *summarise, "only applies with --summarise"},
+		{"weighted-cycle", *weightedResponses, "only applies with --weighted-responses"},
+		{"delay-multiplier", delaysTaken, delayHint},
+		{"delay-cap-ms", delaysTaken, delayHint},
+		{"session-gap", *sessionLabels || *splitSessions, "only applies with --session-labels or --split-sessions"},
+		{"schema-violations", *openapiFile != "" || *jsonSchemas != "", "only applies with --openapi or --json-schema"},
+		{"go-package", *format == "gotest" || *format == "testcontainers", "only applies with --format=gotest or testcontainers"},
+		{"pact-consumer", *format == "pact", "only applies with --format=pact"},
+		{"pact-provider", *format == "pact", "only applies with --format=pact"},
+		{"k8s-name", *format == "k8s-configmap", "only applies with --format=k8s-configmap"},
+		{"k8s-namespace", *format == "k8s-configmap", "only applies with --format=k8s-configmap"},
+		{"hoverfly-image", *format == "testcontainers", "only applies with --format=testcontainers"},
+		{"cache-dir", !*noCache, "can't be combined with --no-cache"},
+	}...))
+
 	data, err := ioutil.ReadFile(*inputFile)
 	if err != nil {
-		log.Fatalf("Failed to read file: %v", err)
+		fatalf("Failed to read file: %v", err)
 	}
 
-	var har HAR
-	err = json.Unmarshal(data, &har)
+	// Only runs whose sole result is the rendered output are cached; side
+	// files would otherwise be skipped on a hit, and a profile of a cache
+	// hit would be useless. Runs that print warnings or reports aren't
+	// stored, so a hit never hides them.
+	var stderr io.Writer = os.Stderr
+	var cache *conversionCache
+	var cacheKey string
+	var reports *reportWatcher
+	if !*noCache && !*summarise && *sidecarFile == "" && *rejectsFile == "" && *webSocketFrames == "" && *traceEntry < 0 && !*splitSessions && !*splitChains && !*splitHosts &&
+		*slo == "" && !entryOpts.stripSigs && *annotate == "" && *pprofCPU == "" && *pprofMem == "" && *indexFile == "" {
+		build, err := buildHash()
+		if err == nil {
+			cache, err = newConversionCache(*cacheDir)
+		}
+		if err != nil {
+			cache = nil
+			log.Printf("Conversion cache disabled: %v", err)
+		} else if cacheKey, err = conversionKey(build, data, flags, append([]string{entryOpts.templateConfig, *policyFile, *methodDefaultsFile, *openapiFile}, schemaRuleFiles(*jsonSchemas)...)...); err != nil {
+			fatalf("Failed to read config: %v", err)
+		} else if output, ok := cache.get(cacheKey); ok {
+			if err := writeOutput(*outputFile, output); err != nil {
+				fatalf("Failed to write output file: %v", err)
+			}
+			return
+		} else {
+			reports = &reportWatcher{w: os.Stderr}
+			stderr = reports
+			log.SetOutput(reports)
+		}
+	}
+
+	annotations, err := newAnnotator(*annotate, *inputFile, *outputFile, data)
+	if err != nil {
+		fatal(err)
+	}
+
+	// Response bodies are decoded per entry once the filters below have
+	// decided they are needed.
+	har, rawBodies, parseProblems, err := decodeHARLazily(data)
+	if err != nil {
+		annotations.parseError(data, err)
+		annotations.write(stderr)
+		fatalf("Failed to parse HAR: %v", err)
+	}
+	for _, e := range parseProblems.skipped {
+		annotations.entry("error", e.index, "Failed to parse HAR: %v; entry skipped", e.err)
+	}
+	if parseProblems.truncated != nil {
+		annotations.parseError(data, parseProblems.truncated)
+	}
+	if *strictHAR && (len(parseProblems.skipped) > 0 || parseProblems.truncated != nil) {
+		annotations.write(stderr)
+		if parseProblems.truncated != nil {
+			fatalf("Failed to parse HAR: %v", parseProblems.truncated)
+		}
+		fatalf("Failed to parse HAR: %v", parseProblems.skipped[0])
+	}
+	unparsed := parseProblems.skippedEntries()
+	compat := applyHARShims(&har)
+
+	sloRules, err := parseSLORules(*slo)
+	if err != nil {
+		fatal(err)
+	}
+	if *sloLabel && len(sloRules) == 0 {
+		fatal("--slo-label requires --slo thresholds")
+	}
+	entryOpts.parse()
+
+	if !containsString(notModifiedModes, *notModified) {
+		fatalf("Unknown --not-modified %q: expected one of %s", *notModified, strings.Join(notModifiedModes, ", "))
+	}
+	if *weightedCycle < 1 {
+		fatalf("Invalid --weighted-cycle %d: must be at least 1", *weightedCycle)
+	}
+	if *delayMultiplier <= 0 {
+		fatalf("Invalid --delay-multiplier %g: must be above 0", *delayMultiplier)
+	}
+	if *globalDelay < 0 {
+		fatalf("Invalid --global-delay %d: must be 0 or more", *globalDelay)
+	}
+	if *delayHosts != "" && *globalDelay == 0 {
+		fatal("--delay-host needs --global-delay")
+	}
+	if *globalLogNormal && (*globalDelay > 0 || *logNormalDelays != "" || entryOpts.delaysFromHAR || entryOpts.ttfbDelay) {
+		fatal("--global-lognormal-delay can't be combined with --global-delay, or with --lognormal-delays, --delays-from-har or --ttfb-delay, whose per-pair delays would take precedence over it")
+	}
+	if *delayCap < 0 {
+		fatalf("Invalid --delay-cap-ms %d: must be 0 or more", *delayCap)
+	}
+	if *logNormalDelays != "" && !containsString(logNormalScopes, *logNormalDelays) {
+		fatalf("Unknown --lognormal-delays %q: expected one of %s", *logNormalDelays, strings.Join(logNormalScopes, ", "))
+	}
+	if *logNormalDelays != "" && (entryOpts.delaysFromHAR || entryOpts.ttfbDelay) {
+		fatal("--lognormal-delays can't be combined with --delays-from-har or --ttfb-delay, which set fixed delays instead")
+	}
+	if !containsString(dataURIModes, *dataURIMode) {
+		fatalf("Unknown --data-uris %q: expected one of %s", *dataURIMode, strings.Join(dataURIModes, ", "))
+	}
+	if entryOpts.byteExact && *dataURIMode != "keep" {
+		fatal("--byte-exact can't be combined with --data-uris, which changes bodies")
+	}
+	if (*sessionLabels || *splitSessions) && *sessionGap <= 0 {
+		fatal("--session-labels and --split-sessions require --session-gap")
+	}
+	if *indexFile != "" && (*outputFile == "" || *format != "json" || *splitSessions || *splitChains || *splitHosts) {
+		fatal("--index needs a single --output file in json format")
+	}
+	if *splitSessions && *outputFile == "" {
+		fatal("--split-sessions requires --output to name the session files")
+	}
+	if *splitChains && *outputFile == "" {
+		fatal("--split-chains requires --output to name the chain files")
+	}
+	if *splitHosts && *outputFile == "" {
+		fatal("--split-hosts requires --output to name the host files")
+	}
+	if *splitPorts && !*splitHosts {
+		fatal("--split-ports requires --split-hosts")
+	}
+	if countTrue(*splitSessions, *splitChains, *splitHosts) > 1 {
+		fatal("--split-sessions, --split-chains and --split-hosts are mutually exclusive")
+	}
+
+	var methodDefaults []methodDefault
+	if *methodDefaultsFile != "" {
+		if methodDefaults, err = readMethodDefaults(*methodDefaultsFile); err != nil {
+			fatalf("Failed to read method defaults: %v", err)
+		}
+	}
+
+	var policy []policyRule
+	if *policyFile != "" {
+		if policy, err = readPolicy(*policyFile); err != nil {
+			fatalf("Failed to read policy: %v", err)
+		}
+	}
+
+	var refiner *openapiRefiner
+	if *openapiFile != "" {
+		spec, err := readOpenAPI(*openapiFile)
+		if err != nil {
+			fatalf("Failed to read OpenAPI spec: %v", err)
+		}
+		refiner = newOpenAPIRefiner(spec)
+	}
+	if *schemaViolations != "warn" && *schemaViolations != "fail" {
+		fatalf("Unknown --schema-violations %q: expected warn or fail", *schemaViolations)
+	}
+	schemaRules, err := parseSchemaRules(*jsonSchemas)
 	if err != nil {
-		log.Fatalf("Failed to parse HAR: %v", err)
+		fatalf("Failed to read JSON Schema: %v", err)
+	}
+	schemaLevel := "warning"
+	if *schemaViolations == "fail" {
+		schemaLevel = "error"
+	}
+
+	var report *sloReport
+	if len(sloRules) > 0 {
+		report = newSLOReport(sloRules)
 	}
 
 	sim := Simulation{}
 	sim.Meta.SchemaVersion = "v5.3"
-	sim.Data.GlobalActions = GlobalActions{Delays: []string{}}
+	sim.Data.GlobalActions = GlobalActions{Delays: []GlobalDelay{}}
 
-	table := make(map[string]map[string]map[string]bool)
+	var sidecar *harSidecar
+	var rawEntries []json.RawMessage
+	if *sidecarFile != "" {
+		sidecar = &harSidecar{Entries: []sidecarEntry{}}
+		sidecar.Log, rawEntries, _, err = splitHAR(data)
+		if err != nil {
+			fatalf("Failed to parse HAR: %v", err)
+		}
+	}
 
-	for _, entry := range har.Log.Entries {
-		req := entry.Request
-		res := entry.Response
-		reqURL := parseURL(req.URL)
+	var rejects *rejectedEntries
+	if *rejectsFile != "" {
+		rejects = &rejectedEntries{raws: rawBodies}
+		if rejects.fields, _, _, err = splitHAR(data); err != nil {
+			fatalf("Failed to parse HAR: %v", err)
+		}
+	}
 
-		if *restrictHost != "" {
-			if !strings.Contains(req.URL, *restrictHost) {
-				continue
+	trace, err := newEntryTracer(*traceEntry, len(har.Log.Entries))
+	if err != nil {
+		fatalf("Invalid --trace-entry: %v", err)
+	}
+	conv := newEntryConverter(entryOpts, *inputFile)
+	conv.annotations, conv.trace, conv.rejects = annotations, trace, rejects
+	conv.bodies, conv.entries = rawBodies, har.Log.Entries
+	conv.setPages(har.Log.Pages)
+	conv.classifyBodies = *summarise
+	conv.refiner, conv.schemaRules, conv.schemaLevel = refiner, schemaRules, schemaLevel
+	inlined := dataURIs{mode: *dataURIMode}
+	conv.inlined = &inlined
+
+	if *page != "" {
+		if conv.pages, err = selectPages(har.Log.Pages, *page); err != nil {
+			fatalf("Invalid --page: %v", err)
+		}
+	}
+
+	var sessions []int
+	var pairParts []string
+	if *sessionGap > 0 {
+		sessions = sessionIndexes(har.Log.Entries, *sessionGap)
+	}
+
+	var parents, roots []int
+	if *tree || *chainLabels || *splitChains {
+		parents = requestParents(har.Log.Entries)
+		roots = chainRoots(parents)
+	}
+	treeEntries := map[int]bool{}
+	if *sessionLabels || *chainLabels {
+		conv.captureLabels = func(i int) []string {
+			var labels []string
+			if *sessionLabels {
+				labels = append(labels, sessionName(sessions[i]))
+			}
+			if *chainLabels {
+				labels = append(labels, chainName(roots[i]))
 			}
+			return labels
 		}
+	}
+	if *connectionLabels {
+		conv.connections = map[string]bool{}
+	}
+
+	table := make(map[string]map[string]map[string]entryClass)
+	var responseGroups responseGroups
+	latencies := newLatencySamples(*logNormalDelays)
+	var captureTimes []int
+	var unresolvedRedirects []string
+	if *flattenRedirectsFlag {
+		conv.redirectFinals, unresolvedRedirects = flattenRedirects(har.Log.Entries)
+	}
+	var notModifiedOrphans []string
+	conv.notModified = *notModified
+	if *notModified == "backfill" {
+		conv.notModifiedFrom, notModifiedOrphans = notModifiedSources(har.Log.Entries)
+	}
 
-		isText := isTextContent(res.Content.MimeType, allowedContentTypes)
-		if *ignoreNonText && !isText {
+	for i, entry := range har.Log.Entries {
+		if err, ok := unparsed[i]; ok {
+			conv.skip(i, "unparsable", err.Error())
+			continue
+		}
+		prepared, ok := conv.prepare(i, entry)
+		if !ok {
 			continue
 		}
+		req, reqURL := prepared.entry.Request, prepared.url
 
 		if *summarise {
+			treeEntries[i] = true
 			host := reqURL.Host
 			if _, ok := table[host]; !ok {
-				table[host] = make(map[string]map[string]bool)
+				table[host] = make(map[string]map[string]entryClass)
 			}
 			if _, ok := table[host][reqURL.Path]; !ok {
-				table[host][reqURL.Path] = make(map[string]bool)
+				table[host][reqURL.Path] = make(map[string]entryClass)
 			}
-			table[host][reqURL.Path][req.Method] = true
+			table[host][reqURL.Path][req.Method] = prepared.class
+			trace.step(i, "summarised rather than converted")
 			continue
 		}
 
-		pair := convertEntryToPair(entry, *sizeLimit, allowedContentTypes)
+		if *groupByResponse {
+			if group, seen := responseGroups.add(i, len(sim.Data.Pairs), req.Method, reqURL.Host, reqURL.Path, prepared.entry.Response); seen {
+				conv.skip(i, "group-by-response", fmt.Sprintf("same response as entry %d", group.entry))
+				continue
+			}
+		}
+		pair := conv.build(i, prepared, len(sim.Data.Pairs))
+		if *splitSessions {
+			pairParts = append(pairParts, sessionName(sessions[i]))
+		}
+		if *splitChains {
+			pairParts = append(pairParts, chainName(roots[i]))
+		}
+		if *splitHosts {
+			pairParts = append(pairParts, serviceName(reqURL.Host, *splitPorts))
+		}
+		entry := prepared.entry
+		if report != nil && report.record(req.Method, reqURL.Host, reqURL.Path, entry.Time) {
+			annotations.entry("warning", i, "%s %s took %.0fms, over its SLO threshold", req.Method, req.URL, entry.Time)
+			if *sloLabel {
+				pair.Labels = append(pair.Labels, "slo-breach")
+			}
+		}
+		if sidecar != nil {
+			sidecar.Entries = append(sidecar.Entries, sidecarEntry{Pair: len(sim.Data.Pairs), Key: sidecarKey(pair), Entry: rawEntries[i]})
+		}
+		latencies.add(len(sim.Data.Pairs), pair, entry)
+		if d := recordedDelay(entry); *globalLogNormal && d >= 0 {
+			captureTimes = append(captureTimes, d)
+		}
+		trace.stage(i, "labels and delays", pair)
+		trace.converted(i, len(sim.Data.Pairs))
 		sim.Data.Pairs = append(sim.Data.Pairs, pair)
 	}
 
+	writeLogNormalReport(latencies.apply(sim.Data.Pairs))
+	scaling := delayScaling{multiplier: *delayMultiplier, cap: *delayCap}
+	if n := scaling.apply(sim.Data.Pairs); n > 0 {
+		log.Printf("Scaled the delays of %d pair(s) by %g, capped at %dms", n, *delayMultiplier, scaling.limit())
+	}
+	for _, asset := range inlined.order {
+		if len(pairParts) > 0 {
+			pairParts = append(pairParts, pairParts[asset.pair])
+		}
+	}
+	sim.Data.Pairs = append(sim.Data.Pairs, inlined.pairs()...)
+	if *globalDelay > 0 {
+		sim.Data.GlobalActions.Delays = globalDelays(*globalDelay, *delayHosts)
+	}
+	if *globalLogNormal {
+		sim.Data.GlobalActions.DelaysLogNormal = globalLogNormalDelays(captureTimes, scaling)
+	}
+	if *groupByResponse {
+		responseGroups.label(sim.Data.Pairs)
+		responseGroups.write()
+	}
+	if *emitWeights {
+		addWeightLabels(sim.Data.Pairs, responseGroups.observed())
+	}
+	if *weightedResponses {
+		pairs, sources, moved, rewritten := weightResponses(sim.Data.Pairs, responseGroups.observed(), *weightedCycle)
+		sim.Data.Pairs = pairs
+		if len(pairParts) > 0 {
+			parts := make([]string, len(sources))
+			for k, src := range sources {
+				parts[k] = pairParts[src]
+			}
+			pairParts = parts
+		}
+		if sidecar != nil {
+			for k, e := range sidecar.Entries {
+				sidecar.Entries[k].Pair = moved[e.Pair]
+			}
+		}
+		trace.renumber(moved)
+		writeWeightedReport(rewritten)
+	}
+	if err := rejects.write(*rejectsFile); err != nil {
+		fatalf("Failed to write rejects: %v", err)
+	}
+	parseProblems.write(len(har.Log.Entries))
+	compat.write()
+	if conv.untyped > 0 {
+		log.Printf("%d entr(ies) have no _resourceType, so --resource-type kept them", conv.untyped)
+	}
+	writeCachedReport(conv.skippedCached)
+	writeAbortedReport(conv.abortedEntries, entryOpts.aborted)
+	if err := conv.sockets.write(*webSocketFrames); err != nil {
+		fatalf("Failed to write WebSocket frames: %v", err)
+	}
+	if conv.resolvedURLs > 0 {
+		log.Printf("Resolved %d relative request URL(s) against their page or --base-url", conv.resolvedURLs)
+	}
+	writeURLReport(conv.repairedURLs, conv.invalidURLs)
+	writeRedirectReport(conv.flattenedRedirects, unresolvedRedirects)
+	writeNotModifiedReport(*notModified, conv.notModifiedConverted, notModifiedOrphans)
+	writeDecodeReport(conv.decoded, conv.undecoded)
+	writeCharsetReport(conv.transcoded, conv.untranscoded)
+	inlined.write()
+	conv.slimmed.write()
+	conv.sniffed.write()
+	if conv.downgraded > 0 || len(conv.pushed) > 0 {
+		writeDowngradeReport(conv.downgraded, conv.droppedHeaders, conv.pushed)
+	}
+	if *strictURLs && len(conv.repairedURLs)+len(conv.invalidURLs) > 0 {
+		fatal("--strict-urls: malformed request URLs found; no output written")
+	}
+	if report != nil {
+		report.write(stderr)
+	}
+	writeSignatureReport(stderr, conv.relaxed)
+	writeCookieReport(conv.strippedCookies, conv.sessionPairs)
+	writeVaryReport(conv.varied)
+	writeTracingReport(conv.strippedTracing, conv.echoedTracing)
+	writeBracketReport(conv.unorderedParams, conv.orderedParams)
+	if conv.strippedEncoding.accept > 0 || conv.strippedEncoding.content > 0 {
+		log.Printf("Dropped Accept-Encoding matchers from %d pair(s) and Content-Encoding from %d response(s), since Hoverfly serves bodies decoded; --encoding-headers keep retains them",
+			conv.strippedEncoding.accept, conv.strippedEncoding.content)
+	}
+	if refiner != nil {
+		refined, kept := refiner.applyPaths(sim.Data.Pairs)
+		refiner.writeReport(refined, kept)
+		if sidecar != nil {
+			// Refined paths are no longer exact, so rekey their entries.
+			for k, e := range sidecar.Entries {
+				sidecar.Entries[k].Key = sidecarKey(sim.Data.Pairs[e.Pair])
+			}
+		}
+	}
+	if len(conv.violations) > 0 {
+		log.Printf("%d schema violation(s) in recorded bodies; the capture may be corrupt or the service may disagree with its schema:\n  %s",
+			len(conv.violations), strings.Join(conv.violations, "\n  "))
+	}
+	writeTrailerReport(stderr, conv.trailerPairs, entryOpts.trailers == "headers")
+	annotations.write(stderr)
+	if len(conv.violations) > 0 && *schemaViolations == "fail" {
+		fatal("--schema-violations=fail: recorded bodies violate their schema; no output written")
+	}
+	if len(conv.inexact) > 0 {
+		fatalf("--byte-exact: %d response body(ies) can't be reproduced byte-for-byte; no output written:\n  %s",
+			len(conv.inexact), strings.Join(conv.inexact, "\n  "))
+	}
+	if len(conv.templateSyntax) > 0 {
+		log.Printf("%d untemplated response(s) contain {{ }}; run escape-templates on them before enabling templating:\n  %s",
+			len(conv.templateSyntax), strings.Join(conv.templateSyntax, "\n  "))
+	}
+
+	if sidecar != nil {
+		sidecarData, err := json.MarshalIndent(sidecar, "", "  ")
+		if err != nil {
+			fatalf("Failed to serialize sidecar: %v", err)
+		}
+		if err := os.WriteFile(*sidecarFile, sidecarData, 0644); err != nil {
+			fatalf("Failed to write sidecar: %v", err)
+		}
+	}
+
 	if *summarise {
-		fmt.Printf("%-30s %-10s %-50s %-50s\n", "HOST", "METHOD", "PATH", "QUERY")
+		trace.write(stderr, nil)
+	}
+	if *summarise && *tree {
+		writeRequestTree(os.Stdout, har.Log.Entries, parents, treeEntries)
+		return
+	}
+	if *summarise {
+		fmt.Printf("%-30s %-10s %-50s %-50s %s\n", "HOST", "METHOD", "PATH", "QUERY", "CLASS")
 		for host, paths := range table {
 			for path, methods := range paths {
-				for method := range methods {
-					fmt.Printf("%-30s %-10s %-50s %-50s\n", host, method, truncate(path, 50), "")
+				for method, class := range methods {
+					fmt.Printf("%-30s %-10s %-50s %-50s %s\n", host, method, truncate(path, 50), "", class)
 				}
 			}
 		}
 		return
 	}
 
-	output, err := json.MarshalIndent(sim, "", "  ")
+	if len(methodDefaults) > 0 {
+		pairs, sources, overridden := applyMethodDefaults(sim.Data.Pairs, methodDefaults)
+		sim.Data.Pairs = pairs
+		if len(pairParts) > 0 {
+			for _, src := range sources {
+				pairParts = append(pairParts, pairParts[src])
+			}
+		}
+		log.Printf("Method defaults overrode %d pair(s) and added %d", overridden, len(sources))
+	}
+
+	trace.write(stderr, sim.Data.Pairs)
+
+	if policy != nil {
+		if violations := checkPolicy(sim.Data.Pairs, policy); len(violations) > 0 {
+			writePolicyReport(stderr, violations)
+			fatal("Policy check failed; no output written")
+		}
+	}
+
+	opts := outputOptions{
+		goPackage:     *goPackage,
+		pactConsumer:  *pactConsumer,
+		pactProvider:  *pactProvider,
+		k8sName:       *k8sName,
+		k8sNamespace:  *k8sNamespace,
+		hoverflyImage: *hoverflyImage,
+	}
+
+	if *splitSessions || *splitChains || *splitHosts {
+		if err := writeSplit(sim, pairParts, *outputFile, render, opts); err != nil {
+			fatalf("Failed to write split output: %v", err)
+		}
+		return
+	}
+
+	output, err := render(sim, opts)
 	if err != nil {
-		log.Fatalf("Failed to serialize simulation: %v", err)
+		fatalf("Failed to render %s output: %v", *format, err)
+	}
+	if cache != nil && !reports.written {
+		if err := cache.put(cacheKey, output); err != nil {
+			log.Printf("Failed to update conversion cache: %v", err)
+		}
 	}
 
-	if *outputFile != "" {
-		err = os.WriteFile(*outputFile, output, 0644)
+	if err := writeOutput(*outputFile, output); err != nil {
+		fatalf("Failed to write output file: %v", err)
+	}
+
+	if *indexFile != "" {
+		idx, err := buildIndex(sim, output, *outputFile)
 		if err != nil {
-			log.Fatalf("Failed to write output file: %v", err)
+			fatalf("Failed to build index: %v", err)
+		}
+		if err := writeIndex(idx, *indexFile); err != nil {
+			fatalf("Failed to write index: %v", err)
 		}
-	} else {
-		fmt.Println(string(output))
 	}
 }
 
@@ -191,21 +873,27 @@ func isTextContent(mimeType string, allowed []string) bool {
 	return false
 }
 
-func parseURL(raw string) *url.URL {
-	u, err := url.Parse(raw)
+// readHAR loads and parses a HAR file for the commands that analyse
+// captures without converting them.
+func readHAR(path string) (HAR, error) {
+	var har HAR
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return &url.URL{}
+		return har, err
 	}
-	return u
+	if err := json.Unmarshal(data, &har); err != nil {
+		return har, fmt.Errorf("%s: %v", path, err)
+	}
+	return har, nil
 }
 
-func convertEntryToPair(entry Entry, sizeLimit int, allowedContentTypes []string) Pair {
+func convertEntryToPair(entry Entry, sizeLimit int, allowedContentTypes []string, bodyMatching string) Pair {
 	req := entry.Request
 	res := entry.Response
 
-	body := res.Content.Text
+	body, encoded := responseBody(res)
 	if sizeLimit > 0 && len(body) > sizeLimit {
-		body = ""
+		body, encoded = "", false
 	}
 
 	reqURL := parseURL(req.URL)
@@ -213,28 +901,15 @@ func convertEntryToPair(entry Entry, sizeLimit int, allowedContentTypes []string
 	// Build request headers
 	headers := map[string][]FieldMatcher{}
 	for _, h := range req.Headers {
+		if h.Name == "" {
+			continue
+		}
 		headers[h.Name] = []FieldMatcher{{Matcher: "exact", Value: h.Value}}
 	}
 
-	// Build query parameters
-	queryParams := map[string][]FieldMatcher{}
-	if reqURL.RawQuery != "" {
-		for _, kv := range strings.Split(reqURL.RawQuery, "&") {
-			parts := strings.SplitN(kv, "=", 2)
-			if len(parts) == 2 {
-				k, v := parts[0], parts[1]
-				queryParams[k] = []FieldMatcher{{Matcher: "exact", Value: v}}
-			}
-		}
-	}
+	queryParams := queryMatchers(req, reqURL)
 
-	// Request body matcher (only if text and allowed content-type)
-	var reqBody []FieldMatcher
-	if req.PostData.MimeType != "" && isTextContent(req.PostData.MimeType, allowedContentTypes) {
-		if req.PostData.Text != "" {
-			reqBody = []FieldMatcher{{Matcher: "exact", Value: req.PostData.Text}}
-		}
-	}
+	reqBody := bodyMatchers(req, allowedContentTypes, bodyMatching)
 
 	request := Request{
 		Method:      []FieldMatcher{{Matcher: "exact", Value: req.Method}},
@@ -246,9 +921,10 @@ func convertEntryToPair(entry Entry, sizeLimit int, allowedContentTypes []string
 	}
 
 	response := Response{
-		Status:  res.Status,
-		Body:    body,
-		Headers: Header{"Content-Type": []string{res.Content.MimeType}},
+		Status:      res.Status,
+		Body:        body,
+		EncodedBody: encoded,
+		Headers:     Header{"Content-Type": []string{res.Content.MimeType}},
 	}
 
 	return Pair{
@@ -258,6 +934,96 @@ func convertEntryToPair(entry Entry, sizeLimit int, allowedContentTypes []string
 	}
 }
 
+// responseBody returns the recorded response body and whether it is base64
+// for Hoverfly's encodedBody. HAR marks binary payloads such as images,
+// PDFs and protobuf with encoding "base64"; the base64 text is kept as is
+// unless it doesn't decode, in which case it is served as recorded.
+func responseBody(res HarResponse) (string, bool) {
+	text := res.Content.Text
+	if res.Content.Encoding != "base64" || text == "" {
+		return text, false
+	}
+	if _, err := base64.StdEncoding.DecodeString(text); err != nil {
+		return text, false
+	}
+	return text, true
+}
+
+// bodyMatchingModes are the accepted values of --body-matching.
+var bodyMatchingModes = []string{"exact", "lenient", "none"}
+
+// bodyMatchers builds the request body matcher from the HAR postData, for
+// text bodies of an allowed content type. Form and multipart bodies are
+// matched field by field, from their params when only those were recorded.
+// In lenient mode JSON bodies are matched with the json matcher, which
+// ignores key order and whitespace.
+func bodyMatchers(req HarRequest, allowedContentTypes []string, mode string) []FieldMatcher {
+	if mode == "none" || req.PostData == nil {
+		return nil
+	}
+	mimeType := req.PostData.MimeType
+	if mimeType == "" {
+		for _, h := range req.Headers {
+			if strings.EqualFold(h.Name, "Content-Type") {
+				mimeType = h.Value
+			}
+		}
+	}
+	if mimeType == "" && req.PostData.Text == "" && len(req.PostData.Params) > 0 {
+		mimeType = "application/x-www-form-urlencoded"
+	}
+	if isMultipart(mimeType) {
+		return multipartMatchers(*req.PostData, mimeType)
+	}
+	if isFormEncoded(mimeType) {
+		return formMatchers(*req.PostData)
+	}
+	text := req.PostData.Text
+	if text == "" || mimeType == "" || !isTextContent(mimeType, allowedContentTypes) {
+		return nil
+	}
+	if mode == "lenient" && strings.Contains(strings.ToLower(mimeType), "json") && json.Valid([]byte(text)) {
+		return []FieldMatcher{{Matcher: "json", Value: text}}
+	}
+	return []FieldMatcher{{Matcher: "exact", Value: text}}
+}
+
+// queryMatchers builds exact query matchers from the request URL, or from
+// the HAR queryString when a recorder left the query out of the URL. Like
+// Hoverfly, values are compared decoded, and repeated parameters as their
+// values joined with ";".
+func queryMatchers(req HarRequest, u *url.URL) map[string][]FieldMatcher {
+	values := url.Values{}
+	if u.RawQuery != "" {
+		for _, kv := range strings.Split(u.RawQuery, "&") {
+			k, v, _ := strings.Cut(kv, "=")
+			k, kerr := url.QueryUnescape(k)
+			v, verr := url.QueryUnescape(v)
+			if k == "" || kerr != nil || verr != nil {
+				continue
+			}
+			values.Add(k, v)
+		}
+	} else {
+		for _, q := range req.QueryString {
+			k, kerr := url.QueryUnescape(q.Name)
+			v, verr := url.QueryUnescape(q.Value)
+			if kerr != nil || verr != nil {
+				k, v = q.Name, q.Value
+			}
+			if k != "" {
+				values.Add(k, v)
+			}
+		}
+	}
+
+	query := map[string][]FieldMatcher{}
+	for k, vs := range values {
+		query[k] = []FieldMatcher{{Matcher: "exact", Value: strings.Join(vs, ";")}}
+	}
+	return query
+}
+
 func truncate(s string, max int) string {
 	if len(s) > max {
 		return s[:max-3] + "..."
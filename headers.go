@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// headerSelection decides which recorded request headers become header
+// matchers: all of them, none, or only the listed names.
+type headerSelection struct {
+	all   bool
+	names map[string]bool
+}
+
+func parseHeaderSelection(value string) headerSelection {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "all":
+		return headerSelection{all: true}
+	case "none":
+		return headerSelection{}
+	}
+	return headerSelection{names: headerNameSet(value)}
+}
+
+// selects reports whether matchers for the header name are kept.
+func (s headerSelection) selects(name string) bool {
+	return s.all || s.names[textproto.CanonicalMIMEHeaderKey(name)]
+}
+
+// apply removes the header matchers of p that aren't selected. Requests
+// that differ only in a dropped header then map to the same pair.
+func (s headerSelection) apply(p *Pair) {
+	if s.all {
+		return
+	}
+	for name := range p.Request.Headers {
+		if !s.names[textproto.CanonicalMIMEHeaderKey(name)] {
+			delete(p.Request.Headers, name)
+		}
+	}
+}
+
+// defaultSkippedResponseHeaders are recorded response headers that would be
+// wrong when replayed: Hoverfly sets the length and framing itself, and
+// bodies are stored decoded.
+const defaultSkippedResponseHeaders = "Content-Length,Content-Encoding,Transfer-Encoding,Connection,Keep-Alive,Trailer,Date"
+
+// copyResponseHeaders replaces the response headers of p with every header
+// recorded in the HAR except those in skip. Names are canonicalised so
+// HTTP/2 recordings' lower-case names don't duplicate Content-Type.
+func copyResponseHeaders(p *Pair, recorded []HarHeader, skip map[string]bool) {
+	headers := Header{}
+	for _, h := range recorded {
+		name := textproto.CanonicalMIMEHeaderKey(h.Name)
+		if strings.HasPrefix(h.Name, ":") || skip[name] {
+			continue
+		}
+		headers[name] = append(headers[name], h.Value)
+	}
+	if _, ok := headers["Content-Type"]; !ok {
+		if ct, ok := p.Response.Headers["Content-Type"]; ok {
+			headers["Content-Type"] = ct
+		}
+	}
+	p.Response.Headers = headers
+}
+
+// headerNameSet parses a comma-separated list of header names.
+func headerNameSet(value string) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range splitList(value) {
+		names[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	return names
+}
+
+// promoteVaryHeaders adds exact matchers for the request headers the
+// response's Vary header names, when the header selection left them out:
+// the server chose this response because of them, so without them other
+// variants recorded for the endpoint would collide with it. Accept-Encoding
+// is left out because bodies are stored decoded, and Cookie because
+// --cookie-matchers decides how cookies are matched. It returns the
+// headers it added.
+func promoteVaryHeaders(p *Pair, req HarRequest, res HarResponse) []string {
+	var promoted []string
+	for _, h := range res.Headers {
+		if !strings.EqualFold(h.Name, "Vary") {
+			continue
+		}
+		for _, name := range splitList(h.Value) {
+			name = textproto.CanonicalMIMEHeaderKey(name)
+			if name == "*" || name == "Accept-Encoding" || name == "Cookie" || hasHeaderMatcher(p, name) {
+				continue
+			}
+			var values []string
+			for _, rh := range req.Headers {
+				if strings.EqualFold(rh.Name, name) {
+					values = append(values, rh.Value)
+				}
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if p.Request.Headers == nil {
+				p.Request.Headers = map[string][]FieldMatcher{}
+			}
+			// Hoverfly joins repeated headers with ";".
+			p.Request.Headers[name] = []FieldMatcher{{Matcher: "exact", Value: strings.Join(values, ";")}}
+			promoted = append(promoted, name)
+		}
+	}
+	return promoted
+}
+
+func hasHeaderMatcher(p *Pair, name string) bool {
+	for n := range p.Request.Headers {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeVaryReport logs which request headers were promoted into matchers
+// because responses varied on them, and for how many pairs.
+func writeVaryReport(varied map[string]int) {
+	if len(varied) == 0 {
+		return
+	}
+	names := make([]string, 0, len(varied))
+	for name, n := range varied {
+		names = append(names, fmt.Sprintf("%s (%d)", name, n))
+	}
+	sort.Strings(names)
+	log.Printf("Matched request headers that responses Vary on, though --header-matchers left them out: %s", strings.Join(names, ", "))
+}
+
+// encodingHeaderModes are the accepted values of --encoding-headers.
+var encodingHeaderModes = []string{"strip", "keep"}
+
+// stripEncodingHeaders drops the Accept-Encoding matchers and the
+// Content-Encoding response header of p. Hoverfly serves bodies as stored,
+// which is decoded, so a recorded Content-Encoding makes clients decode
+// them again, and matching Accept-Encoding only ties the pair to the
+// recording client. It reports what was dropped.
+func stripEncodingHeaders(p *Pair) (accept, content bool) {
+	for name := range p.Request.Headers {
+		if strings.EqualFold(name, "Accept-Encoding") {
+			delete(p.Request.Headers, name)
+			accept = true
+		}
+	}
+	for name := range p.Response.Headers {
+		if strings.EqualFold(name, "Content-Encoding") {
+			delete(p.Response.Headers, name)
+			content = true
+		}
+	}
+	return accept, content
+}
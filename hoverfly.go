@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// hoverflyOptions holds the connection flags shared by every command that
+// talks to a Hoverfly admin API.
+type hoverflyOptions struct {
+	url        string
+	token      string
+	username   string
+	password   string
+	caCert     string
+	clientCert string
+	clientKey  string
+	proxy      string
+}
+
+func addHoverflyFlags(flags *flag.FlagSet) *hoverflyOptions {
+	o := &hoverflyOptions{}
+	flags.StringVar(&o.url, "hoverfly-url", "http://localhost:8888", "Base URL of the Hoverfly admin API")
+	flags.StringVar(&o.token, "hoverfly-token", os.Getenv("HOVERFLY_TOKEN"), "Bearer token for the Hoverfly admin API (defaults to $HOVERFLY_TOKEN)")
+	flags.StringVar(&o.username, "hoverfly-username", "", "Username for basic auth against the Hoverfly admin API")
+	flags.StringVar(&o.password, "hoverfly-password", os.Getenv("HOVERFLY_PASSWORD"), "Password for basic auth (defaults to $HOVERFLY_PASSWORD)")
+	flags.StringVar(&o.caCert, "hoverfly-ca-cert", "", "PEM bundle of CA certificates used to verify the Hoverfly admin API")
+	flags.StringVar(&o.clientCert, "hoverfly-client-cert", "", "PEM client certificate for mTLS")
+	flags.StringVar(&o.clientKey, "hoverfly-client-key", "", "PEM client key for mTLS")
+	flags.StringVar(&o.proxy, "hoverfly-proxy", "", "Proxy URL for reaching the admin API (defaults to $HTTPS_PROXY/$HTTP_PROXY)")
+	return o
+}
+
+// hoverflyClient talks to the Hoverfly admin API.
+type hoverflyClient struct {
+	baseURL  string
+	token    string
+	username string
+	password string
+	http     *http.Client
+}
+
+func newHoverflyClient(o *hoverflyOptions) (*hoverflyClient, error) {
+	if o.token != "" && o.username != "" {
+		return nil, fmt.Errorf("--hoverfly-token and --hoverfly-username are mutually exclusive")
+	}
+	if (o.clientCert == "") != (o.clientKey == "") {
+		return nil, fmt.Errorf("--hoverfly-client-cert and --hoverfly-client-key must be used together")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.proxy != "" {
+		proxyURL, err := url.Parse(o.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --hoverfly-proxy: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{}
+	if o.caCert != "" {
+		pem, err := os.ReadFile(o.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.clientCert, o.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &hoverflyClient{
+		baseURL:  strings.TrimRight(o.url, "/"),
+		token:    o.token,
+		username: o.username,
+		password: o.password,
+		http:     &http.Client{Timeout: 60 * time.Second, Transport: transport},
+	}, nil
+}
+
+// version returns the version string reported by the Hoverfly instance.
+func (c *hoverflyClient) version() (string, error) {
+	body, err := c.do(http.MethodGet, "/api/v2/hoverfly/version", nil)
+	if err != nil {
+		return "", err
+	}
+	var v struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", fmt.Errorf("unexpected version response: %v", err)
+	}
+	return v.Version, nil
+}
+
+// getSimulation downloads the simulation currently loaded in Hoverfly.
+func (c *hoverflyClient) getSimulation() ([]byte, error) {
+	return c.do(http.MethodGet, "/api/v2/simulation", nil)
+}
+
+// putSimulation replaces the simulation loaded in Hoverfly. The response
+// body is returned so callers can inspect any warnings Hoverfly reports.
+func (c *hoverflyClient) putSimulation(sim []byte) ([]byte, error) {
+	return c.do(http.MethodPut, "/api/v2/simulation", sim)
+}
+
+// postSimulation appends the pairs in sim to the simulation loaded in
+// Hoverfly rather than replacing it.
+func (c *hoverflyClient) postSimulation(sim []byte) ([]byte, error) {
+	return c.do(http.MethodPost, "/api/v2/simulation", sim)
+}
+
+func (c *hoverflyClient) do(method, path string, payload []byte) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s returned %d: %s", method, path, res.StatusCode, hoverflyError(body))
+	}
+	return body, nil
+}
+
+// hoverflyError extracts the error message from a Hoverfly error response,
+// falling back to the raw body when it isn't the usual {"error": "..."} shape.
+func hoverflyError(body []byte) string {
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		return e.Error
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// hoverflyWarnings returns any warnings Hoverfly attached to a simulation
+// import response.
+func hoverflyWarnings(body []byte) []string {
+	var r struct {
+		Warnings []struct {
+			Message string `json:"message"`
+		} `json:"warnings"`
+	}
+	if json.Unmarshal(body, &r) != nil {
+		return nil
+	}
+	var warnings []string
+	for _, w := range r.Warnings {
+		warnings = append(warnings, w.Message)
+	}
+	return warnings
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Internationalised hosts are recorded as Unicode by some tools and as
+// punycode (xn--) by others. Hosts are normalised to one form so the same
+// site always yields the same destination matcher.
+
+const acePrefix = "xn--"
+
+// idnForms are the accepted values of --idn.
+var idnForms = []string{"punycode", "unicode", "keep"}
+
+// normaliseHost lower-cases host (which may carry a :port) and converts it
+// to form, punycode or unicode; keep returns it as recorded. Labels that
+// can't be converted are left alone.
+func normaliseHost(host, form string) string {
+	if form == "keep" {
+		return host
+	}
+	host = strings.ToLower(host)
+	name, port := host, ""
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		name, port = host[:i], host[i:]
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		switch form {
+		case "punycode":
+			if !isASCII(label) {
+				labels[i] = acePrefix + punycodeEncode(label)
+			}
+		case "unicode":
+			if strings.HasPrefix(label, acePrefix) {
+				if decoded, err := punycodeDecode(label[len(acePrefix):]); err == nil {
+					labels[i] = decoded
+				}
+			}
+		}
+	}
+	return strings.Join(labels, ".") + port
+}
+
+// normaliseEntryHost applies normaliseHost to the request URL and Host
+// header of entry, reporting whether either changed.
+func normaliseEntryHost(entry *Entry, u *url.URL, form string) bool {
+	changed := false
+	if host := normaliseHost(u.Host, form); host != u.Host {
+		u.Host = host
+		entry.Request.URL = u.String()
+		changed = true
+	}
+	for i, h := range entry.Request.Headers {
+		if !strings.EqualFold(h.Name, "Host") && h.Name != ":authority" {
+			continue
+		}
+		if host := normaliseHost(h.Value, form); host != h.Value {
+			// Copy so the parsed HAR keeps the recorded headers.
+			entry.Request.Headers = append([]HarHeader{}, entry.Request.Headers...)
+			entry.Request.Headers[i].Value = host
+			changed = true
+		}
+	}
+	return changed
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Bootstring parameters for punycode, RFC 3492 section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+// punycodeEncode encodes one label, without the xn-- prefix.
+func punycodeEncode(label string) string {
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for handled < len(runes) {
+		m := int(utf8.MaxRune)
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+// punycodeDecode decodes one label, without the xn-- prefix.
+func punycodeDecode(encoded string) (string, error) {
+	var output []rune
+	rest := encoded
+	if i := strings.LastIndex(encoded, "-"); i >= 0 {
+		for _, r := range encoded[:i] {
+			if r >= utf8.RuneSelf {
+				return "", fmt.Errorf("invalid punycode %q", encoded)
+			}
+			output = append(output, r)
+		}
+		rest = encoded[i+1:]
+	}
+
+	n, i, bias := punyInitialN, 0, punyInitialBias
+	for pos := 0; pos < len(rest); {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(rest) {
+				return "", fmt.Errorf("invalid punycode %q", encoded)
+			}
+			c := rest[pos]
+			pos++
+			var digit int
+			switch {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", fmt.Errorf("invalid punycode %q", encoded)
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if w > utf8.MaxRune {
+				return "", fmt.Errorf("invalid punycode %q", encoded)
+			}
+		}
+		bias = punyAdapt(i-oldi, len(output)+1, oldi == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > utf8.MaxRune {
+			return "", fmt.Errorf("invalid punycode %q", encoded)
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return string(output), nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// simulationIndex maps endpoints to the pairs of a simulation file and
+// where each pair's JSON sits in it, so tools can read only the pairs they
+// need from very large simulations.
+type simulationIndex struct {
+	// Simulation is the simulation file, relative to the index file.
+	Simulation string           `json:"simulation"`
+	Pairs      []indexedPair    `json:"pairs"`
+	Endpoints  map[string][]int `json:"endpoints"`
+	Hosts      map[string][]int `json:"hosts"`
+}
+
+// indexedPair locates one pair: Offset and Length are byte positions of
+// its JSON object within the simulation file.
+type indexedPair struct {
+	ID     int    `json:"id"`
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// endpointKey is the "METHOD host/path" form used by the index.
+func endpointKey(method, host, path string) string {
+	return strings.ToUpper(method) + " " + host + path
+}
+
+// buildIndex indexes the JSON simulation output written to path.
+func buildIndex(sim Simulation, output []byte, path string) (simulationIndex, error) {
+	offsets, err := pairOffsets(output)
+	if err != nil {
+		return simulationIndex{}, err
+	}
+	if len(offsets) != len(sim.Data.Pairs) {
+		return simulationIndex{}, fmt.Errorf("found %d pairs in output, expected %d", len(offsets), len(sim.Data.Pairs))
+	}
+	idx := simulationIndex{Simulation: path, Endpoints: map[string][]int{}, Hosts: map[string][]int{}}
+	for i, p := range sim.Data.Pairs {
+		ip := indexedPair{
+			ID:     i,
+			Method: exactValue(p.Request.Method),
+			Host:   exactValue(p.Request.Destination),
+			Path:   exactValue(p.Request.Path),
+			Offset: offsets[i][0],
+			Length: offsets[i][1] - offsets[i][0],
+		}
+		idx.Pairs = append(idx.Pairs, ip)
+		key := endpointKey(ip.Method, ip.Host, ip.Path)
+		idx.Endpoints[key] = append(idx.Endpoints[key], i)
+		idx.Hosts[ip.Host] = append(idx.Hosts[ip.Host], i)
+	}
+	return idx, nil
+}
+
+// pairOffsets returns the start and end byte offsets of each element of
+// data.pairs in a JSON simulation.
+func pairOffsets(data []byte) ([][2]int64, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if !enterObjectKey(dec, "data") || !enterObjectKey(dec, "pairs") {
+		return nil, fmt.Errorf("no data.pairs in simulation")
+	}
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, fmt.Errorf("data.pairs is not an array")
+	}
+	var offsets [][2]int64
+	for dec.More() {
+		start := dec.InputOffset()
+		for start < int64(len(data)) && strings.IndexByte(" \t\r\n,", data[start]) >= 0 {
+			start++
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, [2]int64{start, dec.InputOffset()})
+	}
+	return offsets, nil
+}
+
+// writeIndex writes idx to path, recording the simulation path relative
+// to the index so both files can be moved together.
+func writeIndex(idx simulationIndex, path string) error {
+	if abs, err := filepath.Abs(idx.Simulation); err == nil {
+		if dir, err := filepath.Abs(filepath.Dir(path)); err == nil {
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				idx.Simulation = rel
+			}
+		}
+	}
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// readIndex reads an index written by writeIndex, resolving the simulation
+// path against the index's directory.
+func readIndex(path string) (simulationIndex, error) {
+	var idx simulationIndex
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return idx, err
+	}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return idx, fmt.Errorf("%s: %v", path, err)
+	}
+	if !filepath.IsAbs(idx.Simulation) {
+		idx.Simulation = filepath.Join(filepath.Dir(path), idx.Simulation)
+	}
+	return idx, nil
+}
+
+// readIndexedPairs reads just the given pairs from the simulation file the
+// index describes.
+func readIndexedPairs(idx simulationIndex, ids []int) ([]Pair, error) {
+	f, err := os.Open(idx.Simulation)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pairs := make([]Pair, 0, len(ids))
+	for _, id := range ids {
+		if id < 0 || id >= len(idx.Pairs) {
+			return nil, fmt.Errorf("pair %d is not in the index", id)
+		}
+		ip := idx.Pairs[id]
+		buf := make([]byte, ip.Length)
+		if _, err := f.ReadAt(buf, ip.Offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		var p Pair
+		if err := json.Unmarshal(buf, &p); err != nil {
+			return nil, fmt.Errorf("pair %d: index is stale for %s: %v", id, idx.Simulation, err)
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonChange is one structural difference between two JSON values. Path is
+// an RFC 6901 pointer into the old document; Display is the readable form
+// shown in trees, naming keyed array elements as [id=3].
+type jsonChange struct {
+	Op      string
+	Path    string
+	Display string
+	Old     interface{}
+	Value   interface{}
+
+	// elementRemoval marks removal of an array element, which shifts the
+	// indexes of later elements.
+	elementRemoval bool
+}
+
+// MarshalJSON keeps old and value only for the operations they apply to,
+// so a value of null, false or 0 isn't mistaken for an absent one.
+func (c jsonChange) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{"op": c.Op, "path": c.Path, "display": c.Display}
+	if c.Op != "add" {
+		out["old"] = c.Old
+	}
+	if c.Op != "remove" {
+		out["value"] = c.Value
+	}
+	return json.Marshal(out)
+}
+
+// defaultArrayKeys are the fields used to match array elements across
+// versions when every element is an object carrying one of them.
+var defaultArrayKeys = []string{"id", "key", "name"}
+
+// diffJSON compares two decoded JSON values. Changes are ordered so that,
+// applied in sequence as a JSON Patch, they turn old into new: array
+// element removals come last, in descending index order.
+func diffJSON(old, new interface{}, arrayKeys []string) []jsonChange {
+	var changes, removals []jsonChange
+	walkJSONDiff(old, new, "", "", arrayKeys, &changes)
+	kept := changes[:0]
+	for _, c := range changes {
+		if c.elementRemoval {
+			removals = append(removals, c)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	for i := len(removals) - 1; i >= 0; i-- {
+		kept = append(kept, removals[i])
+	}
+	return kept
+}
+
+func walkJSONDiff(old, new interface{}, ptr, display string, keys []string, out *[]jsonChange) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		names := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			names = append(names, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			p, d := ptr+"/"+escapePointer(k), k
+			if display != "" {
+				d = display + "." + k
+			}
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			switch {
+			case !inNew:
+				*out = append(*out, jsonChange{Op: "remove", Path: p, Display: d, Old: ov})
+			case !inOld:
+				*out = append(*out, jsonChange{Op: "add", Path: p, Display: d, Value: nv})
+			default:
+				walkJSONDiff(ov, nv, p, d, keys, out)
+			}
+		}
+		return
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		if key := commonArrayKey(o, n, keys); key != "" {
+			diffKeyedArray(o, n, key, ptr, display, keys, out)
+			return
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			p, d := ptr+"/"+strconv.Itoa(i), fmt.Sprintf("%s[%d]", display, i)
+			switch {
+			case i >= len(n):
+				*out = append(*out, jsonChange{Op: "remove", Path: p, Display: d, Old: o[i], elementRemoval: true})
+			case i >= len(o):
+				*out = append(*out, jsonChange{Op: "add", Path: ptr + "/-", Display: d, Value: n[i]})
+			default:
+				walkJSONDiff(o[i], n[i], p, d, keys, out)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(old, new) {
+		*out = append(*out, jsonChange{Op: "replace", Path: ptr, Display: display, Old: old, Value: new})
+	}
+}
+
+// diffKeyedArray matches elements by the value of key, so reordering or
+// inserting elements doesn't report every later element as changed.
+func diffKeyedArray(o, n []interface{}, key, ptr, display string, keys []string, out *[]jsonChange) {
+	newByKey := map[string]interface{}{}
+	for _, v := range n {
+		newByKey[fmt.Sprint(v.(map[string]interface{})[key])] = v
+	}
+	seen := map[string]bool{}
+	for i, v := range o {
+		id := fmt.Sprint(v.(map[string]interface{})[key])
+		p, d := ptr+"/"+strconv.Itoa(i), fmt.Sprintf("%s[%s=%s]", display, key, id)
+		seen[id] = true
+		if nv, ok := newByKey[id]; ok {
+			walkJSONDiff(v, nv, p, d, keys, out)
+		} else {
+			*out = append(*out, jsonChange{Op: "remove", Path: p, Display: d, Old: v, elementRemoval: true})
+		}
+	}
+	for _, v := range n {
+		id := fmt.Sprint(v.(map[string]interface{})[key])
+		if !seen[id] {
+			*out = append(*out, jsonChange{Op: "add", Path: ptr + "/-", Display: fmt.Sprintf("%s[%s=%s]", display, key, id), Value: v})
+		}
+	}
+}
+
+// commonArrayKey returns the first of keys present, with unique values, in
+// every element of both arrays, or "" if the arrays should be compared by
+// position.
+func commonArrayKey(a, b []interface{}, keys []string) string {
+	if len(a) == 0 || len(b) == 0 {
+		return ""
+	}
+next:
+	for _, key := range keys {
+		for _, arr := range [][]interface{}{a, b} {
+			seen := map[string]bool{}
+			for _, v := range arr {
+				obj, ok := v.(map[string]interface{})
+				if !ok {
+					return ""
+				}
+				id, ok := obj[key]
+				if !ok || seen[fmt.Sprint(id)] {
+					continue next
+				}
+				seen[fmt.Sprint(id)] = true
+			}
+		}
+		return key
+	}
+	return ""
+}
+
+// escapePointer escapes a key for use in an RFC 6901 JSON Pointer.
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultK8sName is the ConfigMap name used when --k8s-name is not given.
+const defaultK8sName = "hoverfly-simulation"
+
+type k8sConfigMap struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type k8sMetadata struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+}
+
+// renderK8sConfigMap wraps the simulation JSON in a ConfigMap under the key
+// simulation.json, ready to mount into a Hoverfly pod and import with
+// -import /path/simulation.json.
+func renderK8sConfigMap(sim Simulation, opts outputOptions) ([]byte, error) {
+	data, err := marshalSimulation(sim, false)
+	if err != nil {
+		return nil, err
+	}
+	name := opts.k8sName
+	if name == "" {
+		name = defaultK8sName
+	}
+	cm := k8sConfigMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata: k8sMetadata{
+			Name:      name,
+			Namespace: opts.k8sNamespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "hoverfly",
+				"app.kubernetes.io/component":  "simulation",
+				"app.kubernetes.io/managed-by": "har-to-hoverfly",
+			},
+		},
+		Data: map[string]string{"simulation.json": string(data)},
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cm); err != nil {
+		return nil, fmt.Errorf("failed to encode ConfigMap: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// k8sObjectName turns name into a valid ConfigMap name: lowercase letters,
+// digits, '-' and '.', starting and ending with a letter or digit and at
+// most 253 characters long.
+func k8sObjectName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return strings.Trim(name, "-.")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// karateEndpoint groups every recorded pair for one method/host/path.
+type karateEndpoint struct {
+	method, scheme, host, path string
+	params                     []string
+	pairs                      []Pair
+}
+
+// renderKarate emits a Karate feature with one Scenario Outline per unique
+// endpoint. Query parameters become Examples columns alongside the expected
+// status, and JSON responses are asserted against a schema inferred from the
+// first recorded body.
+func renderKarate(sim Simulation, _ outputOptions) ([]byte, error) {
+	var order []string
+	endpoints := map[string]*karateEndpoint{}
+	for _, pair := range sim.Data.Pairs {
+		r := pair.Request
+		key := exactValue(r.Method) + " " + exactValue(r.Destination) + exactValue(r.Path)
+		ep, ok := endpoints[key]
+		if !ok {
+			ep = &karateEndpoint{
+				method: exactValue(r.Method),
+				scheme: exactValue(r.Scheme),
+				host:   exactValue(r.Destination),
+				path:   exactValue(r.Path),
+			}
+			if ep.scheme == "" {
+				ep.scheme = "https"
+			}
+			endpoints[key] = ep
+			order = append(order, key)
+		}
+		for name := range r.Query {
+			if !containsString(ep.params, name) {
+				ep.params = append(ep.params, name)
+			}
+		}
+		ep.pairs = append(ep.pairs, pair)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("Feature: Recorded API behaviour\n")
+	for _, key := range order {
+		ep := endpoints[key]
+		sort.Strings(ep.params)
+
+		fmt.Fprintf(&buf, "\n  Scenario Outline: %s %s%s\n", ep.method, ep.host, ep.path)
+		fmt.Fprintf(&buf, "    Given url '%s://%s'\n", ep.scheme, ep.host)
+		fmt.Fprintf(&buf, "    And path '%s'\n", karateEscape(ep.path))
+		for _, p := range ep.params {
+			if strings.ContainsAny(p, "[]. -") {
+				// Names like filter[name] aren't valid identifiers for "param".
+				fmt.Fprintf(&buf, "    And params { '%s': '<%s>' }\n", karateEscape(p), p)
+			} else {
+				fmt.Fprintf(&buf, "    And param %s = '<%s>'\n", p, p)
+			}
+		}
+		if body := exactValue(ep.pairs[0].Request.Body); body != "" {
+			fmt.Fprintf(&buf, "    And request %s\n", karateLiteral(body))
+		}
+		fmt.Fprintf(&buf, "    When method %s\n", ep.method)
+		buf.WriteString("    Then status <status>\n")
+		if schema := inferBodySchema(ep.pairs[0].Response.Body); schema != nil {
+			fmt.Fprintf(&buf, "    And match response == %s\n", karateSchema(schema))
+		}
+
+		buf.WriteString("\n    Examples:\n")
+		columns := append(append([]string{}, ep.params...), "status")
+		fmt.Fprintf(&buf, "      | %s |\n", strings.Join(columns, " | "))
+		rows := map[string]bool{}
+		for _, pair := range ep.pairs {
+			var cells []string
+			for _, p := range ep.params {
+				cells = append(cells, strings.ReplaceAll(exactValue(pair.Request.Query[p]), "|", "\\|"))
+			}
+			cells = append(cells, fmt.Sprint(pair.Response.Status))
+			row := strings.Join(cells, " | ")
+			if rows[row] {
+				continue
+			}
+			rows[row] = true
+			fmt.Fprintf(&buf, "      | %s |\n", row)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// karateSchema renders a schema using Karate's fuzzy match markers.
+func karateSchema(s *jsonSchema) string {
+	switch s.Type {
+	case "object":
+		var fields []string
+		for _, name := range s.propertyNames() {
+			fields = append(fields, fmt.Sprintf("%q: %s", name, karateSchema(s.Properties[name])))
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	case "array":
+		if s.Items != nil && s.Items.Type != "object" && s.Items.Type != "array" {
+			return "'#[] " + karateMarker(s.Items.Type) + "'"
+		}
+		return "'#array'"
+	default:
+		return "'" + karateMarker(s.Type) + "'"
+	}
+}
+
+func karateMarker(schemaType string) string {
+	switch schemaType {
+	case "integer", "number":
+		return "#number"
+	case "null":
+		return "#null"
+	default:
+		return "#" + schemaType
+	}
+}
+
+func karateLiteral(body string) string {
+	if inferBodySchema(body) != nil {
+		return body
+	}
+	return "'" + karateEscape(body) + "'"
+}
+
+func karateEscape(s string) string {
+	return strings.ReplaceAll(s, "'", "\\'")
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entryWithoutBody decodes an entry without its response body text.
+// encoding/json skips JSON fields no struct field receives without
+// allocating, so large bodies are never unescaped or copied.
+type entryWithoutBody struct {
+	Entry
+	Response struct {
+		HarResponse
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Encoding string `json:"encoding,omitempty"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// entryParseError reports an entry that failed to decode.
+type entryParseError struct {
+	index int
+	err   error
+}
+
+func (e *entryParseError) Error() string {
+	return fmt.Sprintf("entry %d: %v", e.index, e.err)
+}
+
+// harProblems is what decodeHARLazily tolerated in a HAR: entries that
+// failed to decode, which are left zero and must be skipped, the error that
+// cut parsing short, and startedDateTime values that were rewritten or
+// cleared because they weren't RFC 3339.
+type harProblems struct {
+	skipped     []*entryParseError
+	truncated   error
+	rewritten   int
+	clearedDate []int
+}
+
+// skippedEntries maps the entries that failed to decode to their errors.
+func (p harProblems) skippedEntries() map[int]error {
+	skipped := map[int]error{}
+	for _, e := range p.skipped {
+		skipped[e.index] = e.err
+	}
+	return skipped
+}
+
+// write logs what parsing tolerated.
+func (p harProblems) write(entries int) {
+	if p.truncated != nil {
+		log.Printf("HAR is cut off or malformed after %d entr(ies) (%v); converting the entries read before that", entries, p.truncated)
+	}
+	if len(p.skipped) > 0 {
+		lines := make([]string, len(p.skipped))
+		for i, e := range p.skipped {
+			lines[i] = e.Error()
+		}
+		log.Printf("Skipped %d entr(ies) that failed to parse:\n  %s", len(p.skipped), strings.Join(lines, "\n  "))
+	}
+	if p.rewritten > 0 {
+		log.Printf("Rewrote %d startedDateTime value(s) recorded in other formats as RFC 3339", p.rewritten)
+	}
+	if len(p.clearedDate) > 0 {
+		indexes := make([]string, len(p.clearedDate))
+		for i, n := range p.clearedDate {
+			indexes[i] = strconv.Itoa(n)
+		}
+		log.Printf("Cleared %d startedDateTime value(s) that aren't dates, so timing features ignore them: entries %s", len(p.clearedDate), strings.Join(indexes, ", "))
+	}
+}
+
+// decodeHARLazily parses a HAR leaving every response body empty, and
+// returns the raw entries so loadResponseBody can decode the bodies that
+// will actually be used once filters have run. One bad entry doesn't fail
+// the HAR: it is reported in the returned problems instead.
+func decodeHARLazily(data []byte) (HAR, []json.RawMessage, harProblems, error) {
+	var har HAR
+	var problems harProblems
+	fields, raws, truncated, err := splitHAR(data)
+	if err != nil {
+		return har, nil, problems, err
+	}
+	problems.truncated = truncated
+	for name, v := range map[string]interface{}{"version": &har.Log.Version, "creator": &har.Log.Creator, "pages": &har.Log.Pages} {
+		if raw, ok := fields[name]; ok {
+			if err := json.Unmarshal(raw, v); err != nil {
+				return har, nil, problems, fmt.Errorf("log.%s: %v", name, err)
+			}
+		}
+	}
+
+	har.Log.Entries = make([]Entry, len(raws))
+	for i, raw := range raws {
+		var e entryWithoutBody
+		if err := json.Unmarshal(raw, &e); err != nil {
+			// Decode again into Entry so the error names the HAR types.
+			if fullErr := json.Unmarshal(raw, new(Entry)); fullErr != nil {
+				err = fullErr
+			}
+			problems.skipped = append(problems.skipped, &entryParseError{i, err})
+			continue
+		}
+		entry := e.Entry
+		entry.Response = e.Response.HarResponse
+		entry.Response.Content.MimeType = e.Response.Content.MimeType
+		entry.Response.Content.Encoding = e.Response.Content.Encoding
+		if date, ok := normaliseStartedDateTime(entry.StartedDateTime); !ok {
+			problems.clearedDate = append(problems.clearedDate, i)
+			entry.StartedDateTime = ""
+		} else if date != entry.StartedDateTime {
+			problems.rewritten++
+			entry.StartedDateTime = date
+		}
+		har.Log.Entries[i] = entry
+	}
+	return har, raws, problems, nil
+}
+
+// splitHAR returns a HAR's log-level fields and raw entries like
+// rawHAREntries, but salvages a HAR that isn't valid JSON, typically a
+// recording cut off mid-write: the fields and complete entries before the
+// error are returned, with the error as truncated. A HAR with no entries
+// to salvage is an error.
+func splitHAR(data []byte) (fields map[string]json.RawMessage, entries []json.RawMessage, truncated error, err error) {
+	fields, entries, err = rawHAREntries(data)
+	var syntax *json.SyntaxError
+	if err == nil || !errors.As(err, &syntax) {
+		return fields, entries, nil, err
+	}
+	if fields, entries = salvageHAR(data); len(entries) == 0 {
+		return nil, nil, nil, err
+	}
+	return fields, entries, err, nil
+}
+
+// salvageHAR reads a HAR token by token and keeps what it read before the
+// first syntax error. The entry being read at the error is dropped.
+func salvageHAR(data []byte) (map[string]json.RawMessage, []json.RawMessage) {
+	fields := map[string]json.RawMessage{}
+	var entries []json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	open := func(delim json.Delim) bool {
+		t, err := dec.Token()
+		return err == nil && t == delim
+	}
+	key := func() (string, bool) {
+		t, err := dec.Token()
+		name, ok := t.(string)
+		return name, err == nil && ok
+	}
+
+	if !open('{') {
+		return fields, nil
+	}
+	for dec.More() {
+		name, ok := key()
+		if !ok {
+			break
+		}
+		if name != "log" {
+			var skip json.RawMessage
+			if dec.Decode(&skip) != nil {
+				break
+			}
+			continue
+		}
+		if !open('{') {
+			break
+		}
+		for dec.More() {
+			if name, ok = key(); !ok {
+				break
+			}
+			if name != "entries" {
+				var v json.RawMessage
+				if dec.Decode(&v) != nil {
+					break
+				}
+				fields[name] = v
+				continue
+			}
+			if !open('[') {
+				break
+			}
+			for dec.More() {
+				var e json.RawMessage
+				if dec.Decode(&e) != nil {
+					break
+				}
+				entries = append(entries, e)
+			}
+			if !open(']') {
+				break
+			}
+		}
+		break
+	}
+	return fields, entries
+}
+
+// normaliseStartedDateTime returns a startedDateTime as RFC 3339, which
+// HAR requires but some exporters ignore: offsets without a colon, no zone
+// (taken as UTC), a space for the T, HTTP dates and epoch milliseconds are
+// converted. It reports false for values that aren't dates at all.
+func normaliseStartedDateTime(value string) (string, bool) {
+	if value == "" {
+		return "", true
+	}
+	if _, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return value, true
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), true
+	}
+	layouts := []string{
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05Z0700",
+		"2006-01-02 15:04:05",
+		time.RFC1123,
+		time.RFC1123Z,
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(time.RFC3339Nano), true
+		}
+	}
+	return "", false
+}
+
+// loadResponseBody fills in the response body text skipped by
+// decodeHARLazily.
+func loadResponseBody(raw json.RawMessage, entry *Entry) error {
+	var body struct {
+		Response struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return err
+	}
+	entry.Response.Content.Text = body.Response.Content.Text
+	return nil
+}
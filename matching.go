@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// matcherDocs describes each Hoverfly matcher in the terms Hoverfly itself
+// uses, for explain output.
+var matcherDocs = map[string]string{
+	"exact":       "the whole value must equal the matcher value, case-sensitively",
+	"glob":        "the whole value must match the pattern, where * matches any run of characters (case-sensitive)",
+	"regex":       "the value must contain a match for the Go regular expression; anchor it with ^...$ to match the whole value",
+	"json":        "the value must be JSON semantically equal to the matcher value (key order and whitespace ignored)",
+	"jsonpartial": "the value must be JSON containing every field of the matcher value; extra fields are allowed",
+	"jsonpath":    "the JSONPath expression must select at least one element of the JSON value",
+	"xml":         "the value must be XML equal to the matcher value",
+	"xpath":       "the XPath expression must select at least one node of the XML value",
+	"form":        "the form-encoded body must contain the listed fields, each checked with its own matchers",
+	"array":       "the comma-separated values must equal the matcher's set of values",
+}
+
+// fieldDocs explains how Hoverfly combines matchers for each request field.
+var fieldDocs = map[string]string{
+	"method":        "every matcher in the list must match the request method",
+	"scheme":        "every matcher in the list must match the request scheme (http/https)",
+	"destination":   "every matcher must match the request host, including any port",
+	"path":          "every matcher must match the request path, without the query string",
+	"body":          "every matcher must match the raw request body",
+	"headers":       "subset semantics: each listed header must be present and match; request headers not listed are ignored. Multiple values are joined with ';'",
+	"query":         "subset semantics: each listed parameter must be present and match; other parameters are ignored. Multiple values are joined with ';'",
+	"requiresState": "the pair only matches while Hoverfly's state holds exactly these key/value pairs",
+}
+
+// liveRequest is the request being matched against a simulation.
+type liveRequest struct {
+	Method  string
+	Scheme  string
+	Host    string
+	Path    string
+	Query   map[string][]string
+	Headers http.Header
+	Body    string
+}
+
+// fieldResult is the outcome of matching one request field.
+type fieldResult struct {
+	Field   string
+	Key     string
+	Matcher FieldMatcher
+	Actual  string
+	Matched bool
+	Reason  string
+}
+
+// matchPair evaluates every matcher of the pair against the request in the
+// order Hoverfly does, returning one result per matcher. state is the
+// current Hoverfly state and may be nil.
+func matchPair(p Pair, r liveRequest, state map[string]string) []fieldResult {
+	var results []fieldResult
+	check := func(field, key string, matchers []FieldMatcher, actual string, present bool) {
+		for _, m := range matchers {
+			res := fieldResult{Field: field, Key: key, Matcher: m, Actual: actual}
+			if !present {
+				res.Reason = "not present in the request"
+			} else {
+				res.Matched, res.Reason = matchValue(m, actual)
+			}
+			results = append(results, res)
+		}
+	}
+
+	check("method", "", p.Request.Method, r.Method, true)
+	check("scheme", "", p.Request.Scheme, r.Scheme, true)
+	check("destination", "", p.Request.Destination, r.Host, true)
+	check("path", "", p.Request.Path, r.Path, true)
+	for _, k := range sortedMatcherKeys(p.Request.Query) {
+		values, ok := r.Query[k]
+		check("query", k, p.Request.Query[k], strings.Join(values, ";"), ok)
+	}
+	for _, k := range sortedMatcherKeys(p.Request.Headers) {
+		values, ok := r.Headers[http.CanonicalHeaderKey(k)]
+		check("headers", k, p.Request.Headers[k], strings.Join(values, ";"), ok)
+	}
+	check("body", "", p.Request.Body, r.Body, true)
+
+	keys := make([]string, 0, len(p.Request.RequiresState))
+	for k := range p.Request.RequiresState {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		want := p.Request.RequiresState[k]
+		got, ok := state[k]
+		res := fieldResult{Field: "requiresState", Key: k, Matcher: FieldMatcher{Matcher: "exact", Value: want}, Actual: got, Matched: ok && got == want}
+		if !res.Matched {
+			res.Reason = fmt.Sprintf("state %q is %q", k, got)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// pairMatches reports whether every matcher of the pair matched.
+func pairMatches(results []fieldResult) bool {
+	for _, r := range results {
+		if !r.Matched {
+			return false
+		}
+	}
+	return true
+}
+
+// findPair returns the index of the first pair matching r, Hoverfly's
+// choice, or -1. On a miss it also returns the closest pair (-1 if there
+// are none) and how many of its total matchers agreed.
+func findPair(pairs []Pair, r liveRequest, state map[string]string) (match, closest, agreed, total int) {
+	closest, agreed = -1, -1
+	for i, p := range pairs {
+		results := matchPair(p, r, state)
+		if pairMatches(results) {
+			return i, -1, 0, 0
+		}
+		n := 0
+		for _, res := range results {
+			if res.Matched {
+				n++
+			}
+		}
+		if n > agreed {
+			closest, agreed, total = i, n, len(results)
+		}
+	}
+	return -1, closest, agreed, total
+}
+
+// matchValue applies a single Hoverfly matcher to a value.
+func matchValue(m FieldMatcher, actual string) (bool, string) {
+	switch strings.ToLower(m.Matcher) {
+	case "exact":
+		if actual == m.Value {
+			return true, ""
+		}
+		if strings.EqualFold(actual, m.Value) {
+			return false, "differs only in case; exact matching is case-sensitive"
+		}
+		return false, "values differ"
+	case "glob":
+		if globMatch(m.Value, actual) {
+			return true, ""
+		}
+		return false, "does not match the glob pattern"
+	case "regex":
+		re, err := regexp.Compile(m.Value)
+		if err != nil {
+			return false, "invalid regular expression: " + err.Error()
+		}
+		if re.MatchString(actual) {
+			return true, ""
+		}
+		return false, "no match for the regular expression"
+	case "json":
+		var want, got interface{}
+		if err := json.Unmarshal([]byte(m.Value), &want); err != nil {
+			return false, "matcher value is not valid JSON"
+		}
+		if err := json.Unmarshal([]byte(actual), &got); err != nil {
+			return false, "request value is not valid JSON"
+		}
+		if reflect.DeepEqual(want, got) {
+			return true, ""
+		}
+		return false, "JSON documents differ"
+	case "jsonpartial":
+		var want, got interface{}
+		if err := json.Unmarshal([]byte(m.Value), &want); err != nil {
+			return false, "matcher value is not valid JSON"
+		}
+		if err := json.Unmarshal([]byte(actual), &got); err != nil {
+			return false, "request value is not valid JSON"
+		}
+		if jsonContains(got, want) {
+			return true, ""
+		}
+		return false, "request JSON is missing fields or values of the matcher"
+	case "jsonpath":
+		var got interface{}
+		if err := json.Unmarshal([]byte(actual), &got); err != nil {
+			return false, "request value is not valid JSON"
+		}
+		found, err := jsonPathExists(m.Value, got)
+		if err != nil {
+			return false, err.Error()
+		}
+		if found {
+			return true, ""
+		}
+		return false, "JSONPath selected nothing"
+	default:
+		return false, fmt.Sprintf("%s matchers are not evaluated locally", m.Matcher)
+	}
+}
+
+// globMatch implements Hoverfly's glob matcher: * is the only wildcard.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	quoted := make([]string, len(parts))
+	for i, p := range parts {
+		quoted[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^(?s)" + strings.Join(quoted, ".*") + "$").MatchString(s)
+}
+
+// jsonContains reports whether got contains everything in want: objects
+// may have extra keys, and each element of a wanted array must match some
+// element of the actual array.
+func jsonContains(got, want interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !jsonContains(g[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, wv := range w {
+			found := false
+			for _, gv := range g {
+				if jsonContains(gv, wv) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(got, want)
+	}
+}
+
+// jsonPathExists evaluates the dotted/bracketed subset of JSONPath
+// ($.a.b[0]['c'], with * for any child) and reports whether it selects
+// anything. Filters and recursive descent are not supported.
+func jsonPathExists(expr string, doc interface{}) (bool, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return false, fmt.Errorf("JSONPath must start with $")
+	}
+	if strings.Contains(expr, "..") || strings.Contains(expr, "?(") {
+		return false, fmt.Errorf("JSONPath filters and recursive descent are not evaluated locally")
+	}
+	var steps []string
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			steps = append(steps, rest[1:end+1])
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return false, fmt.Errorf("unterminated [ in JSONPath")
+			}
+			steps = append(steps, strings.Trim(rest[1:end], `'"`))
+			rest = rest[end+1:]
+		default:
+			return false, fmt.Errorf("unexpected %q in JSONPath", rest[0])
+		}
+	}
+
+	nodes := []interface{}{doc}
+	for _, step := range steps {
+		var next []interface{}
+		for _, n := range nodes {
+			switch t := n.(type) {
+			case map[string]interface{}:
+				if step == "*" {
+					for _, v := range t {
+						next = append(next, v)
+					}
+				} else if v, ok := t[step]; ok {
+					next = append(next, v)
+				}
+			case []interface{}:
+				if step == "*" {
+					next = append(next, t...)
+				} else if i, err := strconv.Atoi(step); err == nil && i >= 0 && i < len(t) {
+					next = append(next, t[i])
+				}
+			}
+		}
+		nodes = next
+	}
+	return len(nodes) > 0, nil
+}
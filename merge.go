@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// conflict is a request present in both simulations with different
+// responses. In a three-way merge one side may instead have deleted the
+// pair, which aDeleted/bDeleted record.
+type conflict struct {
+	key                string
+	a, b               Pair
+	aDeleted, bDeleted bool
+}
+
+// resolution records how a conflict was settled so later merges of the same
+// inputs can be repeated without prompting.
+type resolution struct {
+	Key      string    `json:"key"`
+	Request  string    `json:"request"`
+	Choice   string    `json:"choice"`
+	Response *Response `json:"response,omitempty"`
+}
+
+type resolutionFile struct {
+	Resolutions []resolution `json:"resolutions"`
+}
+
+// resolver settles merge conflicts, consulting recorded resolutions first
+// and then either prompting or failing.
+type resolver struct {
+	recorded    map[string]resolution
+	interactive bool
+	in          *bufio.Reader
+	out         io.Writer
+	made        []resolution
+	sequences   int
+}
+
+func runMerge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	outputFile := flags.String("output", "", "Path to write the merged simulation (optional, defaults to stdout)")
+	interactive := flags.Bool("interactive", false, "Prompt for each conflicting pair with a side-by-side response diff")
+	resolutionPath := flags.String("resolution-file", "", "JSON file of recorded conflict resolutions; interactive choices are appended to it")
+	baseFile := flags.String("base", "", "Common ancestor simulation for a three-way merge of exactly two files")
+	provenance := flags.Bool("provenance", false, "Label pairs without provenance with the file they were merged from (source:<file>)")
+	author := flags.String("author", "", "With --provenance, also label pairs without an author with author:<name>")
+	flags.Parse(args)
+
+	inputs := flags.Args()
+	if len(inputs) < 2 {
+		log.Fatal("merge needs at least two simulation files")
+	}
+	if *baseFile != "" && len(inputs) != 2 {
+		log.Fatal("merge --base takes exactly two simulation files")
+	}
+
+	r := &resolver{
+		recorded:    map[string]resolution{},
+		interactive: *interactive,
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stderr,
+	}
+	var recorded resolutionFile
+	if *resolutionPath != "" {
+		if data, err := os.ReadFile(*resolutionPath); err == nil {
+			if err := json.Unmarshal(data, &recorded); err != nil {
+				log.Fatalf("Failed to parse resolution file: %v", err)
+			}
+			for _, res := range recorded.Resolutions {
+				r.recorded[res.Key] = res
+			}
+		} else if !os.IsNotExist(err) || !*interactive {
+			log.Fatalf("Failed to read resolution file: %v", err)
+		}
+	}
+
+	load := func(path string) Simulation {
+		sim, err := readSimulation(path)
+		if err != nil {
+			log.Fatalf("Failed to parse simulation: %v", err)
+		}
+		if *provenance {
+			for i := range sim.Data.Pairs {
+				addProvenance(&sim.Data.Pairs[i], path, *author)
+			}
+		}
+		return sim
+	}
+
+	merged := load(inputs[0])
+	var err error
+	if *baseFile != "" {
+		base := load(*baseFile)
+		other := load(inputs[1])
+		merged, err = threeWayMerge(base, merged, other, r)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inputs = inputs[:1]
+	}
+	for _, path := range inputs[1:] {
+		merged, err = mergeSimulations(merged, load(path), r)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *resolutionPath != "" && len(r.made) > 0 {
+		recorded.Resolutions = append(recorded.Resolutions, r.made...)
+		data, err := json.MarshalIndent(recorded, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to serialize resolutions: %v", err)
+		}
+		if err := os.WriteFile(*resolutionPath, data, 0644); err != nil {
+			log.Fatalf("Failed to write resolution file: %v", err)
+		}
+	}
+
+	output, err := marshalSimulation(merged, isYAMLPath(*outputFile))
+	if err != nil {
+		log.Fatalf("Failed to serialize simulation: %v", err)
+	}
+	if err := writeOutput(*outputFile, output); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+}
+
+// mergeSimulations adds b's pairs to a. Identical pairs are kept once;
+// pairs whose request matchers collide but whose responses differ are
+// handed to r.
+func mergeSimulations(a, b Simulation, r *resolver) (Simulation, error) {
+	index := pairIndex(a.Data.Pairs)
+
+	var conflicts []conflict
+	for _, p := range b.Data.Pairs {
+		key := requestKey(p)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(a.Data.Pairs)
+			a.Data.Pairs = append(a.Data.Pairs, p)
+			continue
+		}
+		if sameResponse(a.Data.Pairs[i], p) {
+			continue
+		}
+		conflicts = append(conflicts, conflict{key: key, a: a.Data.Pairs[i], b: p})
+	}
+
+	var err error
+	a.Data.Pairs, err = applyResolutions(a.Data.Pairs, index, conflicts, r)
+	if err != nil {
+		return a, err
+	}
+	a.Data.GlobalActions = addGlobalActions(a.Data.GlobalActions, b.Data.GlobalActions)
+	return a, nil
+}
+
+// addGlobalActions adds b's global delays to a's, skipping those a
+// already has, so merging simulations that share a delay doesn't apply it
+// twice.
+func addGlobalActions(a, b GlobalActions) GlobalActions {
+	for _, d := range b.Delays {
+		if !containsDelay(a.Delays, d) {
+			a.Delays = append(a.Delays, d)
+		}
+	}
+	for _, d := range b.DelaysLogNormal {
+		if !containsLogNormalDelay(a.DelaysLogNormal, d) {
+			a.DelaysLogNormal = append(a.DelaysLogNormal, d)
+		}
+	}
+	return a
+}
+
+func containsDelay(delays []GlobalDelay, d GlobalDelay) bool {
+	for _, e := range delays {
+		if e == d {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLogNormalDelay(delays []GlobalLogNormalDelay, d GlobalLogNormalDelay) bool {
+	for _, e := range delays {
+		if e == d {
+			return true
+		}
+	}
+	return false
+}
+
+// threeWayMerge combines a and b, which were both derived from base. A pair
+// changed (or deleted) on only one side takes that side's version, labels
+// included; only pairs changed differently on both sides become conflicts.
+// Global delays are merged the same way.
+func threeWayMerge(base, a, b Simulation, r *resolver) (Simulation, error) {
+	baseIndex := pairIndex(base.Data.Pairs)
+	bIndex := pairIndex(b.Data.Pairs)
+
+	merged := a
+	merged.Data.Pairs = nil
+	index := map[string]int{}
+	var conflicts []conflict
+	add := func(p Pair) {
+		index[requestKey(p)] = len(merged.Data.Pairs)
+		merged.Data.Pairs = append(merged.Data.Pairs, p)
+	}
+
+	seen := map[string]bool{}
+	for _, pa := range a.Data.Pairs {
+		key := requestKey(pa)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		pb, inB := lookupPair(b.Data.Pairs, bIndex, key)
+		po, inBase := lookupPair(base.Data.Pairs, baseIndex, key)
+		switch {
+		case inB && samePair(pa, pb):
+			add(pa)
+		case !inBase && !inB:
+			add(pa) // added on a only
+		case inBase && !inB:
+			if !samePair(pa, po) {
+				// a changed it, b deleted it
+				add(pa)
+				conflicts = append(conflicts, conflict{key: key, a: pa, b: po, bDeleted: true})
+			}
+		case inBase && samePair(pa, po):
+			add(pb) // only b changed it
+		case inBase && samePair(pb, po):
+			add(pa) // only a changed it
+		default:
+			add(pa)
+			conflicts = append(conflicts, conflict{key: key, a: pa, b: pb})
+		}
+	}
+	for _, pb := range b.Data.Pairs {
+		key := requestKey(pb)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		po, inBase := lookupPair(base.Data.Pairs, baseIndex, key)
+		switch {
+		case !inBase:
+			add(pb) // added on b only
+		case !samePair(pb, po):
+			// b changed it, a deleted it
+			add(pb)
+			conflicts = append(conflicts, conflict{key: key, a: po, b: pb, aDeleted: true})
+		}
+	}
+
+	merged.Data.GlobalActions = GlobalActions{
+		Delays:          threeWayDelays(base.Data.GlobalActions.Delays, a.Data.GlobalActions.Delays, b.Data.GlobalActions.Delays),
+		DelaysLogNormal: threeWayLogNormalDelays(base.Data.GlobalActions.DelaysLogNormal, a.Data.GlobalActions.DelaysLogNormal, b.Data.GlobalActions.DelaysLogNormal),
+	}
+
+	var err error
+	merged.Data.Pairs, err = applyResolutions(merged.Data.Pairs, index, conflicts, r)
+	return merged, err
+}
+
+// threeWayDelays keeps the global delays of a that b didn't remove, then
+// adds those only b added. Simulations always carry a delays array, so the
+// result is never nil.
+func threeWayDelays(base, a, b []GlobalDelay) []GlobalDelay {
+	merged := []GlobalDelay{}
+	for _, d := range a {
+		if containsDelay(b, d) || !containsDelay(base, d) {
+			merged = append(merged, d)
+		}
+	}
+	for _, d := range b {
+		if !containsDelay(a, d) && !containsDelay(base, d) {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
+
+// threeWayLogNormalDelays is threeWayDelays for logNormal global delays.
+func threeWayLogNormalDelays(base, a, b []GlobalLogNormalDelay) []GlobalLogNormalDelay {
+	var merged []GlobalLogNormalDelay
+	for _, d := range a {
+		if containsLogNormalDelay(b, d) || !containsLogNormalDelay(base, d) {
+			merged = append(merged, d)
+		}
+	}
+	for _, d := range b {
+		if !containsLogNormalDelay(a, d) && !containsLogNormalDelay(base, d) {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
+
+// applyResolutions settles each conflict on the pair stored at index[key],
+// failing with the full list when any remain unresolved.
+func applyResolutions(pairs []Pair, index map[string]int, conflicts []conflict, r *resolver) ([]Pair, error) {
+	var unresolved []string
+	deleted := map[int]bool{}
+	for _, c := range conflicts {
+		res, ok, err := r.resolve(c)
+		if err != nil {
+			return pairs, err
+		}
+		if !ok {
+			unresolved = append(unresolved, describeRequest(c.a))
+			continue
+		}
+		i := index[c.key]
+		switch res.Choice {
+		case "a":
+			pairs[i] = c.a
+			deleted[i] = c.aDeleted
+		case "b":
+			pairs[i] = c.b
+			deleted[i] = c.bDeleted
+		case "edit":
+			pairs[i].Response = *res.Response
+		case "sequence":
+			r.sequences++
+			first, second := sequencePairs(c.a, c.b, fmt.Sprintf("sequence:merge-%d", r.sequences))
+			pairs[i] = first
+			pairs = append(pairs, second)
+		}
+	}
+	if len(unresolved) > 0 {
+		return pairs, fmt.Errorf("%d conflicting pair(s) need resolving (use --interactive or --resolution-file):\n  %s",
+			len(unresolved), strings.Join(unresolved, "\n  "))
+	}
+	if len(deleted) == 0 {
+		return pairs, nil
+	}
+	kept := pairs[:0]
+	for i, p := range pairs {
+		if !deleted[i] {
+			kept = append(kept, p)
+		}
+	}
+	return kept, nil
+}
+
+// pairIndex maps each request key to the first pair carrying it.
+func pairIndex(pairs []Pair) map[string]int {
+	index := map[string]int{}
+	for i, p := range pairs {
+		if _, ok := index[requestKey(p)]; !ok {
+			index[requestKey(p)] = i
+		}
+	}
+	return index
+}
+
+func lookupPair(pairs []Pair, index map[string]int, key string) (Pair, bool) {
+	i, ok := index[key]
+	if !ok {
+		return Pair{}, false
+	}
+	return pairs[i], true
+}
+
+// sequencePairs chains two responses for the same request with Hoverfly
+// state so the first is served once and the second thereafter. Hoverfly
+// initialises "sequence:" state keys to "1" when a simulation is loaded.
+func sequencePairs(first, second Pair, stateKey string) (Pair, Pair) {
+	first.Request.RequiresState = map[string]string{stateKey: "1"}
+	first.Response.TransitionsState = map[string]string{stateKey: "2"}
+	second.Request.RequiresState = map[string]string{stateKey: "2"}
+	return first, second
+}
+
+func (r *resolver) resolve(c conflict) (resolution, bool, error) {
+	id := conflictID(c)
+	if res, ok := r.recorded[id]; ok {
+		if res.Choice == "edit" && res.Response == nil {
+			return res, false, fmt.Errorf("resolution for %s chooses edit but has no response", res.Request)
+		}
+		return res, true, nil
+	}
+	if !r.interactive {
+		return resolution{}, false, nil
+	}
+
+	printSideBySide(r.out, c)
+	prompt := "keep [a], keep [b], [s]equence both, [e]dit"
+	editBase := c.a.Response
+	if c.aDeleted || c.bDeleted {
+		prompt = "keep [a], keep [b], [e]dit"
+		if c.aDeleted {
+			editBase = c.b.Response
+		}
+	}
+	for {
+		fmt.Fprintf(r.out, "Conflict on %s: %s? ", describeRequest(c.a), prompt)
+		line, err := r.in.ReadString('\n')
+		if err != nil && line == "" {
+			return resolution{}, false, fmt.Errorf("reading choice: %v", err)
+		}
+		res := resolution{Key: id, Request: describeRequest(c.a)}
+		switch strings.TrimSpace(strings.ToLower(line)) {
+		case "a":
+			res.Choice = "a"
+		case "b":
+			res.Choice = "b"
+		case "s":
+			if c.aDeleted || c.bDeleted {
+				continue
+			}
+			res.Choice = "sequence"
+		case "e":
+			edited, err := editResponse(editBase)
+			if err != nil {
+				fmt.Fprintf(r.out, "Edit failed: %v\n", err)
+				continue
+			}
+			res.Choice = "edit"
+			res.Response = &edited
+		default:
+			continue
+		}
+		r.made = append(r.made, res)
+		return res, true, nil
+	}
+}
+
+// editResponse opens the response as JSON in $EDITOR and returns the result.
+func editResponse(res Response) (Response, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	f, err := os.CreateTemp("", "har-to-hoverfly-*.json")
+	if err != nil {
+		return res, err
+	}
+	defer os.Remove(f.Name())
+
+	data, _ := json.MarshalIndent(res, "", "  ")
+	f.Write(data)
+	f.Close()
+
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return res, err
+	}
+	data, err = os.ReadFile(f.Name())
+	if err != nil {
+		return res, err
+	}
+	var edited Response
+	if err := json.Unmarshal(data, &edited); err != nil {
+		return res, err
+	}
+	return edited, nil
+}
+
+// printSideBySide shows both sides of a conflict as indented JSON in
+// adjacent columns, marking lines that differ with "|".
+func printSideBySide(w io.Writer, c conflict) {
+	left := pairLines(c.a)
+	right := pairLines(c.b)
+	if c.aDeleted {
+		left = []string{"(deleted)"}
+	}
+	if c.bDeleted {
+		right = []string{"(deleted)"}
+	}
+	const width = 60
+	fmt.Fprintf(w, "%-*s   %s\n", width, "A", "B")
+	for i := 0; i < len(left) || i < len(right); i++ {
+		var l, r string
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		marker := " "
+		if l != r {
+			marker = "|"
+		}
+		fmt.Fprintf(w, "%-*s %s %s\n", width, truncate(l, width), marker, truncate(r, width))
+	}
+}
+
+// pairLines renders a pair's response and labels for diffing, expanding
+// JSON bodies so field-level differences line up.
+func pairLines(p Pair) []string {
+	res := p.Response
+	view := map[string]interface{}{"status": res.Status, "headers": res.Headers}
+	if len(p.Labels) > 0 {
+		view["labels"] = p.Labels
+	}
+	var body interface{}
+	if json.Unmarshal([]byte(res.Body), &body) == nil {
+		view["body"] = body
+	} else {
+		view["body"] = res.Body
+	}
+	data, _ := json.MarshalIndent(view, "", "  ")
+	return strings.Split(string(data), "\n")
+}
+
+// requestKey identifies a pair by its request matchers. encoding/json sorts
+// map keys, so equal matchers always produce the same key. Hosts are
+// compared in punycode so Unicode and ASCII forms of a host are the same.
+func requestKey(p Pair) string {
+	req := p.Request
+	if ascii, changed := punycodeMatchers(req.Destination); changed {
+		req.Destination = ascii
+	}
+	if ascii, changed := punycodeMatchers(req.Headers["Host"]); changed {
+		req.Headers = make(map[string][]FieldMatcher, len(p.Request.Headers))
+		for name, ms := range p.Request.Headers {
+			req.Headers[name] = ms
+		}
+		req.Headers["Host"] = ascii
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	json.NewEncoder(buf).Encode(req)
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// punycodeMatchers copies host matchers with Unicode hosts converted to
+// punycode, reporting whether any needed converting.
+func punycodeMatchers(ms []FieldMatcher) ([]FieldMatcher, bool) {
+	var out []FieldMatcher
+	for i, m := range ms {
+		if m.Matcher == "regex" || isASCII(m.Value) {
+			continue
+		}
+		if out == nil {
+			out = append([]FieldMatcher{}, ms...)
+		}
+		out[i].Value = normaliseHost(m.Value, "punycode")
+	}
+	return out, out != nil
+}
+
+// samePair reports whether a and b are identical, labels included.
+func samePair(a, b Pair) bool {
+	x, y := getBuffer(), getBuffer()
+	defer putBuffer(x)
+	defer putBuffer(y)
+	json.NewEncoder(x).Encode(a)
+	json.NewEncoder(y).Encode(b)
+	return bytes.Equal(x.Bytes(), y.Bytes())
+}
+
+func sameResponse(a, b Pair) bool {
+	x, y := getBuffer(), getBuffer()
+	defer putBuffer(x)
+	defer putBuffer(y)
+	json.NewEncoder(x).Encode(a.Response)
+	json.NewEncoder(y).Encode(b.Response)
+	return bytes.Equal(x.Bytes(), y.Bytes())
+}
+
+// conflictID is a stable short identifier for a conflict, covering the
+// request, both responses and, when they differ, both sides' labels, so a
+// recorded resolution only applies to the exact conflict it was made for.
+func conflictID(c conflict) string {
+	x, _ := json.Marshal(c.a.Response)
+	y, _ := json.Marshal(c.b.Response)
+	id := c.key + "\x00" + string(x) + "\x00" + string(y)
+	if strings.Join(c.a.Labels, ",") != strings.Join(c.b.Labels, ",") {
+		id += "\x00" + strings.Join(c.a.Labels, ",") + "\x00" + strings.Join(c.b.Labels, ",")
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+func describeRequest(p Pair) string {
+	return exactValue(p.Request.Method) + " " + exactValue(p.Request.Destination) + exactValue(p.Request.Path)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mergePair is a GET pair for path returning body.
+func mergePair(path, body string) Pair {
+	return Pair{
+		Request: Request{
+			Method:      []FieldMatcher{{Matcher: "exact", Value: "GET"}},
+			Destination: []FieldMatcher{{Matcher: "exact", Value: "api.example.com"}},
+			Path:        []FieldMatcher{{Matcher: "exact", Value: path}},
+		},
+		Response: Response{Status: 200, Body: body},
+	}
+}
+
+func mergeSim(pairs ...Pair) Simulation {
+	var sim Simulation
+	sim.Data.Pairs = pairs
+	return sim
+}
+
+// labelled is p carrying labels.
+func labelled(p Pair, labels ...string) Pair {
+	p.Labels = labels
+	return p
+}
+
+// describeMerged lists the merged pairs as "path=body [labels]" in order.
+func describeMerged(sim Simulation) []string {
+	var out []string
+	for _, p := range sim.Data.Pairs {
+		s := exactValue(p.Request.Path) + "=" + p.Response.Body
+		if len(p.Labels) > 0 {
+			s += " [" + strings.Join(p.Labels, ",") + "]"
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	users, orders := mergePair("/users", "v1"), mergePair("/orders", "v1")
+	tests := []struct {
+		name    string
+		base    []Pair
+		a, b    []Pair
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "unchanged",
+			base: []Pair{users}, a: []Pair{users}, b: []Pair{users},
+			want: []string{"/users=v1"},
+		},
+		{
+			name: "changed on a",
+			base: []Pair{users}, a: []Pair{mergePair("/users", "a")}, b: []Pair{users},
+			want: []string{"/users=a"},
+		},
+		{
+			name: "changed on b",
+			base: []Pair{users}, a: []Pair{users}, b: []Pair{mergePair("/users", "b")},
+			want: []string{"/users=b"},
+		},
+		{
+			name: "changed the same way on both",
+			base: []Pair{users}, a: []Pair{mergePair("/users", "v2")}, b: []Pair{mergePair("/users", "v2")},
+			want: []string{"/users=v2"},
+		},
+		{
+			name: "relabelled on a",
+			base: []Pair{users}, a: []Pair{labelled(users, "smoke")}, b: []Pair{users},
+			want: []string{"/users=v1 [smoke]"},
+		},
+		{
+			name: "relabelled on b",
+			base: []Pair{labelled(users, "smoke")}, a: []Pair{labelled(users, "smoke")}, b: []Pair{users},
+			want: []string{"/users=v1"},
+		},
+		{
+			name: "relabelled on a, changed on b",
+			base: []Pair{users}, a: []Pair{labelled(users, "smoke")}, b: []Pair{mergePair("/users", "b")},
+			wantErr: "1 conflicting pair(s) need resolving",
+		},
+		{
+			name: "relabelled differently on both",
+			base: []Pair{users}, a: []Pair{labelled(users, "smoke")}, b: []Pair{labelled(users, "slow")},
+			wantErr: "1 conflicting pair(s) need resolving",
+		},
+		{
+			name: "relabelled on a, deleted on b",
+			base: []Pair{users}, a: []Pair{labelled(users, "smoke")}, b: nil,
+			wantErr: "1 conflicting pair(s) need resolving",
+		},
+		{
+			name: "added on each side",
+			base: []Pair{users}, a: []Pair{users, orders}, b: []Pair{users, mergePair("/items", "v1")},
+			want: []string{"/users=v1", "/orders=v1", "/items=v1"},
+		},
+		{
+			name: "deleted on a",
+			base: []Pair{users, orders}, a: []Pair{users}, b: []Pair{users, orders},
+			want: []string{"/users=v1"},
+		},
+		{
+			name: "deleted on b",
+			base: []Pair{users, orders}, a: []Pair{users, orders}, b: []Pair{orders},
+			want: []string{"/orders=v1"},
+		},
+		{
+			name: "changed on a, deleted on b",
+			base: []Pair{users}, a: []Pair{mergePair("/users", "a")}, b: nil,
+			wantErr: "1 conflicting pair(s) need resolving",
+		},
+		{
+			name: "deleted on a, changed on b",
+			base: []Pair{users}, a: nil, b: []Pair{mergePair("/users", "b")},
+			wantErr: "1 conflicting pair(s) need resolving",
+		},
+		{
+			name:    "changed differently on both",
+			base:    []Pair{users, orders},
+			a:       []Pair{mergePair("/users", "a"), mergePair("/orders", "a")},
+			b:       []Pair{mergePair("/users", "b"), mergePair("/orders", "b")},
+			wantErr: "2 conflicting pair(s) need resolving",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &resolver{recorded: map[string]resolution{}}
+			merged, err := threeWayMerge(mergeSim(tt.base...), mergeSim(tt.a...), mergeSim(tt.b...), r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeMerged(merged); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThreeWayMergeGlobalActions(t *testing.T) {
+	kept := GlobalDelay{URLPattern: ".", Delay: 100}
+	dropped := GlobalDelay{URLPattern: "^cdn\\.example\\.com(:[0-9]+)?(/|$)", Delay: 50}
+	addedA := GlobalDelay{URLPattern: "^api\\.example\\.com(:[0-9]+)?(/|$)", Delay: 500}
+	addedB := GlobalDelay{URLPattern: ".", HTTPMethod: "POST", Delay: 200}
+	fitted := GlobalLogNormalDelay{URLPattern: ".", LogNormalDelay: LogNormalDelay{Min: 10, Max: 90, Mean: 40, Median: 30}}
+	tests := []struct {
+		name       string
+		base, a, b GlobalActions
+		want       GlobalActions
+	}{
+		{
+			name: "unchanged",
+			base: GlobalActions{Delays: []GlobalDelay{kept}},
+			a:    GlobalActions{Delays: []GlobalDelay{kept}},
+			b:    GlobalActions{Delays: []GlobalDelay{kept}},
+			want: GlobalActions{Delays: []GlobalDelay{kept}},
+		},
+		{
+			name: "added on b only",
+			base: GlobalActions{Delays: []GlobalDelay{}},
+			a:    GlobalActions{Delays: []GlobalDelay{}},
+			b:    GlobalActions{Delays: []GlobalDelay{addedB}, DelaysLogNormal: []GlobalLogNormalDelay{fitted}},
+			want: GlobalActions{Delays: []GlobalDelay{addedB}, DelaysLogNormal: []GlobalLogNormalDelay{fitted}},
+		},
+		{
+			name: "added on both, removed on each",
+			base: GlobalActions{Delays: []GlobalDelay{kept, dropped}, DelaysLogNormal: []GlobalLogNormalDelay{fitted}},
+			a:    GlobalActions{Delays: []GlobalDelay{kept, addedA}, DelaysLogNormal: []GlobalLogNormalDelay{fitted}},
+			b:    GlobalActions{Delays: []GlobalDelay{kept, dropped, addedB}},
+			want: GlobalActions{Delays: []GlobalDelay{kept, addedA, addedB}},
+		},
+		{
+			name: "added the same on both",
+			base: GlobalActions{Delays: []GlobalDelay{}},
+			a:    GlobalActions{Delays: []GlobalDelay{addedA}},
+			b:    GlobalActions{Delays: []GlobalDelay{addedA}},
+			want: GlobalActions{Delays: []GlobalDelay{addedA}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, a, b := mergeSim(), mergeSim(), mergeSim()
+			base.Data.GlobalActions, a.Data.GlobalActions, b.Data.GlobalActions = tt.base, tt.a, tt.b
+			merged, err := threeWayMerge(base, a, b, &resolver{recorded: map[string]resolution{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(merged.Data.GlobalActions, tt.want) {
+				t.Errorf("got %+v, want %+v", merged.Data.GlobalActions, tt.want)
+			}
+		})
+	}
+}
+
+func TestThreeWayMergeRecordedResolutions(t *testing.T) {
+	base := mergePair("/users", "v1")
+	a, b := mergePair("/users", "a"), mergePair("/users", "b")
+	key := requestKey(base)
+	tests := []struct {
+		name   string
+		a, b   []Pair
+		c      conflict
+		choice string
+		want   []string
+	}{
+		{
+			name: "keep b's change",
+			a:    []Pair{a}, b: []Pair{b},
+			c:      conflict{key: key, a: a, b: b},
+			choice: "b",
+			want:   []string{"/users=b"},
+		},
+		{
+			name: "keep b's deletion",
+			a:    []Pair{a}, b: nil,
+			c:      conflict{key: key, a: a, b: base, bDeleted: true},
+			choice: "b",
+			want:   nil,
+		},
+		{
+			name: "keep a's change over b's deletion",
+			a:    []Pair{a}, b: nil,
+			c:      conflict{key: key, a: a, b: base, bDeleted: true},
+			choice: "a",
+			want:   []string{"/users=a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := conflictID(tt.c)
+			r := &resolver{recorded: map[string]resolution{id: {Key: id, Choice: tt.choice}}}
+			merged, err := threeWayMerge(mergeSim(base), mergeSim(tt.a...), mergeSim(tt.b...), r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeMerged(merged); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSimulationsGlobalActions(t *testing.T) {
+	shared := GlobalDelay{URLPattern: ".", Delay: 100}
+	slow := GlobalDelay{URLPattern: "^api\\.example\\.com(:[0-9]+)?(/|$)", Delay: 500}
+	fitted := GlobalLogNormalDelay{URLPattern: ".", LogNormalDelay: LogNormalDelay{Min: 10, Max: 90, Mean: 40, Median: 30}}
+
+	a, b := mergeSim(mergePair("/users", "v1")), mergeSim(mergePair("/orders", "v1"))
+	a.Data.GlobalActions = GlobalActions{Delays: []GlobalDelay{shared}, DelaysLogNormal: []GlobalLogNormalDelay{fitted}}
+	b.Data.GlobalActions = GlobalActions{Delays: []GlobalDelay{shared, slow}, DelaysLogNormal: []GlobalLogNormalDelay{fitted}}
+	merged, err := mergeSimulations(a, b, &resolver{recorded: map[string]resolution{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GlobalActions{Delays: []GlobalDelay{shared, slow}, DelaysLogNormal: []GlobalLogNormalDelay{fitted}}
+	if !reflect.DeepEqual(merged.Data.GlobalActions, want) {
+		t.Errorf("got %+v, want %+v", merged.Data.GlobalActions, want)
+	}
+
+	// Merging the result again adds nothing.
+	again, err := mergeSimulations(merged, b, &resolver{recorded: map[string]resolution{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Data.GlobalActions, want) {
+		t.Errorf("merging again got %+v, want %+v", again.Data.GlobalActions, want)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// methodDefault overrides or synthesises the responses for one HTTP method,
+// covering requests browsers rarely record but test clients send, e.g.
+// CORS preflights or HEAD probes. Host and Path narrow the endpoints it
+// applies to, as for template rules.
+type methodDefault struct {
+	Method     string              `json:"method"`
+	Host       string              `json:"host,omitempty"`
+	Path       string              `json:"path,omitempty"`
+	Status     int                 `json:"status,omitempty"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Body       *string             `json:"body,omitempty"`
+	CORS       bool                `json:"cors,omitempty"`
+	Mirror     string              `json:"mirror,omitempty"`
+	Synthesise bool                `json:"synthesise,omitempty"`
+}
+
+const methodDefaultLabel = "method-default"
+
+func readMethodDefaults(path string) ([]methodDefault, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLPath(path) {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	var rules []methodDefault
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range rules {
+		r := &rules[i]
+		if r.Method == "" {
+			return nil, fmt.Errorf("%s: rule %d: method is required", path, i+1)
+		}
+		r.Method = strings.ToUpper(r.Method)
+		r.Mirror = strings.ToUpper(r.Mirror)
+		if r.Mirror == r.Method {
+			return nil, fmt.Errorf("%s: %s: can't mirror itself", path, r.Method)
+		}
+		if r.Synthesise && r.Mirror == "" && r.Status == 0 {
+			return nil, fmt.Errorf("%s: %s: synthesised pairs need a status or mirror", path, r.Method)
+		}
+	}
+	return rules, nil
+}
+
+func (r methodDefault) selector() *pairSelector {
+	return &pairSelector{host: r.Host, path: r.Path}
+}
+
+// endpointOf identifies the destination and path a pair answers, ignoring
+// method, headers and query.
+func endpointOf(p Pair) string {
+	return exactValue(p.Request.Destination) + exactValue(p.Request.Path)
+}
+
+// applyMethodDefaults overrides the responses of pairs with a rule's method
+// and, for mirror or synthesise rules, adds pairs for endpoints that have
+// none. Added pairs are appended; sources holds, for each, the index of the
+// pair it was derived from so split outputs can place it.
+func applyMethodDefaults(pairs []Pair, rules []methodDefault) (result []Pair, sources []int, overridden int) {
+	methods := map[string][]string{}
+	for _, p := range pairs {
+		ep := endpointOf(p)
+		if m := exactValue(p.Request.Method); !containsString(methods[ep], m) {
+			methods[ep] = append(methods[ep], m)
+		}
+	}
+
+	result = pairs
+	for _, r := range rules {
+		sel := r.selector()
+		for i := range result {
+			if strings.EqualFold(exactValue(result[i].Request.Method), r.Method) && sel.matches(result[i]) {
+				r.override(&result[i], methods[endpointOf(result[i])])
+				overridden++
+			}
+		}
+		if r.Mirror == "" && !r.Synthesise {
+			continue
+		}
+
+		done := map[string]bool{}
+		for ep, ms := range methods {
+			if containsString(ms, r.Method) {
+				done[ep] = true
+			}
+		}
+		n := len(result)
+		for i := 0; i < n; i++ {
+			src := result[i]
+			ep := endpointOf(src)
+			if done[ep] || !sel.matches(src) {
+				continue
+			}
+			if r.Mirror != "" && !strings.EqualFold(exactValue(src.Request.Method), r.Mirror) {
+				continue
+			}
+			done[ep] = true
+
+			var p Pair
+			if r.Mirror != "" {
+				p = copyPair(src)
+				if r.Method == "HEAD" {
+					p.Response.Body = ""
+					p.Response.EncodedBody = false
+				}
+			} else {
+				p.Request.Destination = src.Request.Destination
+				p.Request.Path = src.Request.Path
+				p.Response.Status = r.Status
+			}
+			p.Request.Method = []FieldMatcher{{Matcher: "exact", Value: r.Method}}
+			p.Labels = []string{r.Method, methodDefaultLabel}
+			methods[ep] = append(methods[ep], r.Method)
+			r.override(&p, methods[ep])
+			result = append(result, p)
+			sources = append(sources, i)
+		}
+	}
+	return result, sources, overridden
+}
+
+// override applies the rule's response fields to p. methods lists the
+// methods recorded for p's endpoint, advertised by CORS preflights.
+func (r methodDefault) override(p *Pair, methods []string) {
+	if r.Status != 0 {
+		p.Response.Status = r.Status
+	}
+	if r.Body != nil {
+		p.Response.Body = *r.Body
+		p.Response.EncodedBody = false
+	}
+	if p.Response.Headers == nil && (r.CORS || len(r.Headers) > 0) {
+		p.Response.Headers = Header{}
+	}
+	if r.CORS {
+		allowed := append([]string{}, methods...)
+		sort.Strings(allowed)
+		p.Response.Headers["Access-Control-Allow-Origin"] = []string{"*"}
+		p.Response.Headers["Access-Control-Allow-Methods"] = []string{strings.Join(allowed, ", ")}
+		p.Response.Headers["Access-Control-Allow-Headers"] = []string{"*"}
+		p.Response.Headers["Access-Control-Max-Age"] = []string{"86400"}
+	}
+	for name, values := range r.Headers {
+		p.Response.Headers[name] = values
+	}
+}
+
+// copyPair deep-copies the maps and slices of p that callers may modify.
+func copyPair(p Pair) Pair {
+	headers := Header{}
+	for name, values := range p.Response.Headers {
+		headers[name] = append([]string{}, values...)
+	}
+	p.Response.Headers = headers
+	p.Labels = append([]string{}, p.Labels...)
+	return p
+}
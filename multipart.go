@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Multipart bodies can't be matched exactly: browsers pick a new random
+// boundary for every request. They are matched instead with one regex per
+// form field, which Hoverfly ANDs, so field order and the boundary don't
+// matter. Text fields are matched with their value; file fields by name
+// and file name only, since recorders often drop or mangle file contents.
+
+func isMultipart(mimeType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(mimeType)), "multipart/form-data")
+}
+
+// multipartMatchers returns the field matchers for a multipart postData,
+// parsing its text when the boundary can be found and falling back to the
+// params HAR lists.
+func multipartMatchers(post PostData, mimeType string) []FieldMatcher {
+	params, ok := multipartParts(post.Text, mimeType)
+	if !ok {
+		params = post.Params
+	}
+	var matchers []FieldMatcher
+	for _, p := range params {
+		if p.Name == "" {
+			continue
+		}
+		disposition := `(?i:content-disposition):[ \t]*form-data;[ \t]*name="` + regexp.QuoteMeta(p.Name) + `"`
+		if p.FileName != "" {
+			matchers = append(matchers, FieldMatcher{
+				Matcher: "regex",
+				Value:   disposition + `;[ \t]*filename="` + regexp.QuoteMeta(p.FileName) + `"`,
+			})
+			continue
+		}
+		// The value follows the part's remaining headers and a blank line,
+		// and runs up to the next boundary.
+		matchers = append(matchers, FieldMatcher{
+			Matcher: "regex",
+			Value:   disposition + `[^\r\n]*\r?\n(?:[^\r\n]+\r?\n)*\r?\n` + regexp.QuoteMeta(p.Value) + `\r?\n--`,
+		})
+	}
+	return matchers
+}
+
+// multipartParts parses a recorded multipart body into its fields. The
+// boundary comes from the content type or, when a recorder left it out,
+// the body's first line.
+func multipartParts(text, mimeType string) ([]HarParam, bool) {
+	if text == "" {
+		return nil, false
+	}
+	_, params, _ := mime.ParseMediaType(mimeType)
+	boundary := params["boundary"]
+	if boundary == "" {
+		line, _, _ := strings.Cut(text, "\n")
+		if !strings.HasPrefix(line, "--") {
+			return nil, false
+		}
+		boundary = strings.TrimSuffix(strings.TrimPrefix(line, "--"), "\r")
+	}
+
+	var parts []HarParam
+	r := multipart.NewReader(strings.NewReader(text), boundary)
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			return parts, len(parts) > 0
+		}
+		if err != nil {
+			return nil, false
+		}
+		p := HarParam{Name: part.FormName(), FileName: part.FileName(), ContentType: part.Header.Get("Content-Type")}
+		if p.FileName == "" {
+			value, err := io.ReadAll(part)
+			if err != nil || !utf8.Valid(value) {
+				return nil, false
+			}
+			p.Value = string(value)
+		}
+		parts = append(parts, p)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// notModifiedModes are the accepted values of --not-modified: keep 304s as
+// recorded, backfill them from a 200 for the same request, or turn them
+// into 200s with whatever the 304 recorded.
+var notModifiedModes = []string{"keep", "backfill", "200"}
+
+// notModifiedSources finds, for every 304 entry, a 200 recorded for the
+// same method and URL whose body and headers it can be served with,
+// preferring the latest one before it. Browsers revalidate resources they
+// already cached, so captures hold a 304 with an empty body for each one.
+// 304s with no such 200 are returned in orphans.
+func notModifiedSources(entries []Entry) (sources map[int]int, orphans []string) {
+	sources = map[int]int{}
+	last := map[string]int{}
+	var pending []int
+	key := func(e Entry) string { return e.Request.Method + " " + stripFragment(e.Request.URL) }
+	for i, e := range entries {
+		switch e.Response.Status {
+		case 200:
+			last[key(e)] = i
+		case 304:
+			if j, ok := last[key(e)]; ok {
+				sources[i] = j
+			} else {
+				pending = append(pending, i)
+			}
+		}
+	}
+	// Captures started with a warm cache see the 304 first.
+	for _, i := range pending {
+		if j, ok := last[key(entries[i])]; ok {
+			sources[i] = j
+			continue
+		}
+		orphans = append(orphans, key(entries[i]))
+	}
+	return sources, orphans
+}
+
+// writeNotModifiedReport logs what --not-modified did with 304 entries.
+func writeNotModifiedReport(mode string, converted int, orphans []string) {
+	if converted > 0 {
+		how := map[string]string{
+			"backfill": "Backfilled %d 304 Not Modified response(s) with the body and headers of a 200 for the same request",
+			"200":      "Served %d 304 Not Modified response(s) as 200s",
+		}[mode]
+		log.Printf(how, converted)
+	}
+	if len(orphans) > 0 {
+		log.Printf("%d 304 Not Modified response(s) kept because no 200 was recorded for the same request:\n  %s", len(orphans), strings.Join(orphans, "\n  "))
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openapiSpec is an OpenAPI 3 or Swagger 2 document used to refine pair
+// matchers and check recorded bodies. The document is kept as decoded JSON
+// so $refs can be followed wherever they appear.
+type openapiSpec struct {
+	doc        map[string]interface{}
+	operations []*openapiOperation
+}
+
+// openapiOperation is one method of a spec path. loose matches the path
+// with any value for its parameters, strict only with values their schemas
+// allow.
+type openapiOperation struct {
+	method, template string
+	loose, strict    *regexp.Regexp
+	params           int
+	query            map[string]bool
+	requestSchema    interface{}
+	responses        map[string]interface{}
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}/]+)\}`)
+
+var openapiMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+func readOpenAPI(path string) (*openapiSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLPath(path) || !strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	spec := &openapiSpec{}
+	if err := json.Unmarshal(data, &spec.doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	paths, _ := spec.doc["paths"].(map[string]interface{})
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no paths", path)
+	}
+
+	prefixes := spec.basePaths()
+	for template, item := range paths {
+		item := spec.object(item)
+		for _, method := range openapiMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			params := spec.parameters(item["parameters"], op["parameters"])
+			for _, prefix := range prefixes {
+				o := &openapiOperation{
+					method:    strings.ToUpper(method),
+					template:  prefix + template,
+					query:     map[string]bool{},
+					responses: map[string]interface{}{},
+				}
+				var err error
+				if o.loose, o.strict, o.params, err = spec.pathPatterns(o.template, params); err != nil {
+					return nil, fmt.Errorf("%s: %s %s: %v", path, o.method, template, err)
+				}
+				for key, p := range params {
+					if strings.HasPrefix(key, "query:") {
+						o.query[strings.TrimPrefix(key, "query:")] = true
+					} else if key == "body:" {
+						o.requestSchema = p["schema"]
+					}
+				}
+				if body := spec.object(op["requestBody"]); body != nil {
+					o.requestSchema = spec.jsonSchema(body["content"])
+				}
+				for code, r := range spec.object(op["responses"]) {
+					r := spec.object(r)
+					if schema, ok := r["schema"]; ok {
+						o.responses[code] = schema
+					} else if schema := spec.jsonSchema(r["content"]); schema != nil {
+						o.responses[code] = schema
+					}
+				}
+				spec.operations = append(spec.operations, o)
+			}
+		}
+	}
+	// Literal paths win over templated ones, e.g. /users/me over
+	// /users/{id}.
+	sort.SliceStable(spec.operations, func(i, j int) bool {
+		return spec.operations[i].params < spec.operations[j].params
+	})
+	return spec, nil
+}
+
+// basePaths returns the path prefixes of the spec's servers (OpenAPI 3) or
+// its basePath (Swagger 2), with server variables at their defaults.
+func (s *openapiSpec) basePaths() []string {
+	if base, ok := s.doc["basePath"].(string); ok {
+		return []string{strings.TrimRight(base, "/")}
+	}
+	servers, _ := s.doc["servers"].([]interface{})
+	seen := map[string]bool{}
+	var prefixes []string
+	for _, server := range servers {
+		server := s.object(server)
+		raw, _ := server["url"].(string)
+		for name, v := range s.object(server["variables"]) {
+			def, _ := s.object(v)["default"].(string)
+			raw = strings.ReplaceAll(raw, "{"+name+"}", def)
+		}
+		prefix := ""
+		if u, err := url.Parse(raw); err == nil {
+			prefix = strings.TrimRight(u.Path, "/")
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	return prefixes
+}
+
+// parameters merges path-level and operation-level parameters, keyed by
+// in:name; operation parameters override path ones.
+func (s *openapiSpec) parameters(lists ...interface{}) map[string]map[string]interface{} {
+	params := map[string]map[string]interface{}{}
+	for _, list := range lists {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			p := s.object(item)
+			in, _ := p["in"].(string)
+			name, _ := p["name"].(string)
+			if in == "body" {
+				name = ""
+			}
+			params[in+":"+name] = p
+		}
+	}
+	return params
+}
+
+// pathPatterns compiles a path template into a regular expression matching
+// any parameter values and one matching only values the parameters'
+// schemas allow.
+func (s *openapiSpec) pathPatterns(template string, params map[string]map[string]interface{}) (loose, strict *regexp.Regexp, n int, err error) {
+	var l, t strings.Builder
+	last := 0
+	for _, m := range pathParamPattern.FindAllStringSubmatchIndex(template, -1) {
+		literal := regexp.QuoteMeta(template[last:m[0]])
+		l.WriteString(literal)
+		t.WriteString(literal)
+		l.WriteString(`[^/]+`)
+		t.WriteString(s.paramPattern(params["path:"+template[m[2]:m[3]]]))
+		last = m[1]
+		n++
+	}
+	literal := regexp.QuoteMeta(template[last:])
+	l.WriteString(literal)
+	t.WriteString(literal)
+	if loose, err = regexp.Compile("^" + l.String() + "$"); err != nil {
+		return nil, nil, 0, err
+	}
+	strict, err = regexp.Compile("^" + t.String() + "$")
+	return loose, strict, n, err
+}
+
+// paramPattern is the regular expression for a path parameter's values.
+func (s *openapiSpec) paramPattern(param map[string]interface{}) string {
+	schema := param
+	if sc, ok := param["schema"]; ok {
+		schema = s.object(sc)
+	}
+	if values, ok := schema["enum"].([]interface{}); ok && len(values) > 0 {
+		var alts []string
+		for _, v := range values {
+			alts = append(alts, regexp.QuoteMeta(fmt.Sprint(v)))
+		}
+		return "(?:" + strings.Join(alts, "|") + ")"
+	}
+	switch schema["type"] {
+	case "integer":
+		return `-?[0-9]+`
+	case "number":
+		return `-?[0-9]+(?:\.[0-9]+)?`
+	case "boolean":
+		return `(?:true|false)`
+	}
+	if schema["format"] == "uuid" {
+		return `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+	}
+	return `[^/]+`
+}
+
+// jsonSchema picks the schema of the JSON media type from a content map.
+func (s *openapiSpec) jsonSchema(content interface{}) interface{} {
+	media := s.object(content)
+	keys := make([]string, 0, len(media))
+	for k := range media {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.Contains(k, "json") || k == "*/*" {
+			return s.object(media[k])["schema"]
+		}
+	}
+	return nil
+}
+
+// object resolves a local $ref and returns the node as an object, or nil.
+func (s *openapiSpec) object(node interface{}) map[string]interface{} {
+	for depth := 0; depth < 32; depth++ {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		node = s.lookup(ref)
+	}
+	return nil
+}
+
+// lookup follows a local JSON pointer such as #/components/schemas/User.
+func (s *openapiSpec) lookup(ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var node interface{} = s.doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	return node
+}
+
+// find returns the operation for a request, or nil, and whether the path's
+// parameters are valid for it.
+func (s *openapiSpec) find(method, path string) (*openapiOperation, bool) {
+	for _, o := range s.operations {
+		if o.method == method && o.loose.MatchString(path) {
+			return o, o.strict.MatchString(path)
+		}
+	}
+	return nil, false
+}
+
+// responseSchema returns the schema documented for a status: the exact
+// code, its range (e.g. 2XX), or the default response.
+func (o *openapiOperation) responseSchema(status int) interface{} {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		if schema, ok := o.responses[key]; ok {
+			return schema
+		}
+	}
+	return nil
+}
+
+// validate checks a decoded JSON value against a schema, returning one
+// message per violation. It covers types, required and additional
+// properties, items, enums, nullable and the allOf/anyOf/oneOf combinators;
+// formats and numeric or length bounds aren't checked.
+func (s *openapiSpec) validate(schemaNode interface{}, v interface{}, at string, depth int) []string {
+	schema := s.object(schemaNode)
+	if schema == nil || depth > 64 {
+		return nil
+	}
+	types := asList(schema["type"])
+	if v == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || containsValue(types, "null") {
+			return nil
+		}
+	}
+	var errs []string
+	for _, sub := range asList(schema["allOf"]) {
+		errs = append(errs, s.validate(sub, v, at, depth+1)...)
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		subs := asList(schema[key])
+		if len(subs) == 0 {
+			continue
+		}
+		passed := 0
+		for _, sub := range subs {
+			if len(s.validate(sub, v, at, depth+1)) == 0 {
+				passed++
+			}
+		}
+		if passed == 0 {
+			errs = append(errs, fmt.Sprintf("%s: matches none of the %s schemas", at, key))
+		} else if key == "oneOf" && passed > 1 {
+			errs = append(errs, fmt.Sprintf("%s: matches %d oneOf schemas", at, passed))
+		}
+	}
+	if values, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range values {
+			if reflect.DeepEqual(e, v) {
+				found = true
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: %s is not one of the allowed values", at, diffValue(v)))
+		}
+	}
+
+	if v == nil {
+		if len(types) == 0 {
+			return errs
+		}
+		return append(errs, fmt.Sprintf("%s: null, expected %s", at, joinValues(types)))
+	}
+	if len(types) > 0 && !containsValue(types, jsonType(v)) && !(jsonType(v) == "integer" && containsValue(types, "number")) {
+		return append(errs, fmt.Sprintf("%s: %s, expected %s", at, jsonType(v), joinValues(types)))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		props := s.object(schema["properties"])
+		for _, name := range asList(schema["required"]) {
+			if _, ok := v[fmt.Sprint(name)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required property %q", at, name))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if sub, ok := props[k]; ok {
+				errs = append(errs, s.validate(sub, v[k], at+"."+k, depth+1)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: unexpected property %q", at, k))
+				}
+			case map[string]interface{}:
+				errs = append(errs, s.validate(extra, v[k], at+"."+k, depth+1)...)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"]; ok {
+			for i, item := range v {
+				errs = append(errs, s.validate(items, item, fmt.Sprintf("%s[%d]", at, i), depth+1)...)
+			}
+		}
+	}
+	return errs
+}
+
+func asList(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case nil:
+		return nil
+	}
+	return []interface{}{v}
+}
+
+func containsValue(values []interface{}, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func joinValues(values []interface{}) string {
+	var s []string
+	for _, v := range values {
+		s = append(s, fmt.Sprint(v))
+	}
+	return strings.Join(s, " or ")
+}
+
+// jsonType names a decoded JSON value's type as JSON Schema does.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "null"
+}
+
+// openapiRefiner applies a spec to converted pairs. Path matchers are
+// refined after conversion, once it is known which templates were recorded
+// with more than one concrete path.
+type openapiRefiner struct {
+	spec         *openapiSpec
+	templated    map[int]*openapiOperation
+	paths        map[*openapiOperation]map[string]bool
+	undocumented []string
+	droppedQuery map[string]int
+}
+
+func newOpenAPIRefiner(spec *openapiSpec) *openapiRefiner {
+	return &openapiRefiner{
+		spec:         spec,
+		templated:    map[int]*openapiOperation{},
+		paths:        map[*openapiOperation]map[string]bool{},
+		droppedQuery: map[string]int{},
+	}
+}
+
+// refine matches pair index against the spec: query matchers for
+// parameters the operation doesn't declare are dropped, and the recorded
+// bodies are validated. It returns the violations found for the entry.
+func (r *openapiRefiner) refine(index int, p *Pair, entry Entry, path string) []string {
+	req := entry.Request
+	label := fmt.Sprintf("%s %s", req.Method, req.URL)
+	op, valid := r.spec.find(req.Method, path)
+	if op == nil {
+		r.undocumented = append(r.undocumented, label)
+		return nil
+	}
+
+	var violations []string
+	if valid {
+		r.templated[index] = op
+		if r.paths[op] == nil {
+			r.paths[op] = map[string]bool{}
+		}
+		r.paths[op][path] = true
+	} else {
+		violations = append(violations, fmt.Sprintf("path parameters don't match the schemas of %s", op.template))
+	}
+	for name := range p.Request.Query {
+		if !op.query[name] {
+			delete(p.Request.Query, name)
+			r.droppedQuery[name]++
+		}
+	}
+
+	if req.PostData != nil && op.requestSchema != nil {
+		var body interface{}
+		if json.Unmarshal([]byte(req.PostData.Text), &body) == nil {
+			violations = append(violations, r.spec.validate(op.requestSchema, body, "request body", 0)...)
+		}
+	}
+	if schema := op.responseSchema(entry.Response.Status); schema != nil && !p.Response.EncodedBody {
+		var body interface{}
+		if json.Unmarshal([]byte(entry.Response.Content.Text), &body) == nil {
+			violations = append(violations, r.spec.validate(schema, body, "response body", 0)...)
+		}
+	}
+	return violations
+}
+
+// applyPaths replaces the exact path matchers of pairs with their
+// operation's template regex. Templates recorded with several concrete
+// paths keep exact matchers, since one regex pair would shadow the
+// others' responses. It returns how many pairs were refined and kept.
+func (r *openapiRefiner) applyPaths(pairs []Pair) (refined, kept int) {
+	for i, op := range r.templated {
+		if op.params == 0 {
+			continue
+		}
+		if len(r.paths[op]) > 1 {
+			kept++
+			continue
+		}
+		pairs[i].Request.Path = []FieldMatcher{{Matcher: "regex", Value: op.strict.String()}}
+		refined++
+	}
+	return refined, kept
+}
+
+func (r *openapiRefiner) writeReport(refined, kept int) {
+	if refined > 0 || kept > 0 {
+		log.Printf("OpenAPI: matched %d pair(s) by path template; %d kept exact paths because their template was recorded with several values", refined, kept)
+	}
+	if len(r.droppedQuery) > 0 {
+		names := make([]string, 0, len(r.droppedQuery))
+		for name, n := range r.droppedQuery {
+			names = append(names, fmt.Sprintf("%s (%d)", name, n))
+		}
+		sort.Strings(names)
+		log.Printf("OpenAPI: dropped matchers for query parameters the spec doesn't declare: %s", strings.Join(names, ", "))
+	}
+	if len(r.undocumented) > 0 {
+		log.Printf("OpenAPI: %d entr(ies) match no operation in the spec:\n  %s", len(r.undocumented), strings.Join(r.undocumented, "\n  "))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Many flags only refine another flag or mode, and were ignored when that
+// wasn't given: --author without --provenance labelled nothing, and
+// --summarise printed its table whatever --output said. Such combinations
+// are rejected before the HAR is read, all of them in one run, each with
+// what to add or drop.
+
+// optionRule is a flag that is ignored unless applies holds. hint follows
+// the flag's name in the error.
+type optionRule struct {
+	flag    string
+	applies bool
+	hint    string
+}
+
+// givenFlags returns the names of the flags set on the command line, as
+// opposed to those left at their defaults.
+func givenFlags(flags *flag.FlagSet) map[string]bool {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return given
+}
+
+// checkOptions fails the run if any rule's flag was given where it would
+// be ignored.
+func checkOptions(given map[string]bool, rules []optionRule) {
+	var problems []string
+	for _, r := range rules {
+		if given[r.flag] && !r.applies {
+			problems = append(problems, fmt.Sprintf("--%s %s", r.flag, r.hint))
+		}
+	}
+	if len(problems) > 0 {
+		fatalf("%d flag(s) would be ignored:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+}
+
+// cookieMatchingRule rejects --cookie-matchers when --header-matchers drops
+// the Cookie matchers it would write.
+func cookieMatchingRule(cookieMatchers string, headers headerSelection) optionRule {
+	return optionRule{
+		flag:    "cookie-matchers",
+		applies: cookieMatchers == "none" || headers.selects("Cookie"),
+		hint:    "has no effect as --header-matchers leaves out Cookie; add Cookie to --header-matchers",
+	}
+}
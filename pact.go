@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type pactFile struct {
+	Consumer     pactParticipant   `json:"consumer"`
+	Provider     pactParticipant   `json:"provider"`
+	Interactions []pactInteraction `json:"interactions"`
+	Metadata     struct {
+		PactSpecification struct {
+			Version string `json:"version"`
+		} `json:"pactSpecification"`
+	} `json:"metadata"`
+}
+
+type pactParticipant struct {
+	Name string `json:"name"`
+}
+
+type pactInteraction struct {
+	Description    string       `json:"description"`
+	ProviderStates []pactState  `json:"providerStates,omitempty"`
+	Request        pactRequest  `json:"request"`
+	Response       pactResponse `json:"response"`
+}
+
+type pactState struct {
+	Name string `json:"name"`
+}
+
+type pactRequest struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   map[string][]string `json:"query,omitempty"`
+	Headers map[string]string   `json:"headers,omitempty"`
+	Body    interface{}         `json:"body,omitempty"`
+}
+
+type pactResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`
+}
+
+// renderPact emits a Pact v3 contract for the simulation. A Pact file
+// describes exactly one provider, so the pairs must all share a destination.
+// Provider states are inferred from the recording order: once a write
+// (POST/PUT/PATCH/DELETE) has been seen, later interactions are given the
+// state "after <METHOD> <path>" of the most recent write.
+func renderPact(sim Simulation, opts outputOptions) ([]byte, error) {
+	provider := opts.pactProvider
+	hosts := map[string]bool{}
+	for _, pair := range sim.Data.Pairs {
+		hosts[exactValue(pair.Request.Destination)] = true
+	}
+	if len(hosts) > 1 {
+		return nil, fmt.Errorf("pact output covers a single provider but the capture has %d hosts; restrict it with --host", len(hosts))
+	}
+	if provider == "" {
+		for host := range hosts {
+			provider = host
+		}
+	}
+
+	var pact pactFile
+	pact.Consumer.Name = opts.pactConsumer
+	pact.Provider.Name = provider
+	pact.Metadata.PactSpecification.Version = "3.0.0"
+	pact.Interactions = []pactInteraction{}
+
+	seen := map[string]int{}
+	var state string
+	for _, pair := range sim.Data.Pairs {
+		method := exactValue(pair.Request.Method)
+		path := exactValue(pair.Request.Path)
+
+		i := pactInteraction{
+			Request: pactRequest{
+				Method: method,
+				Path:   path,
+				Body:   pactBody(exactValue(pair.Request.Body), firstMatcherValue(pair.Request.Headers["Content-Type"])),
+			},
+			Response: pactResponse{
+				Status: pair.Response.Status,
+				Body:   pactBody(pair.Response.Body, firstValue(pair.Response.Headers["Content-Type"])),
+			},
+		}
+		if len(pair.Request.Query) > 0 {
+			i.Request.Query = map[string][]string{}
+			// Repeated parameters are joined with ";" in the query
+			// matchers; Pact lists each value.
+			for k, matchers := range pair.Request.Query {
+				i.Request.Query[k] = strings.Split(exactValue(matchers), ";")
+			}
+		}
+		if ct := firstMatcherValue(pair.Request.Headers["Content-Type"]); ct != "" {
+			i.Request.Headers = map[string]string{"Content-Type": ct}
+		}
+		if len(pair.Response.Headers) > 0 {
+			i.Response.Headers = map[string]string{}
+			for k, vs := range pair.Response.Headers {
+				i.Response.Headers[k] = strings.Join(vs, ", ")
+			}
+		}
+		if state != "" {
+			i.ProviderStates = []pactState{{Name: state}}
+		}
+
+		description := method + " " + path
+		if len(i.Request.Query) > 0 {
+			description += "?" + url.Values(i.Request.Query).Encode()
+		}
+		key := description + "|" + state
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			description = fmt.Sprintf("%s #%d", description, n)
+		}
+		i.Description = description
+
+		pact.Interactions = append(pact.Interactions, i)
+
+		switch method {
+		case "POST", "PUT", "PATCH", "DELETE":
+			state = "after " + method + " " + path
+		}
+	}
+
+	return json.MarshalIndent(pact, "", "  ")
+}
+
+// pactBody embeds JSON bodies as structured values so Pact compares them
+// field by field, and passes anything else through as a string.
+func pactBody(body, contentType string) interface{} {
+	if body == "" {
+		return nil
+	}
+	if strings.Contains(contentType, "json") {
+		var v interface{}
+		if json.Unmarshal([]byte(body), &v) == nil {
+			return v
+		}
+	}
+	return body
+}
+
+func firstMatcherValue(matchers []FieldMatcher) string {
+	if len(matchers) == 0 {
+		return ""
+	}
+	return matchers[0].Value
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// selectPages returns the IDs of the HAR pages a --page value selects: the
+// page with that ID or, failing that, every page whose title matches it as
+// a regular expression. Browsers title pages with their URL, so a value
+// like /checkout picks out a navigation.
+func selectPages(pages []Page, value string) (map[string]bool, error) {
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("the HAR records no pages")
+	}
+	selected := map[string]bool{}
+	for _, p := range pages {
+		if p.ID == value {
+			selected[p.ID] = true
+			return selected, nil
+		}
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a page ID nor a valid title regex: %v", value, err)
+	}
+	var available []string
+	for _, p := range pages {
+		if re.MatchString(p.Title) {
+			selected[p.ID] = true
+		}
+		available = append(available, fmt.Sprintf("%s: %s", p.ID, p.Title))
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no page ID or title matches %q; pages are:\n  %s", value, strings.Join(available, "\n  "))
+	}
+	return selected, nil
+}
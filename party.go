@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+// isFirstParty reports whether host belongs to one of the first-party
+// domains, either exactly or as a subdomain.
+func isFirstParty(host string, domains []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func partyLabel(firstParty bool) string {
+	if firstParty {
+		return "first-party"
+	}
+	return "third-party"
+}
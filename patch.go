@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchOp is one RFC 6902 operation. Value is raw JSON so that null, false
+// and zero values survive encoding.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// simulationPatch builds a JSON Patch that turns old into new. Pairs are
+// matched by request matchers (the nth duplicate with the nth duplicate);
+// changed pairs are patched field by field, added pairs are appended and
+// removed pairs deleted last in descending order. It also reports whether
+// the relative order of matched pairs differs, which a patch of this shape
+// doesn't reproduce.
+func simulationPatch(old, new Simulation) ([]patchOp, bool, error) {
+	oldDoc, newDoc := toGeneric(old), toGeneric(new)
+	oldPairs := genericPairs(oldDoc)
+	newPairs := genericPairs(newDoc)
+
+	positions := map[string][]int{}
+	for j, p := range new.Data.Pairs {
+		key := requestKey(p)
+		positions[key] = append(positions[key], j)
+	}
+
+	var changes, removals []jsonChange
+	matched := map[int]bool{}
+	reordered := false
+	last := -1
+	for i, p := range old.Data.Pairs {
+		key := requestKey(p)
+		if len(positions[key]) == 0 {
+			removals = append(removals, jsonChange{Op: "remove", Path: "/data/pairs/" + strconv.Itoa(i)})
+			continue
+		}
+		j := positions[key][0]
+		positions[key] = positions[key][1:]
+		matched[j] = true
+		if j < last {
+			reordered = true
+		}
+		last = j
+		for _, c := range diffJSON(oldPairs[i], newPairs[j], nil) {
+			c.Path = "/data/pairs/" + strconv.Itoa(i) + c.Path
+			changes = append(changes, c)
+		}
+	}
+	for j := range new.Data.Pairs {
+		if !matched[j] {
+			changes = append(changes, jsonChange{Op: "add", Path: "/data/pairs/-", Value: newPairs[j]})
+		}
+	}
+
+	// Everything outside the pairs (global actions, meta) is diffed as-is.
+	oldRest, newRest := withoutPairs(oldDoc), withoutPairs(newDoc)
+	changes = append(changes, diffJSON(oldRest, newRest, nil)...)
+
+	for i := len(removals) - 1; i >= 0; i-- {
+		changes = append(changes, removals[i])
+	}
+
+	ops := make([]patchOp, 0, len(changes))
+	for _, c := range changes {
+		op := patchOp{Op: c.Op, Path: c.Path}
+		if c.Op != "remove" {
+			v, err := json.Marshal(c.Value)
+			if err != nil {
+				return nil, false, err
+			}
+			op.Value = v
+		}
+		ops = append(ops, op)
+	}
+	return ops, reordered, nil
+}
+
+func toGeneric(v interface{}) interface{} {
+	data, _ := json.Marshal(v)
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func genericPairs(doc interface{}) []interface{} {
+	data, _ := doc.(map[string]interface{})["data"].(map[string]interface{})
+	pairs, _ := data["pairs"].([]interface{})
+	return pairs
+}
+
+// withoutPairs returns a shallow copy of doc with data.pairs emptied.
+func withoutPairs(doc interface{}) interface{} {
+	out := map[string]interface{}{}
+	for k, v := range doc.(map[string]interface{}) {
+		out[k] = v
+	}
+	if data, ok := out["data"].(map[string]interface{}); ok {
+		copied := map[string]interface{}{}
+		for k, v := range data {
+			copied[k] = v
+		}
+		delete(copied, "pairs")
+		out["data"] = copied
+	}
+	return out
+}
+
+func runApplyPatch(args []string) {
+	flags := flag.NewFlagSet("apply-patch", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file to patch")
+	patchFile := flags.String("patch", "", "Path to the RFC 6902 JSON Patch file")
+	outputFile := flags.String("output", "", "Where to write the patched simulation (defaults to editing --input in place)")
+	flags.Parse(args)
+
+	if *inputFile == "" || *patchFile == "" {
+		log.Fatal("apply-patch needs --input and --patch")
+	}
+	if *outputFile == "" {
+		*outputFile = *inputFile
+	}
+
+	data, err := readSimulationJSON(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to read file: %v", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+	patchData, err := readSimulationJSON(*patchFile)
+	if err != nil {
+		log.Fatalf("Failed to read patch: %v", err)
+	}
+	var ops []patchOp
+	if err := json.Unmarshal(patchData, &ops); err != nil {
+		log.Fatalf("Failed to parse patch: %v", err)
+	}
+
+	for i, op := range ops {
+		if doc, err = applyPatchOp(doc, op); err != nil {
+			log.Fatalf("Failed to apply patch operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+
+	// The patched document is only decoded to check it is a simulation;
+	// it is written as patched so fields the tool doesn't model, such as
+	// matcher config and templating data, survive.
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err == nil {
+		var sim Simulation
+		if err := json.Unmarshal(out, &sim); err != nil {
+			log.Fatalf("Patched document is not a simulation: %v", err)
+		}
+	}
+	if err == nil && isYAMLPath(*outputFile) {
+		out, err = jsonToYAML(out)
+	}
+	if err != nil {
+		log.Fatalf("Failed to serialize simulation: %v", err)
+	}
+	if err := writeOutput(*outputFile, out); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+	log.Printf("Applied %d operation(s)", len(ops))
+}
+
+// applyPatchOp applies one add, remove, replace or test operation to a
+// decoded JSON document and returns the updated document.
+func applyPatchOp(doc interface{}, op patchOp) (interface{}, error) {
+	var value interface{}
+	if op.Op != "remove" {
+		if op.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+	if op.Path == "" {
+		switch op.Op {
+		case "replace", "add":
+			return value, nil
+		case "test":
+			if !reflect.DeepEqual(doc, value) {
+				return nil, fmt.Errorf("test failed")
+			}
+			return doc, nil
+		}
+		return nil, fmt.Errorf("cannot %s the whole document", op.Op)
+	}
+	if !strings.HasPrefix(op.Path, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+
+	segments := strings.Split(op.Path[1:], "/")
+	for i, s := range segments {
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+	}
+	parent := doc
+	for _, s := range segments[:len(segments)-1] {
+		next, err := pointerChild(parent, s)
+		if err != nil {
+			return nil, err
+		}
+		parent = next
+	}
+	last := segments[len(segments)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		current, exists := container[last]
+		switch op.Op {
+		case "add":
+			container[last] = value
+		case "replace", "remove":
+			if !exists {
+				return nil, fmt.Errorf("%q does not exist", last)
+			}
+			if op.Op == "remove" {
+				delete(container, last)
+			} else {
+				container[last] = value
+			}
+		case "test":
+			if !exists || !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("test failed")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported operation %q", op.Op)
+		}
+		return doc, nil
+	case []interface{}:
+		if op.Op == "add" && last == "-" {
+			return setPointer(doc, segments[:len(segments)-1], append(container, value))
+		}
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i > len(container) || (i == len(container) && op.Op != "add") {
+			return nil, fmt.Errorf("index %q out of range", last)
+		}
+		switch op.Op {
+		case "add":
+			grown := append(container[:i:i], append([]interface{}{value}, container[i:]...)...)
+			return setPointer(doc, segments[:len(segments)-1], grown)
+		case "remove":
+			shrunk := append(container[:i:i], container[i+1:]...)
+			return setPointer(doc, segments[:len(segments)-1], shrunk)
+		case "replace":
+			container[i] = value
+		case "test":
+			if !reflect.DeepEqual(container[i], value) {
+				return nil, fmt.Errorf("test failed")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported operation %q", op.Op)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("parent of %q is not an object or array", last)
+}
+
+func pointerChild(v interface{}, segment string) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		child, ok := t[segment]
+		if !ok {
+			return nil, fmt.Errorf("%q does not exist", segment)
+		}
+		return child, nil
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err != nil || i < 0 || i >= len(t) {
+			return nil, fmt.Errorf("index %q out of range", segment)
+		}
+		return t[i], nil
+	}
+	return nil, fmt.Errorf("cannot descend into %q", segment)
+}
+
+// setPointer replaces the value at segments, used when an array changes
+// length and its new slice has to be stored in the parent.
+func setPointer(doc interface{}, segments []string, value interface{}) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	parent := doc
+	for _, s := range segments[:len(segments)-1] {
+		next, err := pointerChild(parent, s)
+		if err != nil {
+			return nil, err
+		}
+		parent = next
+	}
+	last := segments[len(segments)-1]
+	switch t := parent.(type) {
+	case map[string]interface{}:
+		t[last] = value
+	case []interface{}:
+		i, _ := strconv.Atoi(last)
+		t[i] = value
+	}
+	return doc, nil
+}
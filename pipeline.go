@@ -0,0 +1,689 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// convert and watch turn HAR entries into pairs through the same
+// entryConverter, configured by the same per-entry flags, so an entry
+// becomes the same pair whichever command converts it. What depends on the
+// rest of the capture, such as sessions, redirect chains and delay
+// fitting, stays in convert and reaches the converter through the fields
+// watch leaves unset.
+
+// entryOptions are the flags that decide how each entry is filtered and
+// converted on its own.
+type entryOptions struct {
+	sizeLimit           int
+	noBodies            bool
+	responseHeaders     string
+	skipResponseHeaders string
+	trailers            string
+	byteExact           bool
+	headerMatchers      string
+	ignoreNonText       bool
+	cookieMatchers      string
+	setCookies          bool
+	sessionCookies      string
+	sessionCookieNames  string
+	bodyMatching        string
+	allowedTypes        string
+	restrictHost        string
+	firstParty          string
+	onlyParty           string
+	vendors             string
+	stripSigs           bool
+	commentLabels       bool
+	resourceTypes       string
+	skipCached          bool
+	bracketParams       string
+	tracingHeaders      string
+	keepCharset         bool
+	encodingHeaders     string
+	aborted             string
+	onlyCommented       bool
+	provenance          bool
+	author              string
+	streamLabels        bool
+	delaysFromHAR       bool
+	ttfbDelay           bool
+	slimHTML            bool
+	templateConfig      string
+	only                string
+	mapPort             string
+	baseURL             string
+	idn                 string
+
+	// Set by parse from the flags above.
+	allowedContentTypes []string
+	keptTypes           map[string]bool
+	firstPartyDomains   []string
+	profiles            []func(*Pair) bool
+	templateRules       []templateRule
+	skippedHeaders      map[string]bool
+	ports               map[string]string
+	onlyClasses         map[string]bool
+	base                *url.URL
+	matchedHeaders      headerSelection
+	cookies             cookiePolicy
+}
+
+// addEntryFlags registers the per-entry flags on flags.
+func addEntryFlags(flags *flag.FlagSet) *entryOptions {
+	o := &entryOptions{}
+	flags.IntVar(&o.sizeLimit, "max-body-bytes", 0, "Optional maximum body size (in bytes). Larger responses will be replaced with an empty body.")
+	flags.BoolVar(&o.noBodies, "no-bodies", false, "Omit response bodies, keeping statuses and headers; bodies are then never decoded")
+	flags.StringVar(&o.responseHeaders, "response-headers", "content-type", "Response headers carried into the simulation: content-type, or all recorded headers except --skip-response-headers")
+	flags.StringVar(&o.skipResponseHeaders, "skip-response-headers", defaultSkippedResponseHeaders, "With --response-headers=all, comma-separated headers to leave out")
+	flags.StringVar(&o.trailers, "trailers", "report", "What to do with response trailers, which Hoverfly can't send: report, or headers to keep them as response headers")
+	flags.BoolVar(&o.byteExact, "byte-exact", false, "Reproduce response bodies byte-for-byte (base64 and non-UTF-8 bodies become encodedBody); fails if any body can't be")
+	flags.StringVar(&o.headerMatchers, "header-matchers", "all", "Request headers emitted as exact header matchers: all, none, or a comma-separated list of names (e.g. Accept,X-Api-Version)")
+	flags.BoolVar(&o.ignoreNonText, "ignore-non-text", false, "If set, non-textual content types will be excluded entirely from the simulation")
+	flags.StringVar(&o.cookieMatchers, "cookie-matchers", "header", "How request cookies are matched: header (the Cookie header exactly), each (every cookie on its own, in any order) or none")
+	flags.BoolVar(&o.setCookies, "set-cookies", false, "Rebuild Set-Cookie response headers from the HAR response cookies")
+	flags.StringVar(&o.sessionCookies, "session-cookies", "keep", "What to do with session cookies in matchers and Set-Cookie headers: keep or strip")
+	flags.StringVar(&o.sessionCookieNames, "session-cookie-names", defaultSessionCookies, "Comma-separated names, as globs, of the cookies --session-cookies applies to")
+	flags.StringVar(&o.bodyMatching, "body-matching", "exact", "How recorded request bodies are matched: exact, lenient (json matcher for JSON bodies) or none")
+	flags.StringVar(&o.allowedTypes, "allowed-content-types", "json,xml,text/html,text/javascript", "Comma-separated list of MIME substrings considered text-based")
+	flags.StringVar(&o.restrictHost, "host", "", "Restrict to entries for this destination host only")
+	flags.StringVar(&o.firstParty, "first-party", "", "Comma-separated first-party domains; pairs are labelled first-party or third-party")
+	flags.StringVar(&o.onlyParty, "only-party", "", "With --first-party, keep only first or third party entries")
+	flags.StringVar(&o.vendors, "vendor-profiles", "", "Comma-separated vendor profiles that generalise signed requests: "+vendorProfileNames())
+	flags.BoolVar(&o.stripSigs, "strip-signatures", false, "Drop request signature headers and query parameters (SigV4, HMAC, presigned URLs) from matchers and report affected pairs")
+	flags.BoolVar(&o.commentLabels, "comment-labels", false, "Carry HAR entry and page comments into pair labels (comment:<text>, page-comment:<text>)")
+	flags.StringVar(&o.resourceTypes, "resource-type", "", "Comma-separated Chrome _resourceType values to keep, e.g. xhr,fetch,document; entries without one are kept")
+	flags.BoolVar(&o.skipCached, "skip-cached", false, "Skip entries the browser served from its disk or memory cache instead of the network")
+	flags.StringVar(&o.bracketParams, "bracket-params", "opaque", "Bracketed query parameters such as a[]=1&a[]=2: opaque matches lists in recorded order, structured in any order")
+	flags.StringVar(&o.tracingHeaders, "tracing-headers", "strip", "Tracing headers such as traceparent and X-B3-TraceId: strip their matchers, echo to also template them back into responses that returned them, or keep")
+	flags.BoolVar(&o.keepCharset, "keep-charset", false, "Serve response bodies in their declared charset instead of transcoding them to UTF-8")
+	flags.StringVar(&o.encodingHeaders, "encoding-headers", "strip", "Accept-Encoding request matchers and Content-Encoding response headers: strip, since Hoverfly serves bodies decoded, or keep")
+	flags.StringVar(&o.aborted, "aborted", "report", "What to do with entries that got no response (status 0, Chrome's _error): report, skip, or 504 to replay them as 504 Gateway Timeout")
+	flags.BoolVar(&o.onlyCommented, "only-commented", false, "Only convert entries that have a HAR comment")
+	flags.BoolVar(&o.provenance, "provenance", false, "Label pairs with their source HAR file (source:<file>) and the day they were recorded (verified:<date>) for blame and prune")
+	flags.StringVar(&o.author, "author", "", "With --provenance, also label pairs with author:<name>")
+	flags.BoolVar(&o.streamLabels, "stream-labels", false, "Label pairs with transfer:chunked or transfer:stream and their recorded time to first byte (ttfb:<ms>)")
+	flags.BoolVar(&o.delaysFromHAR, "delays-from-har", false, "Set each pair's fixedDelay to its entry's recorded time, rounded to the millisecond and clamped to a minute")
+	flags.BoolVar(&o.ttfbDelay, "ttfb-delay", false, "Set each pair's fixedDelay to its recorded time to first byte (HAR timings.wait)")
+	flags.BoolVar(&o.slimHTML, "slim-html", false, "Empty inline scripts, drop analytics tags and base64 data URI payloads from HTML responses, keeping their structure")
+	flags.StringVar(&o.templateConfig, "template-config", "", "JSON/YAML file of rules enabling response templating and substitutions for selected endpoints")
+	flags.StringVar(&o.only, "only", "", "Comma-separated entry classes to keep: api, asset, tracking (scored from content type, URL and payload)")
+	flags.StringVar(&o.mapPort, "map-port", "", "Comma-separated from=to port rewrites for destinations, e.g. 8443=443,3000=80")
+	flags.StringVar(&o.baseURL, "base-url", "", "Resolve relative request URLs against this URL when their page's URL isn't recorded")
+	flags.StringVar(&o.idn, "idn", "punycode", "Form internationalised hosts are normalised to in destination matchers: punycode, unicode or keep")
+	return o
+}
+
+// rules returns the checkOptions rules of the per-entry flags.
+func (o *entryOptions) rules() []optionRule {
+	return []optionRule{
+		{"author", o.provenance, "only applies with --provenance, whose source:<file> label it goes with"},
+		{"skip-response-headers", o.responseHeaders == "all", "only applies with --response-headers=all"},
+		{"session-cookie-names", o.sessionCookies == "strip", "only applies with --session-cookies=strip"},
+		cookieMatchingRule(o.cookieMatchers, parseHeaderSelection(o.headerMatchers)),
+	}
+}
+
+// parse validates the per-entry flags, failing the run on bad values, and
+// fills in the fields derived from them.
+func (o *entryOptions) parse() {
+	var err error
+	o.allowedContentTypes = strings.Split(o.allowedTypes, ",")
+	o.matchedHeaders = parseHeaderSelection(o.headerMatchers)
+	if o.keptTypes, err = parseResourceTypes(o.resourceTypes); err != nil {
+		fatalf("Invalid --resource-type: %v", err)
+	}
+	o.firstPartyDomains = splitList(o.firstParty)
+	if o.onlyParty != "" {
+		if o.onlyParty != "first" && o.onlyParty != "third" {
+			fatalf("Unknown --only-party %q: expected first or third", o.onlyParty)
+		}
+		if len(o.firstPartyDomains) == 0 {
+			fatal("--only-party requires --first-party domains")
+		}
+	}
+
+	for _, name := range splitList(o.vendors) {
+		profile, ok := vendorProfiles[name]
+		if !ok {
+			fatalf("Unknown vendor profile %q: expected one of %s", name, vendorProfileNames())
+		}
+		o.profiles = append(o.profiles, profile)
+	}
+
+	if o.templateConfig != "" {
+		if o.templateRules, err = readTemplateRules(o.templateConfig); err != nil {
+			fatalf("Failed to read template config: %v", err)
+		}
+	}
+
+	if o.responseHeaders != "content-type" && o.responseHeaders != "all" {
+		fatalf("Unknown --response-headers %q: expected content-type or all", o.responseHeaders)
+	}
+	o.skippedHeaders = headerNameSet(o.skipResponseHeaders)
+	if !containsString(encodingHeaderModes, o.encodingHeaders) {
+		fatalf("Unknown --encoding-headers %q: expected strip or keep", o.encodingHeaders)
+	}
+	if !containsString(bracketParamModes, o.bracketParams) {
+		fatalf("Unknown --bracket-params %q: expected one of %s", o.bracketParams, strings.Join(bracketParamModes, ", "))
+	}
+	if !containsString(tracingHeaderModes, o.tracingHeaders) {
+		fatalf("Unknown --tracing-headers %q: expected one of %s", o.tracingHeaders, strings.Join(tracingHeaderModes, ", "))
+	}
+	if !containsString(abortedModes, o.aborted) {
+		fatalf("Unknown --aborted %q: expected one of %s", o.aborted, strings.Join(abortedModes, ", "))
+	}
+	if o.trailers != "report" && o.trailers != "headers" {
+		fatalf("Unknown --trailers %q: expected report or headers", o.trailers)
+	}
+	if o.byteExact && (o.sizeLimit > 0 || o.noBodies || o.templateConfig != "" || o.slimHTML) {
+		fatal("--byte-exact can't be combined with --max-body-bytes, --no-bodies, --slim-html or --template-config, which all change bodies")
+	}
+	if o.ports, err = parsePortMap(o.mapPort); err != nil {
+		fatalf("Invalid --map-port: %v", err)
+	}
+
+	o.onlyClasses = map[string]bool{}
+	for _, kind := range splitList(o.only) {
+		if kind != classAPI && kind != classAsset && kind != classTracking {
+			fatalf("Unknown --only class %q: expected api, asset or tracking", kind)
+		}
+		o.onlyClasses[kind] = true
+	}
+
+	if !containsString(idnForms, o.idn) {
+		fatalf("Unknown --idn %q: expected one of %s", o.idn, strings.Join(idnForms, ", "))
+	}
+	o.restrictHost = normaliseHost(o.restrictHost, o.idn)
+	if o.base, err = parseBaseURL(o.baseURL); err != nil {
+		fatalf("Invalid --base-url: %v", err)
+	}
+
+	if !containsString(bodyMatchingModes, o.bodyMatching) {
+		fatalf("Unknown --body-matching %q: expected one of %s", o.bodyMatching, strings.Join(bodyMatchingModes, ", "))
+	}
+	if !containsString(cookieMatchModes, o.cookieMatchers) {
+		fatalf("Unknown --cookie-matchers %q: expected one of %s", o.cookieMatchers, strings.Join(cookieMatchModes, ", "))
+	}
+	if o.sessionCookies != "keep" && o.sessionCookies != "strip" {
+		fatalf("Unknown --session-cookies %q: expected keep or strip", o.sessionCookies)
+	}
+	o.cookies = cookiePolicy{matchers: o.cookieMatchers, setCookies: o.setCookies, stripSessions: o.sessionCookies == "strip", sessionNames: splitList(o.sessionCookieNames)}
+}
+
+// entryReports collects what the converter did to the entries it was given,
+// for convert's reports.
+type entryReports struct {
+	untyped              int
+	skippedCached        map[string]int
+	sockets              webSockets
+	abortedEntries       []string
+	resolvedURLs         int
+	repairedURLs         []urlProblem
+	invalidURLs          []urlProblem
+	flattenedRedirects   int
+	notModifiedConverted int
+	decoded              map[string]int
+	undecoded            []string
+	transcoded           map[string]int
+	untranscoded         []string
+	sniffed              sniffedBodies
+	varied               map[string]int
+	strippedTracing      map[string]int
+	echoedTracing        map[string]int
+	unorderedParams      map[string]int
+	orderedParams        map[string]int
+	strippedCookies      map[string]int
+	sessionPairs         int
+	strippedEncoding     struct{ accept, content int }
+	downgraded           int
+	droppedHeaders       map[string]int
+	pushed               []string
+	inexact              []string
+	trailerPairs         []trailerPair
+	relaxed              []relaxedPair
+	violations           []string
+	slimmed              htmlSlimming
+	templateSyntax       []string
+}
+
+// entryConverter converts HAR entries with a set of entryOptions. Entries
+// go through prepare, which filters them and decodes their bodies, and
+// then build, which makes the pair.
+type entryConverter struct {
+	*entryOptions
+	entryReports
+
+	// source is the HAR file named in --provenance labels.
+	source       string
+	pageBases    map[string]*url.URL
+	pageComments map[string]string
+
+	annotations *annotator
+	trace       *entryTracer
+	rejects     *rejectedEntries
+
+	// Set by convert only. bodies holds the raw entries whose response
+	// bodies prepare loads, since convert decodes the HAR lazily; entries
+	// lets redirects and 304s be answered with the response of another
+	// entry.
+	bodies          []json.RawMessage
+	entries         []Entry
+	pages           map[string]bool
+	redirectFinals  map[int]int
+	notModifiedFrom map[int]int
+	notModified     string
+	classifyBodies  bool
+	refiner         *openapiRefiner
+	schemaRules     []schemaRule
+	schemaLevel     string
+	inlined         *dataURIs
+	connections     map[string]bool
+	captureLabels   func(i int) []string
+}
+
+func newEntryConverter(opts *entryOptions, source string) *entryConverter {
+	c := &entryConverter{entryOptions: opts, source: source}
+	c.skippedCached = map[string]int{}
+	c.decoded, c.transcoded = map[string]int{}, map[string]int{}
+	c.varied = map[string]int{}
+	c.strippedTracing, c.echoedTracing = map[string]int{}, map[string]int{}
+	c.unorderedParams, c.orderedParams = map[string]int{}, map[string]int{}
+	c.strippedCookies = map[string]int{}
+	c.droppedHeaders = map[string]int{}
+	return c
+}
+
+// setPages takes the page URLs relative entry URLs resolve against, and
+// the page comments --comment-labels carries, from the HAR's pages.
+func (c *entryConverter) setPages(pages []Page) {
+	c.pageBases = pageBaseURLs(pages)
+	c.pageComments = map[string]string{}
+	for _, page := range pages {
+		if page.Comment != "" {
+			c.pageComments[page.ID] = page.Comment
+		}
+	}
+}
+
+// skip records that entry i was filtered out.
+func (c *entryConverter) skip(i int, reason, detail string) {
+	c.rejects.add(i, reason, detail)
+	if detail != "" {
+		reason += ": " + detail
+	}
+	c.trace.step(i, "skipped (%s)", reason)
+}
+
+// preparedEntry is an entry that passed every filter, with its URL
+// resolved and its response body loaded and decoded.
+type preparedEntry struct {
+	entry        Entry
+	url          *url.URL
+	class        entryClass
+	firstParty   bool
+	abortReason  string
+	stillEncoded []string
+}
+
+// prepare filters entry i and readies it for build, reporting false if the
+// entry was skipped.
+func (c *entryConverter) prepare(i int, entry Entry) (preparedEntry, bool) {
+	c.trace.step(i, "entry: %s %s", entry.Request.Method, entry.Request.URL)
+	if c.pages != nil && !c.pages[entry.Pageref] {
+		c.skip(i, "page", "pageref "+strconv.Quote(entry.Pageref))
+		return preparedEntry{}, false
+	}
+	if c.keptTypes != nil {
+		if entry.ResourceType == "" {
+			c.untyped++
+		} else if !c.keptTypes[strings.ToLower(entry.ResourceType)] {
+			c.skip(i, "resource-type", entry.ResourceType)
+			return preparedEntry{}, false
+		}
+	}
+	if c.skipCached {
+		if reason := cachedReason(entry); reason != "" {
+			c.skippedCached[reason]++
+			c.skip(i, "cached", reason)
+			return preparedEntry{}, false
+		}
+	}
+	if isWebSocket(entry) {
+		c.sockets.add(i, entry)
+		c.annotations.entry("warning", i, "%s opened a WebSocket, which Hoverfly can't simulate; entry skipped", entry.Request.URL)
+		c.skip(i, "websocket", fmt.Sprintf("%d message(s)", len(entry.WebSocketMessages)))
+		return preparedEntry{}, false
+	}
+	abortReason := abortedReason(entry)
+	if abortReason != "" {
+		c.abortedEntries = append(c.abortedEntries, fmt.Sprintf("%s %s: %s", entry.Request.Method, entry.Request.URL, abortReason))
+		if c.aborted == "skip" {
+			c.skip(i, "aborted", abortReason)
+			return preparedEntry{}, false
+		}
+		c.annotations.entry("warning", i, "%s %s got no response during recording (%s)", entry.Request.Method, entry.Request.URL, abortReason)
+	}
+	entryBase := c.base
+	if u, ok := c.pageBases[entry.Pageref]; ok {
+		entryBase = u
+	}
+	rawURL, resolved := resolveURL(entry.Request.URL, entryBase)
+	reqURL, repairs, err := repairURL(rawURL)
+	if err == nil && entry.Request.Method == "" {
+		err = fmt.Errorf("no request method")
+	}
+	if err != nil {
+		c.invalidURLs = append(c.invalidURLs, urlProblem{i, entry.Request.URL, err.Error()})
+		c.annotations.entry("error", i, "invalid request URL %q: %v; entry skipped", entry.Request.URL, err)
+		c.skip(i, "invalid-url", err.Error())
+		return preparedEntry{}, false
+	}
+	if resolved {
+		c.resolvedURLs++
+		entry.Request.URL = reqURL.String()
+		c.trace.step(i, "resolved relative URL to %s", entry.Request.URL)
+	}
+	if len(repairs) > 0 {
+		c.trace.step(i, "repaired URL: %s", strings.Join(repairs, ", "))
+		c.repairedURLs = append(c.repairedURLs, urlProblem{i, entry.Request.URL, strings.Join(repairs, ", ")})
+		c.annotations.entry("warning", i, "repaired request URL %q: %s", entry.Request.URL, strings.Join(repairs, ", "))
+		entry.Request.URL = reqURL.String()
+	}
+	normaliseEntryHost(&entry, reqURL, c.idn)
+	mapEntryPort(&entry, reqURL, c.ports)
+	req := entry.Request
+	res := entry.Response
+
+	if c.restrictHost != "" {
+		if !strings.Contains(req.URL, c.restrictHost) {
+			c.skip(i, "host", reqURL.Host)
+			return preparedEntry{}, false
+		}
+	}
+	bodyEntry := i
+	if final, ok := c.redirectFinals[i]; ok {
+		status := entry.Response.Status
+		entry.Response = c.entries[final].Response
+		res, bodyEntry = entry.Response, final
+		c.flattenedRedirects++
+		c.trace.step(i, "--flatten-redirects: %d redirected to entry %d, whose %d response is used", status, final, res.Status)
+	}
+	if res.Status == 304 {
+		if source, ok := c.notModifiedFrom[i]; ok {
+			entry.Response = c.entries[source].Response
+			res, bodyEntry = entry.Response, source
+			c.notModifiedConverted++
+			c.trace.step(i, "--not-modified backfill: served with the 200 of entry %d", source)
+		} else if c.notModified == "200" {
+			entry.Response.Status = 200
+			res = entry.Response
+			c.notModifiedConverted++
+			c.trace.step(i, "--not-modified 200: served as 200")
+		}
+	}
+
+	if c.onlyCommented && entry.Comment == "" {
+		c.skip(i, "only-commented", "")
+		return preparedEntry{}, false
+	}
+
+	firstPartyEntry := isFirstParty(reqURL.Host, c.firstPartyDomains)
+	if c.onlyParty != "" && (c.onlyParty == "first") != firstPartyEntry {
+		c.skip(i, "only-party", partyLabel(firstPartyEntry))
+		return preparedEntry{}, false
+	}
+
+	isText := isTextContent(res.Content.MimeType, c.allowedContentTypes)
+	if c.ignoreNonText && !isText {
+		c.skip(i, "non-text", res.Content.MimeType)
+		return preparedEntry{}, false
+	}
+
+	// Classification looks at the body, so it is loaded for --only and
+	// --summarise even when --no-bodies drops it from the output. Watch
+	// decodes entries whole, so has no bodies to load.
+	if c.bodies != nil && (!c.noBodies || len(c.onlyClasses) > 0 || c.classifyBodies) {
+		if err := loadResponseBody(c.bodies[bodyEntry], &entry); err != nil {
+			fatalf("Failed to parse HAR: entry %d: %v", i, err)
+		}
+		res = entry.Response
+	}
+	var stillEncoded []string
+	if !c.noBodies {
+		codings, err := decodeResponseBody(&entry.Response)
+		if err != nil {
+			stillEncoded = codings
+			c.undecoded = append(c.undecoded, fmt.Sprintf("%s %s: %v", req.Method, req.URL, err))
+			c.annotations.entry("warning", i, "%s %s: can't decompress response body: %v; served with its Content-Encoding", req.Method, req.URL, err)
+		}
+		for _, coding := range codings {
+			if err == nil {
+				c.decoded[coding]++
+			}
+		}
+		if err != nil {
+			c.trace.step(i, "can't decompress %s body: %v; kept encoded", strings.Join(codings, ", "), err)
+		} else if len(codings) > 0 {
+			c.trace.step(i, "decompressed %s body", strings.Join(codings, ", "))
+		}
+		if stillEncoded == nil && !c.keepCharset && !c.byteExact {
+			if charset, err := transcodeResponseBody(&entry.Response); err != nil {
+				c.untranscoded = append(c.untranscoded, fmt.Sprintf("%s %s: %v", req.Method, req.URL, err))
+				c.annotations.entry("warning", i, "%s %s: can't transcode response body to UTF-8: %v", req.Method, req.URL, err)
+			} else if charset != "" {
+				c.transcoded[charset]++
+				c.trace.step(i, "transcoded %s body to UTF-8", charset)
+			}
+		}
+		if entry.Response.Content.Encoding == "" && looksBinary(entry.Response.Content.Text) {
+			desc := fmt.Sprintf("%s %s (%s)", req.Method, req.URL, res.Content.MimeType)
+			if c.ignoreNonText {
+				c.sniffed.skipped = append(c.sniffed.skipped, desc)
+				c.skip(i, "non-text", "binary body labelled "+res.Content.MimeType)
+				return preparedEntry{}, false
+			}
+			if body, ok := recoverBinary(entry.Response.Content.Text); ok {
+				entry.Response.Content.Text, entry.Response.Content.Encoding = body, "base64"
+				c.sniffed.recovered = append(c.sniffed.recovered, desc)
+				c.trace.step(i, "binary body stored as text recovered as base64")
+			} else {
+				entry.Response.Content.Text = ""
+				c.sniffed.emptied = append(c.sniffed.emptied, desc)
+				c.trace.step(i, "binary body stored as text was corrupted; emptied")
+				c.annotations.entry("warning", i, "%s %s: binary body stored as text was corrupted by the recorder and was emptied", req.Method, req.URL)
+			}
+		}
+	}
+
+	class := classifyEntry(entry, reqURL)
+	c.trace.step(i, "classified as %s", class.kind)
+	if len(c.onlyClasses) > 0 && !c.onlyClasses[class.kind] {
+		c.skip(i, "only", class.kind)
+		return preparedEntry{}, false
+	}
+	c.trace.step(i, "kept by every filter")
+	return preparedEntry{entry: entry, url: reqURL, class: class, firstParty: firstPartyEntry, abortReason: abortReason, stillEncoded: stillEncoded}, true
+}
+
+// build turns prepared entry i into a pair, which is to be pair index of
+// the simulation.
+func (c *entryConverter) build(i int, p preparedEntry, index int) Pair {
+	entry, reqURL := p.entry, p.url
+	req, res := entry.Request, entry.Response
+	if c.sizeLimit > 0 && len(res.Content.Text) > c.sizeLimit {
+		c.annotations.entry("warning", i, "%s %s response body of %d bytes exceeds --max-body-bytes and was emptied", req.Method, req.URL, len(res.Content.Text))
+	}
+	if c.noBodies {
+		entry.Response.Content.Text = ""
+	}
+	pair := convertEntryToPair(entry, c.sizeLimit, c.allowedContentTypes, c.bodyMatching)
+	c.trace.stage(i, "converted", pair)
+	sessionStripped := c.cookies.applyRequest(&pair, req)
+	c.trace.stage(i, "--cookie-matchers/--session-cookies", pair)
+	c.matchedHeaders.apply(&pair)
+	c.trace.stage(i, "--header-matchers", pair)
+	for _, name := range promoteVaryHeaders(&pair, req, res) {
+		c.varied[name]++
+	}
+	c.trace.stage(i, "Vary", pair)
+	if c.tracingHeaders != "keep" {
+		for _, name := range stripTracingHeaders(&pair) {
+			c.strippedTracing[name]++
+		}
+		c.trace.stage(i, "--tracing-headers", pair)
+	}
+	if c.bracketParams == "structured" {
+		unordered, tooLong := structureBracketParams(&pair)
+		for _, name := range unordered {
+			c.unorderedParams[name]++
+		}
+		for _, name := range tooLong {
+			c.orderedParams[name]++
+		}
+		c.trace.stage(i, "--bracket-params", pair)
+	}
+	if c.responseHeaders == "all" {
+		copyResponseHeaders(&pair, res.Headers, c.skippedHeaders)
+		c.trace.stage(i, "--response-headers", pair)
+	}
+	sessionStripped = append(sessionStripped, c.cookies.applyResponse(&pair, res)...)
+	c.trace.stage(i, "--set-cookies/--session-cookies", pair)
+	keepRedirectHeaders(&pair, res)
+	c.trace.stage(i, "redirect headers", pair)
+	if len(sessionStripped) > 0 {
+		c.sessionPairs++
+		for name := range stringSet(sessionStripped) {
+			c.strippedCookies[name]++
+		}
+	}
+	if c.encodingHeaders == "strip" {
+		accept, content := stripEncodingHeaders(&pair)
+		if accept {
+			c.strippedEncoding.accept++
+		}
+		if content {
+			c.strippedEncoding.content++
+		}
+		c.trace.stage(i, "--encoding-headers", pair)
+	}
+	// A body that couldn't be decompressed is served encoded, so it
+	// needs its Content-Encoding whatever --encoding-headers says.
+	if len(p.stillEncoded) > 0 {
+		pair.Response.Headers["Content-Encoding"] = []string{strings.Join(p.stillEncoded, ", ")}
+	}
+	if isMultiplexedHTTP(req.HTTPVersion) || isMultiplexedHTTP(res.HTTPVersion) {
+		c.downgraded++
+		for _, name := range downgradePair(&pair) {
+			c.droppedHeaders[strings.ToLower(name)]++
+		}
+		c.trace.stage(i, "HTTP/1.1 downgrade", pair)
+	}
+	if wasPushed(entry.WasPushed) {
+		c.pushed = append(c.pushed, fmt.Sprintf("%s %s", req.Method, req.URL))
+		c.annotations.entry("warning", i, "%s %s was an HTTP/2 server push; over HTTP/1.1 the client must request it itself", req.Method, req.URL)
+	}
+	if c.byteExact {
+		body, encoded, err := exactResponseBody(entry.Response)
+		if err != nil {
+			c.inexact = append(c.inexact, fmt.Sprintf("%s %s: %v", req.Method, req.URL, err))
+			c.annotations.entry("error", i, "%s %s: body can't be reproduced byte-for-byte: %v", req.Method, req.URL, err)
+		}
+		pair.Response.Body, pair.Response.EncodedBody = body, encoded
+		c.trace.stage(i, "--byte-exact", pair)
+	}
+	if recorded, missing := responseTrailers(entry.Response); len(recorded) > 0 || len(missing) > 0 {
+		t := trailerPair{index: index, method: req.Method, host: reqURL.Host, path: reqURL.Path, missing: missing}
+		for _, h := range recorded {
+			t.recorded = append(t.recorded, h.Name)
+		}
+		c.trailerPairs = append(c.trailerPairs, t)
+		if c.trailers == "headers" {
+			foldTrailers(&pair, recorded)
+			c.trace.stage(i, "--trailers", pair)
+		} else {
+			c.annotations.entry("notice", i, "%s %s: response trailers %s can't be replayed by Hoverfly", req.Method, req.URL, strings.Join(append(t.recorded, missing...), ","))
+		}
+	}
+	if p.abortReason != "" && c.aborted == "504" {
+		abortedResponse(&pair, p.abortReason)
+		c.trace.stage(i, "--aborted", pair)
+	}
+	for _, profile := range c.profiles {
+		profile(&pair)
+	}
+	c.trace.stage(i, "--vendor-profiles", pair)
+	if c.stripSigs {
+		if stripped := stripSignatures(&pair); len(stripped) > 0 {
+			c.relaxed = append(c.relaxed, relaxedPair{index, req.Method, reqURL.Host, reqURL.Path, stripped})
+			c.annotations.entry("notice", i, "%s %s: relaxed signature matchers %s", req.Method, req.URL, strings.Join(stripped, ","))
+			c.trace.stage(i, "--strip-signatures", pair)
+		}
+	}
+	if c.commentLabels {
+		if entry.Comment != "" {
+			pair.Labels = append(pair.Labels, "comment:"+entry.Comment)
+		}
+		if comment, ok := c.pageComments[entry.Pageref]; ok {
+			pair.Labels = append(pair.Labels, "page-comment:"+comment)
+		}
+	}
+	var entryViolations []string
+	if c.refiner != nil {
+		entryViolations = c.refiner.refine(index, &pair, entry, reqURL.Path)
+	}
+	if len(c.schemaRules) > 0 {
+		entryViolations = append(entryViolations, validateResponse(c.schemaRules, reqURL.Host, reqURL.Path, entry.Response, pair.Response.EncodedBody)...)
+	}
+	c.trace.stage(i, "--openapi", pair)
+	for _, v := range entryViolations {
+		c.violations = append(c.violations, fmt.Sprintf("%s %s: %s", req.Method, req.URL, v))
+		c.annotations.entry(c.schemaLevel, i, "%s %s: %s", req.Method, req.URL, v)
+		c.trace.step(i, "schema violation: %s", v)
+	}
+	if c.inlined != nil && c.inlined.apply(&pair, index) {
+		c.trace.stage(i, "--data-uris", pair)
+	}
+	if c.slimHTML && c.slimmed.apply(&pair) {
+		c.trace.stage(i, "--slim-html", pair)
+	}
+	applyTemplateRules(&pair, c.templateRules)
+	c.trace.stage(i, "--template-config", pair)
+	if c.tracingHeaders == "echo" {
+		for _, name := range echoTracingHeaders(&pair, req, res) {
+			c.echoedTracing[name]++
+		}
+		c.trace.stage(i, "--tracing-headers echo", pair)
+	}
+	if hasTemplateSyntax(pair.Response) {
+		c.templateSyntax = append(c.templateSyntax, fmt.Sprintf("%d %s %s%s", index, req.Method, reqURL.Host, reqURL.Path))
+		c.annotations.entry("warning", i, "%s %s: untemplated response contains {{ }}; run escape-templates before enabling templating", req.Method, req.URL)
+	}
+	if c.captureLabels != nil {
+		pair.Labels = append(pair.Labels, c.captureLabels(i)...)
+	}
+	if c.streamLabels {
+		addStreamingLabels(&pair, entry)
+	}
+	if c.ttfbDelay {
+		applyTTFBDelay(&pair, entry)
+	}
+	if c.delaysFromHAR {
+		applyRecordedDelay(&pair, entry)
+	}
+	if c.connections != nil {
+		pair.Labels = append(pair.Labels, connectionLabelsFor(entry, c.connections)...)
+	}
+	if c.provenance {
+		addProvenance(&pair, c.source, c.author)
+		addVerified(&pair, entry)
+	}
+	if len(c.firstPartyDomains) > 0 {
+		pair.Labels = append(pair.Labels, partyLabel(p.firstParty))
+	}
+	return pair
+}
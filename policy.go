@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// policyRule is one check every converted pair must pass. A rule either
+// forbids a regular expression in the selected fields or restricts
+// destinations to allowed host globs. Host, Path and Method narrow the
+// pairs it applies to, as for template rules.
+type policyRule struct {
+	Name       string   `json:"name"`
+	Host       string   `json:"host,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	Method     string   `json:"method,omitempty"`
+	Forbid     string   `json:"forbid,omitempty"`
+	In         []string `json:"in,omitempty"`
+	AllowHosts []string `json:"allowHosts,omitempty"`
+
+	forbid *regexp.Regexp
+}
+
+// policyFields are the values a forbid rule can inspect.
+var policyFields = []string{"request.path", "request.query", "request.headers", "request.body", "response.headers", "response.body", "labels"}
+
+type policyViolation struct {
+	rule    string
+	pair    int
+	request string
+	field   string
+	match   string
+}
+
+func readPolicy(path string) ([]policyRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLPath(path) {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	var rules []policyRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if (r.Forbid == "") == (len(r.AllowHosts) == 0) {
+			return nil, fmt.Errorf("%s: %s: set exactly one of forbid or allowHosts", path, r.Name)
+		}
+		if r.Forbid != "" {
+			if r.forbid, err = regexp.Compile(r.Forbid); err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, r.Name, err)
+			}
+		}
+		for _, f := range r.In {
+			if !containsString(policyFields, f) {
+				return nil, fmt.Errorf("%s: %s: unknown field %q, expected one of %s", path, r.Name, f, strings.Join(policyFields, ", "))
+			}
+		}
+	}
+	return rules, nil
+}
+
+// checkPolicy evaluates every rule against every pair.
+func checkPolicy(pairs []Pair, rules []policyRule) []policyViolation {
+	var violations []policyViolation
+	for i, p := range pairs {
+		for _, r := range rules {
+			sel := pairSelector{host: r.Host, path: r.Path, method: r.Method}
+			if !sel.matches(p) {
+				continue
+			}
+			if len(r.AllowHosts) > 0 {
+				host := exactValue(p.Request.Destination)
+				allowed := false
+				for _, pattern := range r.AllowHosts {
+					if globMatch(pattern, host) {
+						allowed = true
+						break
+					}
+				}
+				if !allowed {
+					violations = append(violations, policyViolation{r.Name, i, describeRequest(p), "request.destination", host})
+				}
+				continue
+			}
+			fields := r.In
+			if len(fields) == 0 {
+				fields = policyFields
+			}
+			for _, field := range fields {
+				for _, value := range policyValues(p, field) {
+					if m := r.forbid.FindString(value); m != "" {
+						violations = append(violations, policyViolation{r.Name, i, describeRequest(p), field, m})
+						break
+					}
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// policyValues returns the strings of a pair a forbid rule inspects for
+// field. Encoded response bodies are decoded first.
+func policyValues(p Pair, field string) []string {
+	var values []string
+	matcherValues := func(m map[string][]FieldMatcher) {
+		for k, ms := range m {
+			for _, fm := range ms {
+				values = append(values, k+"="+fm.Value)
+			}
+		}
+	}
+	switch field {
+	case "request.path":
+		for _, m := range p.Request.Path {
+			values = append(values, m.Value)
+		}
+	case "request.query":
+		matcherValues(p.Request.Query)
+	case "request.headers":
+		matcherValues(p.Request.Headers)
+	case "request.body":
+		for _, m := range p.Request.Body {
+			values = append(values, m.Value)
+		}
+	case "response.headers":
+		for k, vs := range p.Response.Headers {
+			for _, v := range vs {
+				values = append(values, k+": "+v)
+			}
+		}
+	case "response.body":
+		body := p.Response.Body
+		if p.Response.EncodedBody {
+			if decoded, err := base64.StdEncoding.DecodeString(body); err == nil {
+				body = string(decoded)
+			}
+		}
+		values = append(values, body)
+	case "labels":
+		values = append(values, p.Labels...)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func writePolicyReport(w io.Writer, violations []policyViolation) {
+	fmt.Fprintf(w, "%d policy violation(s):\n", len(violations))
+	fmt.Fprintf(w, "%-20s %-6s %-50s %-19s %s\n", "RULE", "PAIR", "REQUEST", "FIELD", "MATCH")
+	for _, v := range violations {
+		fmt.Fprintf(w, "%-20s %-6d %-50s %-19s %s\n", v.rule, v.pair, truncate(v.request, 50), v.field, truncate(v.match, 60))
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// bufferPool recycles the scratch buffers used when encoding simulations
+// and bodies, which dominate allocations on large captures.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+// putBuffer returns b to the pool. Buffers grown past 64MiB by an unusually
+// large body are dropped rather than pinned for the life of the process.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > 64<<20 {
+		return
+	}
+	bufferPool.Put(b)
+}
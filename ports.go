@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parsePortMap parses --map-port, a comma-separated list of from=to ports
+// such as 8443=443, used when a local stack was captured on development
+// ports but tests reach the services on their usual ones.
+func parsePortMap(value string) (map[string]string, error) {
+	ports := map[string]string{}
+	for _, pair := range splitList(value) {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || !validPort(from) || !validPort(to) {
+			return nil, fmt.Errorf("%q is not from=to, e.g. 8443=443", pair)
+		}
+		ports[from] = to
+	}
+	return ports, nil
+}
+
+func validPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n < 65536
+}
+
+// mapHostPort rewrites the port of host using ports. A port mapped to the
+// scheme's default is dropped, as clients leave it out of the Host header.
+func mapHostPort(host, scheme string, ports map[string]string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	to, ok := ports[port]
+	if !ok {
+		return host
+	}
+	if (scheme == "http" && to == "80") || (scheme == "https" && to == "443") {
+		if strings.Contains(name, ":") {
+			return "[" + name + "]"
+		}
+		return name
+	}
+	return net.JoinHostPort(name, to)
+}
+
+// mapEntryPort applies the port map to the request URL and Host header of
+// entry.
+func mapEntryPort(entry *Entry, u *url.URL, ports map[string]string) {
+	if len(ports) == 0 {
+		return
+	}
+	if host := mapHostPort(u.Host, u.Scheme, ports); host != u.Host {
+		u.Host = host
+		entry.Request.URL = u.String()
+	}
+	for i, h := range entry.Request.Headers {
+		if !strings.EqualFold(h.Name, "Host") && h.Name != ":authority" {
+			continue
+		}
+		if host := mapHostPort(h.Value, u.Scheme, ports); host != h.Value {
+			entry.Request.Headers = append([]HarHeader{}, entry.Request.Headers...)
+			entry.Request.Headers[i].Value = host
+		}
+	}
+}
+
+// serviceName names the split output for a destination: the host, plus
+// the port when ports distinguish services.
+func serviceName(host string, byPort bool) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = strings.Trim(host, "[]"), ""
+	}
+	name = strings.NewReplacer(":", "-", "/", "-").Replace(name)
+	if byPort && port != "" {
+		return name + "-" + port
+	}
+	return name
+}
+
+func countTrue(flags ...bool) int {
+	n := 0
+	for _, f := range flags {
+		if f {
+			n++
+		}
+	}
+	return n
+}
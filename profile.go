@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// stopProfiles stops the profiles of the running conversion. log.Fatal
+// skips deferred calls, so the conversion fails through fatal and fatalf,
+// which call it first: a run that fails still leaves its profiles.
+var stopProfiles = func() {}
+
+func fatal(v ...interface{}) {
+	stopProfiles()
+	log.Fatal(v...)
+}
+
+func fatalf(format string, v ...interface{}) {
+	stopProfiles()
+	log.Fatalf(format, v...)
+}
+
+// startProfiling begins a CPU profile when cpuPath is set and returns a
+// function that stops it and writes a heap profile to memPath when that is
+// set; calls after the first do nothing. Profiles can be inspected with go
+// tool pprof and attached to issues about slow conversions.
+func startProfiling(cpuPath, memPath string) func() {
+	var cpu *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			log.Fatalf("Failed to create CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatalf("Failed to start CPU profile: %v", err)
+		}
+		cpu = f
+	}
+	stopped := false
+	return func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if memPath != "" {
+			f, err := os.Create(memPath)
+			if err != nil {
+				log.Fatalf("Failed to create memory profile: %v", err)
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Fatalf("Failed to write memory profile: %v", err)
+			}
+		}
+	}
+}
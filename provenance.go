@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Provenance is stored in pair labels, since Hoverfly keeps labels through
+// import/export and has no other per-pair metadata.
+const (
+	sourceLabelPrefix   = "source:"
+	authorLabelPrefix   = "author:"
+	verifiedLabelPrefix = "verified:"
+)
+
+// verifiedDateLayout is the form of verified: label dates.
+const verifiedDateLayout = "2006-01-02"
+
+// addProvenance records where a pair came from unless it already carries
+// provenance from an earlier conversion or merge.
+func addProvenance(p *Pair, source, author string) {
+	if source != "" && labelValue(*p, sourceLabelPrefix) == "" {
+		p.Labels = append(p.Labels, sourceLabelPrefix+filepath.Base(source))
+	}
+	if author != "" && labelValue(*p, authorLabelPrefix) == "" {
+		p.Labels = append(p.Labels, authorLabelPrefix+author)
+	}
+}
+
+// addVerified labels p with the day its response was recorded from the
+// real service, which prune uses to drop pairs nobody has re-recorded in a
+// while. Entries without a valid startedDateTime get no date.
+func addVerified(p *Pair, entry Entry) {
+	started, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+	if err != nil {
+		return
+	}
+	p.Labels = append(p.Labels, verifiedLabelPrefix+started.UTC().Format(verifiedDateLayout))
+}
+
+// lastVerified returns the latest date among p's verified: labels, which
+// pairs merged from several captures can carry more than one of.
+func lastVerified(p Pair) (time.Time, bool) {
+	var last time.Time
+	found := false
+	for _, l := range p.Labels {
+		if !strings.HasPrefix(l, verifiedLabelPrefix) {
+			continue
+		}
+		day, err := time.Parse(verifiedDateLayout, strings.TrimPrefix(l, verifiedLabelPrefix))
+		if err != nil {
+			continue
+		}
+		if !found || day.After(last) {
+			last, found = day, true
+		}
+	}
+	return last, found
+}
+
+// labelValue returns the remainder of the first label with prefix.
+func labelValue(p Pair, prefix string) string {
+	for _, l := range p.Labels {
+		if strings.HasPrefix(l, prefix) {
+			return strings.TrimPrefix(l, prefix)
+		}
+	}
+	return ""
+}
+
+func runBlame(args []string) {
+	flags := flag.NewFlagSet("blame", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file")
+	selector := addSelectorFlags(flags)
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a simulation file with --input")
+	}
+	sim, err := readSimulation(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+
+	fmt.Printf("%-6s %-10s %-30s %-40s %-30s %-20s %s\n", "PAIR", "METHOD", "HOST", "PATH", "SOURCE", "AUTHOR", "VERIFIED")
+	for i, p := range sim.Data.Pairs {
+		if !selector.matches(p) {
+			continue
+		}
+		source := labelValue(p, sourceLabelPrefix)
+		if source == "" {
+			source = "-"
+		}
+		author := labelValue(p, authorLabelPrefix)
+		if author == "" {
+			author = "-"
+		}
+		verified := "-"
+		if day, ok := lastVerified(p); ok {
+			verified = day.Format(verifiedDateLayout)
+		}
+		fmt.Printf("%-6d %-10s %-30s %-40s %-30s %-20s %s\n", i, exactValue(p.Request.Method),
+			truncate(exactValue(p.Request.Destination), 30), truncate(exactValue(p.Request.Path), 40), truncate(source, 30), truncate(author, 20), verified)
+	}
+}
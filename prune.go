@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// pruneRule is one prune criterion: pairs it matches are removed, whatever
+// the other criteria say.
+type pruneRule struct {
+	name    string
+	matches func(Pair) bool
+	pruned  int
+}
+
+func runPrune(args []string) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file to prune")
+	outputFile := flags.String("output", "", "Path to write the pruned simulation (optional, defaults to pruning --input in place)")
+	labels := flags.String("label", "", "Comma-separated labels; pairs carrying any of them are removed")
+	hosts := flags.String("host", "", "Comma-separated hosts; pairs whose destination contains any of them are removed")
+	verifiedBefore := flags.String("verified-before", "", "Remove pairs last verified (verified:<date> labels from --provenance) before this date, e.g. 2026-01-31")
+	maxAge := flags.Int("max-age-days", 0, "Remove pairs last verified more than this many days ago")
+	unverified := flags.Bool("unverified", false, "Remove pairs with no verified:<date> label")
+	dryRun := flags.Bool("dry-run", false, "List the pairs that would be removed without writing anything")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a simulation file with --input")
+	}
+	if *verifiedBefore != "" && *maxAge > 0 {
+		log.Fatal("--verified-before and --max-age-days are mutually exclusive")
+	}
+	if *maxAge < 0 {
+		log.Fatalf("Invalid --max-age-days %d: must be 0 or more", *maxAge)
+	}
+
+	var rules []*pruneRule
+	if names := splitList(*labels); len(names) > 0 {
+		rules = append(rules, &pruneRule{name: "--label", matches: func(p Pair) bool {
+			for _, name := range names {
+				if hasLabel(p, name) {
+					return true
+				}
+			}
+			return false
+		}})
+	}
+	if names := splitList(*hosts); len(names) > 0 {
+		rules = append(rules, &pruneRule{name: "--host", matches: func(p Pair) bool {
+			for _, name := range names {
+				if matcherContains(p.Request.Destination, name) {
+					return true
+				}
+			}
+			return false
+		}})
+	}
+	var cutoff time.Time
+	if *verifiedBefore != "" {
+		day, err := time.Parse(verifiedDateLayout, *verifiedBefore)
+		if err != nil {
+			log.Fatalf("Invalid --verified-before %q: expected a date such as 2026-01-31", *verifiedBefore)
+		}
+		cutoff = day
+	}
+	if *maxAge > 0 {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		cutoff = today.AddDate(0, 0, -*maxAge)
+	}
+	if !cutoff.IsZero() {
+		name := "--verified-before " + cutoff.Format(verifiedDateLayout)
+		rules = append(rules, &pruneRule{name: name, matches: func(p Pair) bool {
+			day, ok := lastVerified(p)
+			return ok && day.Before(cutoff)
+		}})
+	}
+	if *unverified {
+		rules = append(rules, &pruneRule{name: "--unverified", matches: func(p Pair) bool {
+			_, ok := lastVerified(p)
+			return !ok
+		}})
+	}
+	if len(rules) == 0 {
+		log.Fatal("prune needs at least one of --label, --host, --verified-before, --max-age-days or --unverified")
+	}
+
+	sim, err := readSimulation(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+
+	var removed []string
+	kept := sim.Data.Pairs[:0]
+	for i, p := range sim.Data.Pairs {
+		var reasons []string
+		for _, r := range rules {
+			if r.matches(p) {
+				r.pruned++
+				reasons = append(reasons, r.name)
+			}
+		}
+		if len(reasons) == 0 {
+			kept = append(kept, p)
+			continue
+		}
+		verified := "never verified"
+		if day, ok := lastVerified(p); ok {
+			verified = "verified " + day.Format(verifiedDateLayout)
+		}
+		removed = append(removed, fmt.Sprintf("pair %d: %s (%s; %s)", i, describeRequest(p), verified, strings.Join(reasons, ", ")))
+	}
+	total := len(sim.Data.Pairs)
+	sim.Data.Pairs = kept
+
+	counts := make([]string, len(rules))
+	for i, r := range rules {
+		counts[i] = fmt.Sprintf("%s %d", r.name, r.pruned)
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	log.Printf("%s %d of %d pair(s) (%s)", verb, len(removed), total, strings.Join(counts, ", "))
+	if len(removed) > 0 {
+		fmt.Println(strings.Join(removed, "\n"))
+	}
+	if *dryRun {
+		return
+	}
+
+	if *outputFile == "" {
+		*outputFile = *inputFile
+	}
+	output, err := marshalSimulation(sim, isYAMLPath(*outputFile))
+	if err != nil {
+		log.Fatalf("Failed to serialize simulation: %v", err)
+	}
+	if err := writeOutput(*outputFile, output); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+}
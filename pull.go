@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+)
+
+func runPull(args []string) {
+	flags := flag.NewFlagSet("pull", flag.ExitOnError)
+	outputFile := flags.String("output", "", "Path to write the downloaded simulation (optional, defaults to stdout)")
+	hoverfly := addHoverflyFlags(flags)
+	format := flags.String("format", "simulation", "Output format: simulation, yaml or har")
+	pretty := flags.Bool("pretty", false, "Pretty-print the downloaded simulation")
+	flags.Parse(args)
+
+	if *format != "simulation" && *format != "yaml" && *format != "har" {
+		log.Fatalf("Unknown --format %q: expected simulation, yaml or har", *format)
+	}
+
+	client, err := newHoverflyClient(hoverfly)
+	if err != nil {
+		log.Fatalf("Invalid Hoverfly connection options: %v", err)
+	}
+
+	data, err := client.getSimulation()
+	if err != nil {
+		log.Fatalf("Failed to pull simulation: %v", err)
+	}
+
+	switch {
+	case *format == "har":
+		var sim Simulation
+		if err := json.Unmarshal(data, &sim); err != nil {
+			log.Fatalf("Failed to parse simulation: %v", err)
+		}
+		data, err = json.MarshalIndent(simulationToHAR(sim), "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to serialize HAR: %v", err)
+		}
+	case *format == "yaml":
+		data, err = jsonToYAML(data)
+		if err != nil {
+			log.Fatalf("Failed to convert simulation to YAML: %v", err)
+		}
+	case *pretty:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			log.Fatalf("Failed to parse simulation: %v", err)
+		}
+		data = buf.Bytes()
+	}
+
+	if err := writeOutput(*outputFile, data); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+}
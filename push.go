@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func runPush(args []string) {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to simulation JSON or YAML file to upload")
+	hoverfly := addHoverflyFlags(flags)
+	checkOnly := flags.Bool("check-only", false, "Upload the simulation to confirm Hoverfly accepts it, then restore the previous simulation")
+	appendOnly := flags.Bool("append", false, "Only upload pairs whose request matchers are not already loaded in Hoverfly, keeping existing pairs")
+	backupDir := flags.String("backup-dir", ".hoverfly-backups", "Directory for timestamped backups of the simulation replaced by a push")
+	backupFile := flags.String("backup", "", "Write the replaced simulation to this file instead of --backup-dir; with --rollback, restore from it")
+	namespace := flags.String("label-namespace", "", "Label every pushed pair with namespace:<name>, e.g. team-payments")
+	replace := flags.Bool("replace", false, "Replace only the pairs labelled with --label-namespace, keeping every other pair in Hoverfly")
+	rollback := flags.Bool("rollback", false, "Restore the most recent backup (or --backup) to Hoverfly instead of pushing")
+	flags.Parse(args)
+
+	if *rollback {
+		client, err := newHoverflyClient(hoverfly)
+		if err != nil {
+			log.Fatalf("Invalid Hoverfly connection options: %v", err)
+		}
+		path := *backupFile
+		if path == "" {
+			if path, err = latestBackup(*backupDir); err != nil {
+				log.Fatalf("Failed to find backup: %v", err)
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read backup: %v", err)
+		}
+		if _, err := client.putSimulation(data); err != nil {
+			log.Fatalf("Failed to restore backup: %v", err)
+		}
+		fmt.Printf("Restored %s to %s\n", path, hoverfly.url)
+		return
+	}
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a simulation file with --input")
+	}
+	if *checkOnly && *appendOnly {
+		log.Fatal("--check-only and --append are mutually exclusive")
+	}
+	if *replace && *namespace == "" {
+		log.Fatal("--replace needs --label-namespace")
+	}
+	checkOptions(givenFlags(flags), []optionRule{
+		{"label-namespace", *replace || *appendOnly || *checkOnly, "only scopes a push with --replace or --append; a plain push still replaces every pair in Hoverfly, other namespaces' too"},
+	})
+	if *replace && *appendOnly {
+		log.Fatal("--replace and --append are mutually exclusive")
+	}
+
+	data, err := readSimulationJSON(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to read file: %v", err)
+	}
+	if !json.Valid(data) {
+		log.Fatalf("Failed to parse simulation: %s is not valid JSON", *inputFile)
+	}
+	if *namespace != "" {
+		if data, err = namespaceSimulation(data, *namespace); err != nil {
+			log.Fatalf("Failed to label simulation: %v", err)
+		}
+	}
+
+	client, err := newHoverflyClient(hoverfly)
+	if err != nil {
+		log.Fatalf("Invalid Hoverfly connection options: %v", err)
+	}
+
+	if *checkOnly {
+		if err := checkSimulation(client, data); err != nil {
+			log.Fatalf("Simulation check failed: %v", err)
+		}
+		fmt.Println("Simulation accepted by Hoverfly")
+		return
+	}
+
+	if *appendOnly {
+		added, skipped, err := appendSimulation(client, data)
+		if err != nil {
+			log.Fatalf("Failed to append simulation: %v", err)
+		}
+		fmt.Printf("Appended %d new pair(s) to %s (%d already present)\n", added, hoverfly.url, skipped)
+		return
+	}
+
+	backup, previous, err := backupSimulation(client, *backupDir, *backupFile)
+	if err != nil {
+		log.Fatalf("Failed to back up current simulation: %v", err)
+	}
+	log.Printf("Previous simulation saved to %s", backup)
+
+	if *replace {
+		var kept int
+		if data, kept, err = replaceNamespace(previous, data, *namespace); err != nil {
+			log.Fatalf("Failed to replace namespace: %v", err)
+		}
+		log.Printf("Keeping %d pair(s) outside namespace %s", kept, *namespace)
+	}
+
+	res, err := client.putSimulation(data)
+	if err != nil {
+		log.Fatalf("Failed to push simulation: %v", err)
+	}
+	for _, w := range hoverflyWarnings(res) {
+		log.Printf("Hoverfly warning: %s", w)
+	}
+	fmt.Printf("Simulation pushed to %s\n", hoverfly.url)
+}
+
+// checkSimulation uploads sim to confirm the target Hoverfly accepts it.
+// Hoverfly has no dry-run import, so the current simulation is saved first
+// and restored afterwards regardless of the outcome.
+func checkSimulation(client *hoverflyClient, sim []byte) error {
+	if v, err := client.version(); err == nil {
+		log.Printf("Checking against Hoverfly %s", v)
+	}
+
+	previous, err := client.getSimulation()
+	if err != nil {
+		return fmt.Errorf("failed to save current simulation: %v", err)
+	}
+
+	res, checkErr := client.putSimulation(sim)
+	if checkErr == nil {
+		for _, w := range hoverflyWarnings(res) {
+			log.Printf("Hoverfly warning: %s", w)
+		}
+	}
+
+	if _, err := client.putSimulation(previous); err != nil {
+		return fmt.Errorf("failed to restore previous simulation: %v", err)
+	}
+	return checkErr
+}
+
+// rawSimulation keeps pairs as raw JSON so fields this tool doesn't model
+// survive an append or namespace replace untouched.
+type rawSimulation struct {
+	Data struct {
+		Pairs         []json.RawMessage `json:"pairs"`
+		GlobalActions json.RawMessage   `json:"globalActions,omitempty"`
+	} `json:"data"`
+	Meta json.RawMessage `json:"meta"`
+}
+
+// appendSimulation uploads only the pairs of sim whose request matchers are
+// not already loaded in Hoverfly, so repeated pushes of the same capture
+// don't duplicate pairs. It returns the number of pairs added and skipped.
+func appendSimulation(client *hoverflyClient, sim []byte) (int, int, error) {
+	current, err := client.getSimulation()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to download current simulation: %v", err)
+	}
+	var existing Simulation
+	if err := json.Unmarshal(current, &existing); err != nil {
+		return 0, 0, fmt.Errorf("unexpected simulation from Hoverfly: %v", err)
+	}
+	loaded := pairIndex(existing.Data.Pairs)
+
+	var incoming rawSimulation
+	if err := json.Unmarshal(sim, &incoming); err != nil {
+		return 0, 0, err
+	}
+	var fresh []json.RawMessage
+	skipped := 0
+	for _, raw := range incoming.Data.Pairs {
+		var p Pair
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return 0, 0, err
+		}
+		key := requestKey(p)
+		if _, ok := loaded[key]; ok {
+			skipped++
+			continue
+		}
+		// Guard against duplicates within the file itself too.
+		loaded[key] = -1
+		fresh = append(fresh, raw)
+	}
+	if len(fresh) == 0 {
+		return 0, skipped, nil
+	}
+
+	// Appending global actions would duplicate delays already loaded.
+	incoming.Data.Pairs = fresh
+	incoming.Data.GlobalActions = nil
+	payload, err := json.Marshal(incoming)
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := client.postSimulation(payload)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, w := range hoverflyWarnings(res) {
+		log.Printf("Hoverfly warning: %s", w)
+	}
+	return len(fresh), skipped, nil
+}
+
+// backupSimulation downloads the simulation about to be replaced and writes
+// it to file, or to a timestamped file in dir when file is empty. It
+// returns the path written and the downloaded simulation.
+func backupSimulation(client *hoverflyClient, dir, file string) (string, []byte, error) {
+	previous, err := client.getSimulation()
+	if err != nil {
+		return "", nil, err
+	}
+	if file == "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", nil, err
+		}
+		file = filepath.Join(dir, "simulation-"+time.Now().UTC().Format("20060102T150405.000Z")+".json")
+	}
+	if err := os.WriteFile(file, previous, 0644); err != nil {
+		return "", nil, err
+	}
+	return file, previous, nil
+}
+
+// latestBackup returns the newest backup written by backupSimulation. The
+// timestamped names sort chronologically.
+func latestBackup(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "simulation-") && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no backups in %s", dir)
+	}
+	sort.Strings(names)
+	return filepath.Join(dir, names[len(names)-1]), nil
+}
+
+const namespaceLabelPrefix = "namespace:"
+
+// namespaceSimulation adds the namespace label to every pair of sim that
+// doesn't already carry it.
+func namespaceSimulation(sim []byte, namespace string) ([]byte, error) {
+	var raw rawSimulation
+	if err := json.Unmarshal(sim, &raw); err != nil {
+		return nil, err
+	}
+	label := namespaceLabelPrefix + namespace
+	for i, pair := range raw.Data.Pairs {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(pair, &fields); err != nil {
+			return nil, err
+		}
+		var labels []string
+		if l, ok := fields["labels"]; ok {
+			if err := json.Unmarshal(l, &labels); err != nil {
+				return nil, err
+			}
+		}
+		if containsString(labels, label) {
+			continue
+		}
+		l, _ := json.Marshal(append(labels, label))
+		fields["labels"] = l
+		updated, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		raw.Data.Pairs[i] = updated
+	}
+	return json.Marshal(raw)
+}
+
+// replaceNamespace builds the simulation to upload when only one
+// namespace's pairs should change: pairs of current outside the namespace
+// are kept, followed by the incoming pairs. Hoverfly's admin API can't
+// delete pairs selectively, so the whole merged simulation is uploaded.
+// It returns the merged simulation and the number of pairs kept.
+func replaceNamespace(current, incoming []byte, namespace string) ([]byte, int, error) {
+	var cur, in rawSimulation
+	if err := json.Unmarshal(current, &cur); err != nil {
+		return nil, 0, fmt.Errorf("unexpected simulation from Hoverfly: %v", err)
+	}
+	if err := json.Unmarshal(incoming, &in); err != nil {
+		return nil, 0, err
+	}
+
+	label := namespaceLabelPrefix + namespace
+	var pairs []json.RawMessage
+	for _, raw := range cur.Data.Pairs {
+		var p struct {
+			Labels []string `json:"labels"`
+		}
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, 0, err
+		}
+		if !containsString(p.Labels, label) {
+			pairs = append(pairs, raw)
+		}
+	}
+	kept := len(pairs)
+
+	in.Data.Pairs = append(pairs, in.Data.Pairs...)
+	if in.Data.GlobalActions == nil {
+		in.Data.GlobalActions = cur.Data.GlobalActions
+	}
+	merged, err := json.Marshal(in)
+	return merged, kept, err
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// redirectHeaders are the response headers a simulated redirect needs for
+// clients to follow it. They are kept on 3xx responses whatever
+// --response-headers says.
+var redirectHeaders = []string{"Location", "Refresh"}
+
+// isRedirect reports whether status sends the client elsewhere; 304 Not
+// Modified is a 3xx that doesn't.
+func isRedirect(status int) bool {
+	return status >= 300 && status < 400 && status != 304
+}
+
+// keepRedirectHeaders copies the redirect headers of a recorded 3xx
+// response into p, taking Location from the HAR redirectURL when the
+// recorder left the header out.
+func keepRedirectHeaders(p *Pair, res HarResponse) {
+	if !isRedirect(res.Status) {
+		return
+	}
+	if p.Response.Headers == nil {
+		p.Response.Headers = Header{}
+	}
+	for _, name := range redirectHeaders {
+		if _, ok := p.Response.Headers[name]; ok {
+			continue
+		}
+		var values []string
+		for _, h := range res.Headers {
+			if textproto.CanonicalMIMEHeaderKey(h.Name) == name {
+				values = append(values, h.Value)
+			}
+		}
+		if len(values) == 0 && name == "Location" && res.RedirectURL != "" {
+			values = []string{res.RedirectURL}
+		}
+		if len(values) > 0 {
+			p.Response.Headers[name] = values
+		}
+	}
+}
+
+// redirectLocation resolves the target of a redirect entry against its
+// request URL, returning "" for entries that aren't redirects.
+func redirectLocation(e Entry) string {
+	if !isRedirect(e.Response.Status) {
+		return ""
+	}
+	location := headerValue(e.Response.Headers, "Location")
+	if location == "" {
+		location = e.Response.RedirectURL
+	}
+	base, err := url.Parse(e.Request.URL)
+	if location == "" || err != nil {
+		return ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(location))
+	if err != nil {
+		return ""
+	}
+	return stripFragment(base.ResolveReference(ref).String())
+}
+
+// redirectMethod is the method a client follows a redirect with: 307 and
+// 308 repeat the request, the others turn it into a GET as browsers do.
+func redirectMethod(status int, method string) string {
+	if status == 307 || status == 308 || method == "HEAD" {
+		return method
+	}
+	return "GET"
+}
+
+// flattenRedirects implements --flatten-redirects. It follows each
+// redirect to the first later entry requesting its Location, and on
+// through further redirects, returning for every redirect entry the entry
+// that ended its chain. Those entries are then converted with the final
+// response, so a client sees one hop; cookies set by the intermediate
+// hops are lost. Redirects whose target wasn't recorded are returned in
+// unresolved and kept as they are.
+func flattenRedirects(entries []Entry) (final map[int]int, unresolved []string) {
+	final = map[int]int{}
+	for i, e := range entries {
+		if !isRedirect(e.Response.Status) {
+			continue
+		}
+		at, method, seen := i, e.Request.Method, map[int]bool{i: true}
+		for {
+			status := entries[at].Response.Status
+			location := redirectLocation(entries[at])
+			if location == "" {
+				break
+			}
+			method = redirectMethod(status, method)
+			next := -1
+			for j := at + 1; j < len(entries); j++ {
+				if entries[j].Request.Method == method && stripFragment(entries[j].Request.URL) == location {
+					next = j
+					break
+				}
+			}
+			if next < 0 || seen[next] {
+				break
+			}
+			seen[next], at = true, next
+			if !isRedirect(entries[at].Response.Status) {
+				break
+			}
+		}
+		if isRedirect(entries[at].Response.Status) {
+			unresolved = append(unresolved, fmt.Sprintf("%s %s -> %s", e.Request.Method, e.Request.URL, redirectLocation(entries[at])))
+			continue
+		}
+		final[i] = at
+	}
+	return final, unresolved
+}
+
+// writeRedirectReport logs how many redirects were flattened and those
+// whose chain couldn't be followed.
+func writeRedirectReport(flattened int, unresolved []string) {
+	if flattened > 0 {
+		log.Printf("Flattened %d redirect(s) into the response that ended their chain", flattened)
+	}
+	if len(unresolved) > 0 {
+		log.Printf("%d redirect(s) kept because their target wasn't recorded:\n  %s", len(unresolved), strings.Join(unresolved, "\n  "))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// rejectedEntries collects the entries conversion skipped, for --rejects.
+// Each is written as recorded plus a _skipReason code naming the filter or
+// problem that skipped it and a _skipDetail with the specifics, so the
+// rejects file is itself a HAR that can be converted again with other
+// flags.
+type rejectedEntries struct {
+	fields  map[string]json.RawMessage
+	raws    []json.RawMessage
+	entries []json.RawMessage
+	reasons map[string]int
+}
+
+// add records that entry i was skipped. Calling it on a nil collector is a
+// no-op so callers needn't check --rejects.
+func (r *rejectedEntries) add(i int, reason, detail string) {
+	if r == nil {
+		return
+	}
+	if r.reasons == nil {
+		r.reasons = map[string]int{}
+	}
+	r.reasons[reason]++
+
+	var entry map[string]json.RawMessage
+	if json.Unmarshal(r.raws[i], &entry) != nil {
+		// Entries that aren't objects can only be kept alongside the reason.
+		entry = map[string]json.RawMessage{"_entry": r.raws[i]}
+	}
+	entry["_skipReason"], _ = json.Marshal(reason)
+	if detail != "" {
+		entry["_skipDetail"], _ = json.Marshal(detail)
+	}
+	raw, _ := json.Marshal(entry)
+	r.entries = append(r.entries, raw)
+}
+
+// write saves the rejected entries with the original log-level fields and
+// logs how many were skipped for each reason.
+func (r *rejectedEntries) write(path string) error {
+	if r == nil {
+		return nil
+	}
+	logFields := make(map[string]json.RawMessage, len(r.fields)+1)
+	for k, v := range r.fields {
+		logFields[k] = v
+	}
+	entries := r.entries
+	if entries == nil {
+		entries = []json.RawMessage{}
+	}
+	logFields["entries"], _ = json.Marshal(entries)
+	data, err := json.MarshalIndent(map[string]interface{}{"log": logFields}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	reasons := make([]string, 0, len(r.reasons))
+	for reason, n := range r.reasons {
+		reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+	}
+	sort.Strings(reasons)
+	if len(reasons) == 0 {
+		log.Printf("No entries were skipped; wrote an empty %s", path)
+	} else {
+		log.Printf("Wrote %d skipped entr(ies) to %s (%s)", len(r.entries), path, strings.Join(reasons, ", "))
+	}
+	return nil
+}
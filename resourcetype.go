@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resourceTypes are the _resourceType values Chrome DevTools writes.
+var resourceTypes = []string{
+	"document", "stylesheet", "image", "media", "font", "script", "texttrack", "xhr", "fetch",
+	"prefetch", "eventsource", "websocket", "manifest", "signedexchange", "ping", "cspviolationreport",
+	"preflight", "other",
+}
+
+// parseResourceTypes parses --resource-type into a set of lower-cased
+// types, or nil when the flag is unset.
+func parseResourceTypes(value string) (map[string]bool, error) {
+	names := splitList(value)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	kept := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !containsString(resourceTypes, name) {
+			return nil, fmt.Errorf("unknown type %q: expected one of %s", name, strings.Join(resourceTypes, ", "))
+		}
+		kept[name] = true
+	}
+	return kept, nil
+}
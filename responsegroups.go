@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// responseGroups implements --group-by-response: per endpoint, only the
+// first entry of each distinct response (status and body) becomes a pair,
+// and that pair is labelled with how many entries returned the response.
+// Later entries are dropped even when their query or body differed, which
+// trades matching those exact requests for a smaller simulation.
+type responseGroups struct {
+	groups map[string]*responseGroup
+	order  []*responseGroup
+}
+
+type responseGroup struct {
+	endpoint string
+	status   int
+	entry    int
+	pair     int
+	count    int
+}
+
+// add records entry i and returns the group it joins. ok is false for the
+// first entry of a response, which the caller converts into pair.
+func (g *responseGroups) add(i, pair int, method, host, path string, res HarResponse) (*responseGroup, bool) {
+	endpoint := method + " " + host + path
+	sum := sha256.Sum256([]byte(res.Content.Encoding + "\x00" + res.Content.Text))
+	key := fmt.Sprintf("%s %d %x", endpoint, res.Status, sum)
+	if group, ok := g.groups[key]; ok {
+		group.count++
+		return group, true
+	}
+	if g.groups == nil {
+		g.groups = map[string]*responseGroup{}
+	}
+	group := &responseGroup{endpoint: endpoint, status: res.Status, entry: i, pair: pair, count: 1}
+	g.groups[key] = group
+	g.order = append(g.order, group)
+	return group, false
+}
+
+// label adds occurrences:<n> to every kept pair.
+func (g *responseGroups) label(pairs []Pair) {
+	for _, group := range g.order {
+		pairs[group.pair].Labels = append(pairs[group.pair].Labels, fmt.Sprintf("occurrences:%d", group.count))
+	}
+}
+
+// observed maps every kept pair to the number of entries it grouped.
+func (g *responseGroups) observed() map[int]int {
+	observed := map[int]int{}
+	for _, group := range g.order {
+		observed[group.pair] = group.count
+	}
+	return observed
+}
+
+// write logs how far grouping shrank the simulation and the responses that
+// repeated most.
+func (g *responseGroups) write() {
+	entries := 0
+	var repeated []*responseGroup
+	for _, group := range g.order {
+		entries += group.count
+		if group.count > 1 {
+			repeated = append(repeated, group)
+		}
+	}
+	if len(repeated) == 0 {
+		return
+	}
+	sort.SliceStable(repeated, func(a, b int) bool { return repeated[a].count > repeated[b].count })
+	lines := make([]string, len(repeated))
+	for k, group := range repeated {
+		lines[k] = fmt.Sprintf("%s %d: %d entr(ies)", group.endpoint, group.status, group.count)
+	}
+	log.Printf("--group-by-response kept %d pair(s) for %d entr(ies); repeated responses:\n  %s", len(g.order), entries, strings.Join(lines, "\n  "))
+}
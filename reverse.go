@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+)
+
+// simulationToHAR rebuilds a HAR log from a simulation. Only exact matchers
+// carry enough information to reconstruct a request, so pairs using other
+// matcher types are exported with whatever exact values they do have.
+func simulationToHAR(sim Simulation) HAR {
+	var har HAR
+	har.Log.Version = "1.2"
+	har.Log.Creator = &Creator{Name: "har-to-hoverfly", Version: version}
+	har.Log.Entries = []Entry{}
+
+	for _, pair := range sim.Data.Pairs {
+		har.Log.Entries = append(har.Log.Entries, pairToEntry(pair))
+	}
+	return har
+}
+
+func pairToEntry(pair Pair) Entry {
+	r := pair.Request
+
+	u := url.URL{
+		Scheme: exactValue(r.Scheme),
+		Host:   exactValue(r.Destination),
+		Path:   exactValue(r.Path),
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	query := url.Values{}
+	for k, matchers := range r.Query {
+		if v := exactValue(matchers); v != "" {
+			query.Set(k, v)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	var entry Entry
+	entry.Request.Method = exactValue(r.Method)
+	entry.Request.URL = u.String()
+	for _, name := range sortedMatcherKeys(r.Headers) {
+		entry.Request.Headers = append(entry.Request.Headers, HarHeader{Name: name, Value: exactValue(r.Headers[name])})
+	}
+	if body := exactValue(r.Body); body != "" {
+		entry.Request.PostData = &PostData{Text: body}
+		if ct := r.Headers["Content-Type"]; len(ct) > 0 {
+			entry.Request.PostData.MimeType = ct[0].Value
+		}
+	}
+
+	res := pair.Response
+	entry.Response.Status = res.Status
+	entry.Response.Content.Text = res.Body
+	if res.EncodedBody {
+		entry.Response.Content.Encoding = "base64"
+	}
+	names := make([]string, 0, len(res.Headers))
+	for name := range res.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range res.Headers[name] {
+			entry.Response.Headers = append(entry.Response.Headers, HarHeader{Name: name, Value: v})
+		}
+		if name == "Content-Type" && len(res.Headers[name]) > 0 {
+			entry.Response.Content.MimeType = res.Headers[name][0]
+		}
+	}
+	return entry
+}
+
+// exactValue returns the value of the first exact matcher, if any.
+func exactValue(matchers []FieldMatcher) string {
+	for _, m := range matchers {
+		if m.Matcher == "exact" {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+func sortedMatcherKeys(m map[string][]FieldMatcher) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
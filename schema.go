@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// jsonSchema is the subset of JSON Schema inferred from recorded bodies.
+type jsonSchema struct {
+	Type       string                 `json:"type,omitempty"`
+	Properties map[string]*jsonSchema `json:"properties,omitempty"`
+	Items      *jsonSchema            `json:"items,omitempty"`
+}
+
+// inferBodySchema parses body as JSON and infers its schema. It returns nil
+// when the body isn't JSON.
+func inferBodySchema(body string) *jsonSchema {
+	var v interface{}
+	if body == "" || json.Unmarshal([]byte(body), &v) != nil {
+		return nil
+	}
+	return inferSchema(v)
+}
+
+// inferSchema describes a decoded JSON value. Array item schemas are taken
+// from the first element, which is good enough for the homogeneous arrays
+// APIs normally return.
+func inferSchema(v interface{}) *jsonSchema {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		s := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}}
+		for k, child := range t {
+			s.Properties[k] = inferSchema(child)
+		}
+		return s
+	case []interface{}:
+		s := &jsonSchema{Type: "array"}
+		if len(t) > 0 {
+			s.Items = inferSchema(t[0])
+		}
+		return s
+	case string:
+		return &jsonSchema{Type: "string"}
+	case float64:
+		if t == float64(int64(t)) {
+			return &jsonSchema{Type: "integer"}
+		}
+		return &jsonSchema{Type: "number"}
+	case bool:
+		return &jsonSchema{Type: "boolean"}
+	default:
+		return &jsonSchema{Type: "null"}
+	}
+}
+
+func (s *jsonSchema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
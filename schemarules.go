@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// schemaRule is one pattern=file entry from --json-schema. Patterns match
+// endpoints as for --slo; the schema's own $refs resolve within its file.
+type schemaRule struct {
+	pattern string
+	file    string
+	schema  *openapiSpec
+}
+
+func parseSchemaRules(value string) ([]schemaRule, error) {
+	var rules []schemaRule
+	for _, item := range splitList(value) {
+		pattern, file, ok := strings.Cut(item, "=")
+		if !ok {
+			// A bare file applies to every endpoint.
+			pattern, file = "*", item
+		}
+		doc, err := readJSONSchema(file)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, schemaRule{pattern: pattern, file: file, schema: &openapiSpec{doc: doc}})
+	}
+	return rules, nil
+}
+
+func readJSONSchema(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLPath(path) {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return doc, nil
+}
+
+// validateResponse checks a successful JSON response against the most
+// specific matching rule. Error responses are skipped, since schemas
+// normally describe only the success payload.
+func validateResponse(rules []schemaRule, host, path string, res HarResponse, encoded bool) []string {
+	if res.Status < 200 || res.Status > 299 || encoded {
+		return nil
+	}
+	var best *schemaRule
+	bestRank := -1
+	for i := range rules {
+		if rank := patternRank(rules[i].pattern, host, path); rank > bestRank {
+			best, bestRank = &rules[i], rank
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	var body interface{}
+	if json.Unmarshal([]byte(res.Content.Text), &body) != nil {
+		return []string{fmt.Sprintf("response body isn't JSON but %s applies", best.file)}
+	}
+	return best.schema.validate(best.schema.doc, body, "response body", 0)
+}
+
+// schemaRuleFiles lists the schema files of a --json-schema value, so the
+// conversion cache is invalidated when one changes.
+func schemaRuleFiles(value string) []string {
+	var files []string
+	for _, item := range splitList(value) {
+		if _, file, ok := strings.Cut(item, "="); ok {
+			item = file
+		}
+		files = append(files, item)
+	}
+	return files
+}
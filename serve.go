@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replayServer serves a simulation directly, for environments that can't
+// run Hoverfly. It implements the matchers explain understands, state, and
+// per-pair delays; templated responses are served untemplated.
+type replayServer struct {
+	pairs       []Pair
+	delays      bool
+	global      []globalDelay
+	globalLog   []globalDelay
+	destination string
+
+	mu    sync.Mutex
+	state map[string]string
+}
+
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file to serve")
+	listen := flags.String("listen", "localhost:8500", "Address to serve the simulation on; use it as the service URL or as an HTTP proxy")
+	destination := flags.String("destination", "", "Destination matched for direct (non-proxy) requests, e.g. api.example.com; defaults to their Host header")
+	noDelays := flags.Bool("no-delays", false, "Ignore fixedDelay and logNormalDelay and respond immediately")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("serve needs --input")
+	}
+	sim, err := readSimulation(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+	templated := 0
+	for _, p := range sim.Data.Pairs {
+		if p.Response.Templated {
+			templated++
+		}
+	}
+	if templated > 0 {
+		log.Printf("%d templated response(s) will be served without templating", templated)
+	}
+
+	s := newReplayServer(sim, !*noDelays, *destination)
+	log.Printf("Serving %d pair(s) on %s", len(s.pairs), *listen)
+	log.Fatal(http.ListenAndServe(*listen, s))
+}
+
+// newReplayServer prepares sim for serving. Like Hoverfly on import, it
+// starts every "sequence:" state key the pairs require at "1", so the first
+// step of each sequence matches.
+func newReplayServer(sim Simulation, delays bool, destination string) *replayServer {
+	s := &replayServer{pairs: sim.Data.Pairs, delays: delays, destination: destination, state: map[string]string{}}
+	for _, p := range sim.Data.Pairs {
+		for k := range p.Request.RequiresState {
+			if strings.HasPrefix(k, "sequence:") {
+				s.state[k] = "1"
+			}
+		}
+	}
+	compile := func(urlPattern string) *regexp.Regexp {
+		pattern, err := regexp.Compile(urlPattern)
+		if err != nil {
+			log.Fatalf("Invalid global delay urlPattern %q: %v", urlPattern, err)
+		}
+		return pattern
+	}
+	for _, d := range sim.Data.GlobalActions.Delays {
+		s.global = append(s.global, globalDelay{compile(d.URLPattern), d.HTTPMethod, Response{FixedDelay: d.Delay}})
+	}
+	for _, d := range sim.Data.GlobalActions.DelaysLogNormal {
+		delay := d.LogNormalDelay
+		s.globalLog = append(s.globalLog, globalDelay{compile(d.URLPattern), d.HTTPMethod, Response{LogNormalDelay: &delay}})
+	}
+	return s
+}
+
+func (s *replayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Proxy requests carry an absolute URL; direct ones only a Host header.
+	req := liveRequest{
+		Method:  r.Method,
+		Scheme:  "http",
+		Host:    r.Host,
+		Path:    r.URL.Path,
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+		Body:    string(body),
+	}
+	if r.URL.Host != "" {
+		req.Scheme, req.Host = r.URL.Scheme, r.URL.Host
+	} else if s.destination != "" {
+		req.Host = s.destination
+	}
+
+	s.mu.Lock()
+	match, closest, agreed, total := findPair(s.pairs, req, s.state)
+	var res Response
+	if match >= 0 {
+		res = s.pairs[match].Response
+		for k, v := range res.TransitionsState {
+			s.state[k] = v
+		}
+		for _, k := range res.RemovesState {
+			delete(s.state, k)
+		}
+	}
+	s.mu.Unlock()
+
+	if match < 0 {
+		// Hoverfly answers unmatched requests with a 502 too.
+		msg := "Could not find a match for request"
+		if closest >= 0 {
+			msg += fmt.Sprintf("; closest pair %d matched %d/%d matchers (run explain for details)", closest, agreed, total)
+		}
+		log.Printf("MISS %s %s%s", r.Method, req.Host, r.URL.RequestURI())
+		http.Error(w, "Hoverfly Error!\n\n"+msg, http.StatusBadGateway)
+		return
+	}
+
+	payload := []byte(res.Body)
+	if res.EncodedBody {
+		if payload, err = base64.StdEncoding.DecodeString(res.Body); err != nil {
+			http.Error(w, fmt.Sprintf("pair %d has an invalid encodedBody: %v", match, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if s.delays {
+		delay := responseDelay(res)
+		if res.FixedDelay == 0 && res.LogNormalDelay == nil {
+			delay = s.globalDelay(req)
+		}
+		time.Sleep(delay)
+	}
+	for name, values := range res.Headers {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.Status)
+	w.Write(payload)
+}
+
+// globalDelay is a global delay or global logNormal delay with its
+// compiled urlPattern, holding the delay as a response's would.
+type globalDelay struct {
+	pattern *regexp.Regexp
+	method  string
+	delay   Response
+}
+
+// globalDelay returns the delay of the first global delay and the first
+// global logNormal delay matching req, which Hoverfly applies to pairs
+// without a delay of their own.
+func (s *replayServer) globalDelay(req liveRequest) time.Duration {
+	var total time.Duration
+	for _, delays := range [][]globalDelay{s.global, s.globalLog} {
+		for _, d := range delays {
+			if (d.method == "" || strings.EqualFold(d.method, req.Method)) && d.pattern.MatchString(req.Host+req.Path) {
+				total += responseDelay(d.delay)
+				break
+			}
+		}
+	}
+	return total
+}
+
+// responseDelay returns how long Hoverfly would wait before responding. A
+// log-normal delay is sampled with the recorded median and mean, then
+// clamped to its min and max.
+func responseDelay(res Response) time.Duration {
+	ms := float64(res.FixedDelay)
+	if d := res.LogNormalDelay; d != nil && d.Median > 0 {
+		mu := math.Log(float64(d.Median))
+		sigma := 0.0
+		if d.Mean > d.Median {
+			sigma = math.Sqrt(2 * math.Log(float64(d.Mean)/float64(d.Median)))
+		}
+		sample := math.Exp(mu + sigma*rand.NormFloat64())
+		if d.Min > 0 && sample < float64(d.Min) {
+			sample = float64(d.Min)
+		}
+		if d.Max > 0 && sample > float64(d.Max) {
+			sample = float64(d.Max)
+		}
+		ms += sample
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
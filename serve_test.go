@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeSequence(t *testing.T) {
+	first, second := sequencePairs(mergePair("/cart", "empty"), mergePair("/cart", "one item"), "sequence:merge-1")
+	// State the simulation sets itself starts unset, unlike sequence keys.
+	loggedIn := mergePair("/profile", "alice")
+	loggedIn.Request.RequiresState = map[string]string{"session": "logged-in"}
+	var sim Simulation
+	sim.Data.Pairs = []Pair{first, second, loggedIn}
+
+	srv := httptest.NewServer(newReplayServer(sim, false, "api.example.com"))
+	defer srv.Close()
+	for i, tt := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/cart", 200, "empty"},
+		{"/cart", 200, "one item"},
+		{"/cart", 200, "one item"},
+		{"/profile", 502, ""},
+	} {
+		resp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || (tt.status == 200 && string(body) != tt.body) {
+			t.Errorf("request %d to %s: got %d %q, want %d %q", i+1, tt.path, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// sessionIndexes assigns each entry to a session, starting a new one
+// whenever the capture was idle for longer than gap. Idle time is measured
+// from the latest end time (start + duration) seen so far, so a long
+// request doesn't open a spurious gap. Entries without a parsable
+// startedDateTime stay in the current session.
+func sessionIndexes(entries []Entry, gap time.Duration) []int {
+	indexes := make([]int, len(entries))
+	session := 0
+	var lastEnd time.Time
+	for i, e := range entries {
+		start, err := time.Parse(time.RFC3339Nano, e.StartedDateTime)
+		if err != nil {
+			indexes[i] = session
+			continue
+		}
+		if !lastEnd.IsZero() && start.Sub(lastEnd) > gap {
+			session++
+		}
+		end := start.Add(time.Duration(e.Time * float64(time.Millisecond)))
+		if end.After(lastEnd) {
+			lastEnd = end
+		}
+		indexes[i] = session
+	}
+	return indexes
+}
+
+func sessionName(index int) string {
+	return fmt.Sprintf("session-%d", index+1)
+}
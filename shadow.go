@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// hopByHopHeaders are not forwarded by the shadow proxy.
+var hopByHopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// shadowProxy forwards live traffic to the real service and compares each
+// exchange with what the simulation would have served.
+type shadowProxy struct {
+	pairs     []Pair
+	target    *url.URL
+	arrayKeys []string
+	client    *http.Client
+	out       io.Writer
+
+	mu                                sync.Mutex
+	matched, differed, missed, failed int
+}
+
+func runShadow(args []string) {
+	flags := flag.NewFlagSet("shadow", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file to validate")
+	listen := flags.String("listen", "localhost:8500", "Address the shadow proxy listens on")
+	target := flags.String("target", "", "Base URL of the real service to forward to; without it, act as an HTTP forward proxy")
+	arrayKeys := flags.String("array-keys", strings.Join(defaultArrayKeys, ","), "Fields used to match JSON array elements when diffing bodies")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("shadow needs --input")
+	}
+	sim, err := readSimulation(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+
+	s := &shadowProxy{
+		pairs:     sim.Data.Pairs,
+		arrayKeys: splitList(*arrayKeys),
+		out:       os.Stdout,
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+	if *target != "" {
+		if s.target, err = parseBaseURL(*target); err != nil {
+			log.Fatalf("Invalid --target: %v", err)
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		s.mu.Lock()
+		fmt.Fprintf(s.out, "\n%d matched, %d differed, %d missed, %d failed to forward\n", s.matched, s.differed, s.missed, s.failed)
+		os.Exit(0)
+	}()
+
+	mode := "forward proxy"
+	if s.target != nil {
+		mode = "forwarding to " + s.target.String()
+	}
+	log.Printf("Shadowing %d pair(s) on %s (%s)", len(s.pairs), *listen, mode)
+	log.Fatal(http.ListenAndServe(*listen, s))
+}
+
+func (s *shadowProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		http.Error(w, "shadow can't inspect HTTPS tunnels; use --target", http.StatusNotImplemented)
+		return
+	}
+	upstream := *r.URL
+	if s.target != nil {
+		upstream.Scheme, upstream.Host = s.target.Scheme, s.target.Host
+		upstream.Path = strings.TrimRight(s.target.Path, "/") + r.URL.Path
+		upstream.RawPath = ""
+	} else if upstream.Host == "" {
+		http.Error(w, "not a proxy request; set --target to shadow a single service", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := http.NewRequest(r.Method, upstream.String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	out.Header = r.Header.Clone()
+	for _, h := range hopByHopHeaders {
+		out.Header.Del(h)
+	}
+	// Let the transport negotiate compression so bodies compare decoded.
+	out.Header.Del("Accept-Encoding")
+
+	req := liveRequest{
+		Method:  r.Method,
+		Scheme:  upstream.Scheme,
+		Host:    upstream.Host,
+		Path:    upstream.Path,
+		Query:   upstream.Query(),
+		Headers: r.Header,
+		Body:    string(body),
+	}
+	label := r.Method + " " + upstream.String()
+
+	res, err := s.client.Do(out)
+	if err != nil {
+		s.report(&s.failed, "FAIL  %s: %v", label, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		s.report(&s.failed, "FAIL  %s: %v", label, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	for name, values := range res.Header {
+		if name == "Content-Length" || containsString(hopByHopHeaders, name) {
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.StatusCode)
+	w.Write(resBody)
+
+	s.compare(req, label, res.StatusCode, resBody)
+}
+
+// compare matches the request against the simulation and reports how the
+// simulated response differs from the live one.
+func (s *shadowProxy) compare(req liveRequest, label string, status int, body []byte) {
+	match, closest, agreed, total := findPair(s.pairs, req, nil)
+	switch {
+	case match >= 0:
+		if diffs := shadowDiffs(s.pairs[match].Response, status, body, s.arrayKeys); len(diffs) > 0 {
+			s.report(&s.differed, "DIFF  %s (pair %d)\n    %s", label, match, strings.Join(diffs, "\n    "))
+		} else {
+			s.report(&s.matched, "MATCH %s (pair %d)", label, match)
+		}
+	case closest < 0:
+		s.report(&s.missed, "MISS  %s (no pairs)", label)
+	default:
+		s.report(&s.missed, "MISS  %s (closest pair %d: %d/%d matchers; run explain for details)", label, closest, agreed, total)
+	}
+}
+
+// shadowDiffs describes how the simulated response differs from the live
+// one, diffing JSON bodies structurally.
+func shadowDiffs(res Response, status int, body []byte, arrayKeys []string) []string {
+	var diffs []string
+	if res.Status != status {
+		diffs = append(diffs, fmt.Sprintf("status: simulated %d, live %d", res.Status, status))
+	}
+	if res.Templated {
+		return append(diffs, "body: templated, not compared")
+	}
+
+	simulated := []byte(res.Body)
+	if res.EncodedBody {
+		decoded, err := base64.StdEncoding.DecodeString(res.Body)
+		if err != nil {
+			return append(diffs, fmt.Sprintf("body: simulated encodedBody is invalid: %v", err))
+		}
+		simulated = decoded
+	}
+	if bytes.Equal(simulated, body) {
+		return diffs
+	}
+
+	var old, new interface{}
+	if json.Unmarshal(simulated, &old) == nil && json.Unmarshal(body, &new) == nil {
+		changes := diffJSON(old, new, arrayKeys)
+		sort.SliceStable(changes, func(i, j int) bool { return changes[i].Display < changes[j].Display })
+		for _, c := range changes {
+			path := "body"
+			if strings.HasPrefix(c.Display, "[") {
+				path += c.Display
+			} else if c.Display != "" {
+				path += "." + c.Display
+			}
+			switch c.Op {
+			case "add":
+				diffs = append(diffs, fmt.Sprintf("+ %s: %s", path, diffValue(c.Value)))
+			case "remove":
+				diffs = append(diffs, fmt.Sprintf("- %s: %s", path, diffValue(c.Old)))
+			default:
+				diffs = append(diffs, fmt.Sprintf("~ %s: %s → %s", path, diffValue(c.Old), diffValue(c.Value)))
+			}
+		}
+		return diffs
+	}
+	return append(diffs, fmt.Sprintf("body: simulated %d bytes, live %d bytes differ", len(simulated), len(body)))
+}
+
+func (s *shadowProxy) report(counter *int, format string, args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*counter++
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// harSidecar keeps the parts of a HAR that a simulation cannot represent:
+// log-level fields such as pages and creator, and the complete original of
+// every converted entry. The to-har command overlays each pair's response
+// onto these so a HAR -> simulation -> HAR round trip keeps timings,
+// headers, cookies, vendor _fields and anything else the recorder wrote.
+type harSidecar struct {
+	Log     map[string]json.RawMessage `json:"log"`
+	Entries []sidecarEntry             `json:"entries"`
+}
+
+// sidecarEntry ties an original entry to the pair converted from it. Key
+// guards against pairs having been added, removed or reordered since.
+type sidecarEntry struct {
+	Pair  int             `json:"pair"`
+	Key   string          `json:"key"`
+	Entry json.RawMessage `json:"entry"`
+}
+
+// rawHAREntries splits a HAR into its log-level fields (minus entries) and
+// the raw JSON of each entry.
+func rawHAREntries(data []byte) (map[string]json.RawMessage, []json.RawMessage, error) {
+	var doc struct {
+		Log map[string]json.RawMessage `json:"log"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	var entries []json.RawMessage
+	if raw, ok := doc.Log["entries"]; ok {
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, nil, err
+		}
+	}
+	delete(doc.Log, "entries")
+	return doc.Log, entries, nil
+}
+
+func sidecarKey(p Pair) string {
+	return exactValue(p.Request.Method) + " " + exactValue(p.Request.Destination) + exactValue(p.Request.Path)
+}
+
+// sidecarHAR rebuilds a HAR from the simulation, restoring everything the
+// sidecar preserved for pairs that still line up with their original
+// entries. It returns generic JSON because the HAR types only model the
+// fields the converter uses.
+func sidecarHAR(sim Simulation, sidecar harSidecar) (map[string]interface{}, error) {
+	originals := map[int]sidecarEntry{}
+	for _, e := range sidecar.Entries {
+		originals[e.Pair] = e
+	}
+
+	logFields := map[string]interface{}{}
+	for k, raw := range sidecar.Log {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		logFields[k] = v
+	}
+
+	entries := []interface{}{}
+	for i, pair := range sim.Data.Pairs {
+		original, ok := originals[i]
+		if !ok || original.Key != sidecarKey(pair) {
+			rebuilt, err := toJSONValue(pairToEntry(pair))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, rebuilt)
+			continue
+		}
+		var base map[string]interface{}
+		if err := json.Unmarshal(original.Entry, &base); err != nil {
+			return nil, fmt.Errorf("sidecar entry for pair %d: %v", i, err)
+		}
+		overlayResponse(base, pair.Response)
+		entries = append(entries, base)
+	}
+	logFields["entries"] = entries
+	if _, ok := logFields["version"]; !ok {
+		logFields["version"] = "1.2"
+	}
+	return map[string]interface{}{"log": logFields}, nil
+}
+
+// overlayResponse puts the parts of res a simulation can change onto a
+// recorded entry: the status, the body and its mimeType. Everything else,
+// including the headers, cookies and query parameters the conversion
+// dropped or stopped matching on, stays as recorded.
+func overlayResponse(entry map[string]interface{}, res Response) {
+	response, _ := entry["response"].(map[string]interface{})
+	if response == nil {
+		response = map[string]interface{}{}
+		entry["response"] = response
+	}
+	response["status"] = res.Status
+	content, _ := response["content"].(map[string]interface{})
+	if content == nil {
+		content = map[string]interface{}{}
+		response["content"] = content
+	}
+	content["text"] = res.Body
+	if res.EncodedBody {
+		content["encoding"] = "base64"
+	} else {
+		delete(content, "encoding")
+	}
+	if ct := firstValue(res.Headers["Content-Type"]); ct != "" {
+		content["mimeType"] = ct
+	}
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	return out, json.Unmarshal(data, &out)
+}
+
+func runToHAR(args []string) {
+	flags := flag.NewFlagSet("to-har", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file")
+	sidecarFile := flags.String("sidecar", "", "Sidecar written by --har-sidecar during conversion (optional)")
+	outputFile := flags.String("output", "", "Path to write the HAR file (optional, defaults to stdout)")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a simulation file with --input")
+	}
+
+	sim, err := readSimulation(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to parse simulation: %v", err)
+	}
+
+	var har interface{} = simulationToHAR(sim)
+	if *sidecarFile != "" {
+		data, err := os.ReadFile(*sidecarFile)
+		if err != nil {
+			log.Fatalf("Failed to read sidecar: %v", err)
+		}
+		var sidecar harSidecar
+		if err := json.Unmarshal(data, &sidecar); err != nil {
+			log.Fatalf("Failed to parse sidecar: %v", err)
+		}
+		har, err = sidecarHAR(sim, sidecar)
+		if err != nil {
+			log.Fatalf("Failed to apply sidecar: %v", err)
+		}
+	}
+
+	output, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to serialize HAR: %v", err)
+	}
+	if err := writeOutput(*outputFile, output); err != nil {
+		log.Fatalf("Failed to write output file: %v", err)
+	}
+}
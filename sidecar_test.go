@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+const sidecarTestEntry = `{
+  "startedDateTime": "2024-01-01T00:00:00.000Z",
+  "time": 42,
+  "request": {
+    "method": "GET",
+    "url": "https://api.example.com/users?id=1&id=2",
+    "httpVersion": "HTTP/2",
+    "headers": [
+      {"name": "Accept", "value": "application/json"},
+      {"name": "traceparent", "value": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+      {"name": "Cookie", "value": "session=abc"}
+    ],
+    "queryString": [{"name": "id", "value": "1"}, {"name": "id", "value": "2"}],
+    "cookies": [{"name": "session", "value": "abc"}]
+  },
+  "response": {
+    "status": 200,
+    "httpVersion": "HTTP/2",
+    "headers": [
+      {"name": "Content-Type", "value": "application/json"},
+      {"name": "Cache-Control", "value": "no-store"},
+      {"name": "X-Request-Id", "value": "req-1"},
+      {"name": "Set-Cookie", "value": "session=def; Path=/"}
+    ],
+    "cookies": [{"name": "session", "value": "def", "path": "/"}],
+    "content": {"size": 9, "mimeType": "application/json", "text": "{\"id\":1}"}
+  },
+  "timings": {"send": 1, "wait": 40, "receive": 1},
+  "_resourceType": "fetch"
+}`
+
+// sidecarTestPair converts sidecarTestEntry with the default options.
+func sidecarTestPair(t *testing.T) Pair {
+	t.Helper()
+	opts := addEntryFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	opts.parse()
+	conv := newEntryConverter(opts, "test.har")
+	conv.setPages(nil)
+	var entry Entry
+	if err := json.Unmarshal([]byte(sidecarTestEntry), &entry); err != nil {
+		t.Fatal(err)
+	}
+	prepared, ok := conv.prepare(0, entry)
+	if !ok {
+		t.Fatal("entry was skipped")
+	}
+	return conv.build(0, prepared, 0)
+}
+
+func TestSidecarHAR(t *testing.T) {
+	pair := sidecarTestPair(t)
+	if _, ok := pair.Request.Headers["traceparent"]; ok {
+		t.Fatal("the conversion kept traceparent, so the round trip proves nothing")
+	}
+
+	tests := []struct {
+		name string
+		edit func(*Pair)
+		// want applies the expected edits to the recorded entry.
+		want func(entry map[string]interface{})
+	}{
+		{
+			name: "unedited pair",
+			edit: func(*Pair) {},
+		},
+		{
+			name: "edited response",
+			edit: func(p *Pair) {
+				p.Response.Status = 404
+				p.Response.Body = "bm90IGZvdW5k"
+				p.Response.EncodedBody = true
+				p.Response.Headers = Header{"Content-Type": {"text/plain"}}
+			},
+			want: func(entry map[string]interface{}) {
+				response := entry["response"].(map[string]interface{})
+				response["status"] = float64(404)
+				content := response["content"].(map[string]interface{})
+				content["text"] = "bm90IGZvdW5k"
+				content["encoding"] = "base64"
+				content["mimeType"] = "text/plain"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pair
+			tt.edit(&p)
+			var sim Simulation
+			sim.Data.Pairs = []Pair{p}
+			sidecar := harSidecar{Entries: []sidecarEntry{{Pair: 0, Key: sidecarKey(pair), Entry: json.RawMessage(sidecarTestEntry)}}}
+			har, err := sidecarHAR(sim, sidecar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := toJSONValue(har["log"].(map[string]interface{})["entries"].([]interface{})[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(sidecarTestEntry), &want); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil {
+				tt.want(want)
+			}
+			if !reflect.DeepEqual(got, interface{}(want)) {
+				gotJSON, _ := json.MarshalIndent(got, "", "  ")
+				t.Errorf("got entry\n%s\nwant the recorded entry with only the pair's edits", gotJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// signatureQueryParams are query parameters carrying per-request signatures
+// or the values folded into them (presigned AWS/GCS/Azure URLs, generic
+// HMAC-signed links).
+var signatureQueryParams = []string{
+	"X-Amz-Signature", "X-Amz-Date", "X-Amz-Credential", "X-Amz-Security-Token", "X-Amz-Expires",
+	"X-Goog-Signature", "X-Goog-Date", "X-Goog-Credential", "X-Goog-Expires",
+	"sig", "signature", "Signature", "se", "st", "hmac", "Expires",
+}
+
+// signatureHeaders change on every signed request.
+var signatureHeaders = []string{
+	"X-Amz-Date", "X-Amz-Security-Token", "X-Amz-Content-Sha256",
+	"Signature", "Signature-Input", "Digest", "X-Signature", "X-Hub-Signature", "X-Hub-Signature-256",
+}
+
+// signedAuthorizationPrefixes identify Authorization headers that embed a
+// request signature rather than a reusable credential.
+var signedAuthorizationPrefixes = []string{"AWS4-HMAC-SHA256", "AWS ", "HMAC", "Signature ", "hmac "}
+
+// stripSignatures removes signature-bearing headers and query parameters
+// from the request matchers. Hoverfly ignores headers and query parameters
+// that a matcher doesn't mention, so replayed requests still match with
+// whatever fresh signature the client computes. It returns the names that
+// were dropped.
+func stripSignatures(p *Pair) []string {
+	var stripped []string
+	for k := range p.Request.Query {
+		for _, name := range signatureQueryParams {
+			// Vendor X- names are case-insensitive; short generic names
+			// like "st" must match exactly to avoid dropping real params.
+			if k == name || strings.EqualFold(k, name) && strings.HasPrefix(name, "X-") {
+				delete(p.Request.Query, k)
+				stripped = append(stripped, "query:"+k)
+				break
+			}
+		}
+	}
+	for k, matchers := range p.Request.Headers {
+		drop := false
+		for _, name := range signatureHeaders {
+			if strings.EqualFold(k, name) {
+				drop = true
+			}
+		}
+		if strings.EqualFold(k, "Authorization") && len(matchers) > 0 {
+			for _, prefix := range signedAuthorizationPrefixes {
+				if strings.HasPrefix(matchers[0].Value, prefix) {
+					drop = true
+				}
+			}
+		}
+		if drop {
+			delete(p.Request.Headers, k)
+			stripped = append(stripped, "header:"+k)
+		}
+	}
+	sort.Strings(stripped)
+	return stripped
+}
+
+type relaxedPair struct {
+	index              int
+	method, host, path string
+	stripped           []string
+}
+
+// writeSignatureReport lists the pairs whose signatures were relaxed.
+func writeSignatureReport(w io.Writer, relaxed []relaxedPair) {
+	if len(relaxed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Relaxed signatures on %d pair(s):\n", len(relaxed))
+	fmt.Fprintf(w, "%-6s %-30s %-10s %-50s %s\n", "PAIR", "HOST", "METHOD", "PATH", "STRIPPED")
+	for _, r := range relaxed {
+		fmt.Fprintf(w, "%-6d %-30s %-10s %-50s %s\n", r.index, r.host, r.method, truncate(r.path, 50), strings.Join(r.stripped, ","))
+	}
+}
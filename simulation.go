@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readSimulation loads a Hoverfly simulation file from disk. Files with a
+// .yaml or .yml extension are read as YAML.
+func readSimulation(path string) (Simulation, error) {
+	var sim Simulation
+	data, err := readSimulationJSON(path)
+	if err != nil {
+		return sim, err
+	}
+	if err := json.Unmarshal(data, &sim); err != nil {
+		return sim, fmt.Errorf("%s: %v", path, err)
+	}
+	return sim, nil
+}
+
+// readSimulationJSON returns the raw JSON of a simulation file, converting
+// it from YAML first when needed. Commands that pass a simulation straight
+// through to Hoverfly use this so no fields are lost to the Simulation type.
+func readSimulationJSON(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isYAMLPath(path) {
+		return data, nil
+	}
+	data, err = yamlToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return data, nil
+}
+
+// marshalSimulation serializes sim as indented JSON, or as YAML when
+// asYAML is set.
+func marshalSimulation(sim Simulation, asYAML bool) ([]byte, error) {
+	// Encoding and indenting through pooled buffers leaves a single copy
+	// of the output as the only large allocation.
+	compact, buf := getBuffer(), getBuffer()
+	defer putBuffer(compact)
+	defer putBuffer(buf)
+	if err := json.NewEncoder(compact).Encode(sim); err != nil {
+		return nil, err
+	}
+	if err := json.Indent(buf, bytes.TrimSuffix(compact.Bytes(), []byte("\n")), "", "  "); err != nil {
+		return nil, err
+	}
+	if asYAML {
+		return jsonToYAML(buf.Bytes())
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+func isYAMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// jsonToYAML and yamlToJSON go through generic values rather than the
+// Simulation structs so key names stay exactly as Hoverfly spells them.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// writeOutput writes data to path, or to stdout when path is empty.
+func writeOutput(path string, data []byte) error {
+	if path == "" {
+		// Write the bytes directly; converting a large simulation to a
+		// string first would copy it.
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+		_, err := os.Stdout.Write([]byte("\n"))
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
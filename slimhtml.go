@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// --slim-html cuts HTML bodies down to their structure for tests that only
+// assert on the page markup: inline script bodies are emptied, analytics
+// tags removed and base64 data URIs emptied. Elements are otherwise left
+// as recorded, so selectors still find what they did.
+
+var (
+	htmlScript   = regexp.MustCompile(`(?is)<script\b([^>]*)>(.*?)</script\s*>`)
+	htmlNoscript = regexp.MustCompile(`(?is)<noscript\b[^>]*>(.*?)</noscript\s*>`)
+	htmlSrc      = regexp.MustCompile(`(?is)\bsrc\s*=\s*["']?([^"'\s>]+)`)
+)
+
+// analyticsHosts are the tag managers and trackers whose script and pixel
+// tags are removed. They never change page structure, and a replayed page
+// would only try to reach them.
+var analyticsHosts = []string{
+	"googletagmanager.com", "google-analytics.com", "doubleclick.net",
+	"connect.facebook.net", "facebook.com/tr", "cdn.segment.com", "static.hotjar.com",
+	"js.hs-analytics.net", "snap.licdn.com", "bat.bing.com", "static.ads-twitter.com",
+	"cdn.mxpnl.com", "plausible.io", "cloudflareinsights.com", "newrelic.com", "nr-data.net",
+}
+
+func isAnalytics(s string) bool {
+	s = strings.ToLower(s)
+	for _, host := range analyticsHosts {
+		if strings.Contains(s, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// slimHTML returns body with inline scripts emptied, analytics script and
+// noscript tags removed, and the payload of base64 data URIs dropped.
+// Inline scripts that load analytics, such as the Google Tag Manager
+// snippet, are removed along with external ones.
+func slimHTML(body string) string {
+	body = htmlScript.ReplaceAllStringFunc(body, func(tag string) string {
+		m := htmlScript.FindStringSubmatch(tag)
+		attrs, content := m[1], m[2]
+		if src := htmlSrc.FindStringSubmatch(attrs); src != nil {
+			if isAnalytics(src[1]) {
+				return ""
+			}
+			return tag
+		}
+		if isAnalytics(content) {
+			return ""
+		}
+		return "<script" + attrs + "></script>"
+	})
+	body = htmlNoscript.ReplaceAllStringFunc(body, func(tag string) string {
+		if isAnalytics(tag) {
+			return ""
+		}
+		return tag
+	})
+	return stripDataURIs(body)
+}
+
+// isHTMLResponse reports whether p serves an HTML text body.
+func isHTMLResponse(p Pair) bool {
+	if p.Response.EncodedBody || p.Response.Body == "" {
+		return false
+	}
+	for name, values := range p.Response.Headers {
+		if strings.EqualFold(name, "Content-Type") {
+			for _, v := range values {
+				if strings.Contains(strings.ToLower(v), "html") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// htmlSlimming totals what --slim-html saved.
+type htmlSlimming struct {
+	pairs         int
+	before, after int
+}
+
+func (s *htmlSlimming) apply(p *Pair) bool {
+	if !isHTMLResponse(*p) {
+		return false
+	}
+	slim := slimHTML(p.Response.Body)
+	if len(slim) == len(p.Response.Body) {
+		return false
+	}
+	s.pairs++
+	s.before += len(p.Response.Body)
+	s.after += len(slim)
+	p.Response.Body = slim
+	return true
+}
+
+func (s htmlSlimming) write() {
+	if s.pairs == 0 {
+		return
+	}
+	log.Printf("Slimmed %d HTML response(s) from %d to %d bytes", s.pairs, s.before, s.after)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sloRule is one pattern=milliseconds entry from --slo. Patterns without a
+// slash match the host; patterns with one match host+path. Both are globs.
+type sloRule struct {
+	pattern   string
+	threshold float64
+}
+
+func parseSLORules(spec string) ([]sloRule, error) {
+	var rules []sloRule
+	for _, item := range splitList(spec) {
+		pattern, ms, ok := strings.Cut(item, "=")
+		if !ok {
+			// A bare number is the default threshold for every endpoint.
+			pattern, ms = "*", item
+		}
+		threshold, err := strconv.ParseFloat(ms, 64)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("invalid SLO threshold %q: expected pattern=milliseconds", item)
+		}
+		rules = append(rules, sloRule{pattern: pattern, threshold: threshold})
+	}
+	return rules, nil
+}
+
+// sloThreshold returns the threshold of the most specific matching rule,
+// preferring host+path rules over host rules over the "*" default.
+func sloThreshold(rules []sloRule, host, p string) (float64, bool) {
+	best, bestRank := 0.0, -1
+	for _, r := range rules {
+		if rank := patternRank(r.pattern, host, p); rank > bestRank {
+			best, bestRank = r.threshold, rank
+		}
+	}
+	return best, bestRank >= 0
+}
+
+// patternRank returns how specifically an endpoint pattern matches: 2 for a
+// host+path glob, 1 for a host glob, 0 for "*", or -1 for no match.
+func patternRank(pattern, host, p string) int {
+	switch {
+	case pattern == "*":
+		return 0
+	case strings.Contains(pattern, "/"):
+		if ok, _ := path.Match(pattern, host+p); ok {
+			return 2
+		}
+	default:
+		if ok, _ := path.Match(pattern, host); ok {
+			return 1
+		}
+	}
+	return -1
+}
+
+type sloEndpoint struct {
+	method, host, path string
+	threshold          float64
+	count, breaches    int
+	max                float64
+}
+
+// sloReport accumulates recorded latencies per endpoint.
+type sloReport struct {
+	rules     []sloRule
+	endpoints map[string]*sloEndpoint
+}
+
+func newSLOReport(rules []sloRule) *sloReport {
+	return &sloReport{rules: rules, endpoints: map[string]*sloEndpoint{}}
+}
+
+// record adds one entry's latency and reports whether it breached the SLO.
+func (r *sloReport) record(method, host, p string, elapsed float64) bool {
+	threshold, ok := sloThreshold(r.rules, host, p)
+	if !ok {
+		return false
+	}
+	key := method + " " + host + p
+	ep, found := r.endpoints[key]
+	if !found {
+		ep = &sloEndpoint{method: method, host: host, path: p, threshold: threshold}
+		r.endpoints[key] = ep
+	}
+	ep.count++
+	if elapsed > ep.max {
+		ep.max = elapsed
+	}
+	if elapsed > threshold {
+		ep.breaches++
+		return true
+	}
+	return false
+}
+
+// write prints every endpoint that breached its threshold at least once.
+func (r *sloReport) write(w io.Writer) {
+	var breached []*sloEndpoint
+	for _, ep := range r.endpoints {
+		if ep.breaches > 0 {
+			breached = append(breached, ep)
+		}
+	}
+	if len(breached) == 0 {
+		fmt.Fprintln(w, "All endpoints within SLO thresholds")
+		return
+	}
+	sort.Slice(breached, func(i, j int) bool {
+		return breached[i].host+breached[i].path+breached[i].method < breached[j].host+breached[j].path+breached[j].method
+	})
+	fmt.Fprintf(w, "%-30s %-10s %-50s %10s %10s %10s\n", "HOST", "METHOD", "PATH", "SLO(ms)", "MAX(ms)", "BREACHES")
+	for _, ep := range breached {
+		fmt.Fprintf(w, "%-30s %-10s %-50s %10.0f %10.0f %6d/%-3d\n", ep.host, ep.method, truncate(ep.path, 50), ep.threshold, ep.max, ep.breaches, ep.count)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/base64"
+	"log"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffBytes is how much of a body the binary heuristic looks at.
+const sniffBytes = 4096
+
+// looksBinary reports whether a body the HAR stores as text is really
+// binary, e.g. gzip or an image served with a text MIME type. Text has few
+// control or replacement characters; compressed and encrypted data is
+// full of them and its bytes are close to uniformly distributed.
+func looksBinary(text string) bool {
+	if len(text) > sniffBytes {
+		text = text[:sniffBytes]
+	}
+	runes, unprintable := 0, 0
+	for _, r := range text {
+		runes++
+		switch {
+		case r == utf8.RuneError, r == 0x7f:
+			unprintable++
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f':
+			unprintable++
+		case r >= 0x80 && r < 0xa0:
+			// C1 controls, which binary mapped byte-for-byte to Latin-1
+			// is full of.
+			unprintable++
+		}
+	}
+	if runes == 0 {
+		return false
+	}
+	ratio := float64(unprintable) / float64(runes)
+	return ratio > 0.1 || ratio > 0.01 && byteEntropy(text) > 7.2
+}
+
+// byteEntropy is the Shannon entropy of s in bits per byte.
+func byteEntropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(s))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// recoverBinary returns a binary body stored as text as base64, when the
+// recorder mapped each byte to a Latin-1 character. Recorders that decoded
+// the bytes as UTF-8 replaced invalid sequences, so those bodies can't be
+// recovered.
+func recoverBinary(text string) (string, bool) {
+	raw := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > 0xff {
+			return "", false
+		}
+		raw = append(raw, byte(r))
+	}
+	return base64.StdEncoding.EncodeToString(raw), true
+}
+
+// sniffedBodies lists the text-labelled bodies that looked binary, by what
+// was done with them.
+type sniffedBodies struct {
+	recovered, emptied, skipped []string
+}
+
+func (s sniffedBodies) write() {
+	if len(s.recovered) > 0 {
+		log.Printf("%d response body(ies) stored as text look binary and are served as encodedBody:\n  %s", len(s.recovered), strings.Join(s.recovered, "\n  "))
+	}
+	if len(s.emptied) > 0 {
+		log.Printf("%d response body(ies) stored as text look binary but were corrupted by the recorder, so they were emptied:\n  %s", len(s.emptied), strings.Join(s.emptied, "\n  "))
+	}
+	if len(s.skipped) > 0 {
+		log.Printf("%d entr(ies) with a text MIME type but a binary-looking body were skipped by --ignore-non-text", len(s.skipped))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// splitManifest lists the files of a split output, so deployment tooling
+// can check every file arrived intact before importing any of them.
+type splitManifest struct {
+	Pairs int                 `json:"pairs"`
+	Files []splitManifestFile `json:"files"`
+}
+
+// splitManifestFile is one file of a split output. Path is relative to the
+// manifest, which is written next to the files.
+type splitManifestFile struct {
+	Path   string `json:"path"`
+	Pairs  int    `json:"pairs"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeSplit writes one output file per part, where parts[i] names the part
+// that sim.Data.Pairs[i] belongs to. Files are named after --output with
+// the part name appended, in order of each part's first pair, and listed
+// with their checksums in a <output>-manifest.json written last.
+func writeSplit(sim Simulation, parts []string, output string, render func(Simulation, outputOptions) ([]byte, error), opts outputOptions) error {
+	sims := map[string]Simulation{}
+	var order []string
+	for i, pair := range sim.Data.Pairs {
+		part, ok := sims[parts[i]]
+		if !ok {
+			part = sim
+			part.Data.Pairs = nil
+			order = append(order, parts[i])
+		}
+		part.Data.Pairs = append(part.Data.Pairs, pair)
+		sims[parts[i]] = part
+	}
+
+	manifest := splitManifest{Pairs: len(sim.Data.Pairs), Files: []splitManifestFile{}}
+	for _, name := range order {
+		// Each part is a ConfigMap of its own, so applying them in turn
+		// doesn't leave only the last.
+		partOpts := opts
+		if partOpts.k8sName == "" {
+			partOpts.k8sName = defaultK8sName
+		}
+		partOpts.k8sName = k8sObjectName(partOpts.k8sName + "-" + name)
+		data, err := render(sims[name], partOpts)
+		if err != nil {
+			return err
+		}
+		path := splitOutputPath(output, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		log.Printf("Wrote %d pair(s) to %s", len(sims[name].Data.Pairs), path)
+		manifest.Files = append(manifest.Files, splitManifestFile{
+			Path:   filepath.Base(path),
+			Pairs:  len(sims[name].Data.Pairs),
+			Bytes:  len(data),
+			SHA256: fmt.Sprintf("%x", sha256.Sum256(data)),
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := strings.TrimSuffix(output, filepath.Ext(output)) + "-manifest.json"
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	log.Printf("Wrote manifest of %d file(s) to %s", len(manifest.Files), path)
+	return nil
+}
+
+// splitOutputPath derives the file name for one part of a split output,
+// e.g. sim.json + "session-2" -> sim-session-2.json.
+func splitOutputPath(output, part string) string {
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + "-" + part + ext
+}
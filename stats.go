@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stats reads simulations through a looser shape than Simulation so files
+// written by Hoverfly or other tools load too: matcher values may be lists
+// or objects, as array and form matchers take, and request fields this
+// tool never writes are still counted.
+
+// statsMatcher is a request matcher with its value kept as raw JSON.
+type statsMatcher struct {
+	Matcher string          `json:"matcher"`
+	Value   json.RawMessage `json:"value"`
+}
+
+type statsPair struct {
+	Request  map[string]json.RawMessage `json:"request"`
+	Response struct {
+		Status      int    `json:"status"`
+		Body        string `json:"body"`
+		BodyFile    string `json:"bodyFile"`
+		EncodedBody bool   `json:"encodedBody"`
+	} `json:"response"`
+}
+
+type statsSimulation struct {
+	Data struct {
+		Pairs []statsPair `json:"pairs"`
+	} `json:"data"`
+	Meta struct {
+		SchemaVersion string `json:"schemaVersion"`
+	} `json:"meta"`
+}
+
+// fieldMatchers returns the matchers of every request field, keyed by the
+// field name. Fields keyed by header or parameter name, such as headers
+// and query, are merged under the field's name. Fields that hold no
+// matchers, such as requiresState, are left out.
+func (p statsPair) fieldMatchers() map[string][]statsMatcher {
+	fields := map[string][]statsMatcher{}
+	for field, raw := range p.Request {
+		var list []statsMatcher
+		if json.Unmarshal(raw, &list) == nil {
+			fields[field] = append(fields[field], list...)
+			continue
+		}
+		var keyed map[string][]statsMatcher
+		if json.Unmarshal(raw, &keyed) == nil {
+			for _, ms := range keyed {
+				fields[field] = append(fields[field], ms...)
+			}
+		}
+	}
+	return fields
+}
+
+// matcherValue renders a matcher value, unquoting strings.
+func matcherValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, raw) != nil {
+		return string(raw)
+	}
+	return compact.String()
+}
+
+// field returns the value p's exact matcher on field expects, the first
+// other matcher's type and value, or * when it matches anything.
+func (p statsPair) field(name string) string {
+	var list []statsMatcher
+	json.Unmarshal(p.Request[name], &list)
+	for _, m := range list {
+		if m.Matcher == "exact" {
+			return matcherValue(m.Value)
+		}
+	}
+	if len(list) == 0 {
+		return "*"
+	}
+	return list[0].Matcher + " " + matcherValue(list[0].Value)
+}
+
+func (p statsPair) describe() string {
+	return p.field("method") + " " + p.field("destination") + p.field("path")
+}
+
+// requestKey renders p's request matchers canonically, with object keys
+// sorted, so pairs Hoverfly can't tell apart get the same key.
+func (p statsPair) requestKey() string {
+	canonical := map[string]interface{}{}
+	for field, raw := range p.Request {
+		var v interface{}
+		if json.Unmarshal(raw, &v) == nil {
+			canonical[field] = v
+		}
+	}
+	key, _ := json.Marshal(canonical)
+	return string(key)
+}
+
+// bodySizeBuckets are the upper bounds of the body size histogram's bars,
+// after a bar for empty bodies; a last bar takes everything larger.
+var bodySizeBuckets = []struct {
+	limit int
+	label string
+}{
+	{1 << 10, "< 1 KiB"},
+	{10 << 10, "1-10 KiB"},
+	{100 << 10, "10-100 KiB"},
+	{1 << 20, "100 KiB-1 MiB"},
+}
+
+// bodySize returns the size of p's response body as served, or -1 when it
+// is read from a bodyFile.
+func (p statsPair) bodySize() int {
+	if p.Response.BodyFile != "" {
+		return -1
+	}
+	if p.Response.EncodedBody {
+		if decoded, err := base64.StdEncoding.DecodeString(p.Response.Body); err == nil {
+			return len(decoded)
+		}
+	}
+	return len(p.Response.Body)
+}
+
+func runStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the simulation JSON or YAML file")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a simulation file with --input")
+	}
+	data, err := readSimulationJSON(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to read simulation: %v", err)
+	}
+	var sim statsSimulation
+	if err := json.Unmarshal(data, &sim); err != nil {
+		log.Fatalf("Failed to parse simulation: %s: %v", *inputFile, err)
+	}
+	pairs := sim.Data.Pairs
+
+	hosts, methods, statuses := map[string]int{}, map[string]int{}, map[string]int{}
+	matchers := map[string]map[string]int{}
+	allMatchers := map[string]int{}
+	sizes := make([]int, len(bodySizeBuckets)+2)
+	bodyFiles := 0
+	requests := map[string][]int{}
+	var order []string
+	for i, p := range pairs {
+		hosts[p.field("destination")]++
+		methods[p.field("method")]++
+		statuses[strconv.Itoa(p.Response.Status)]++
+		for field, ms := range p.fieldMatchers() {
+			if matchers[field] == nil {
+				matchers[field] = map[string]int{}
+			}
+			for _, m := range ms {
+				matchers[field][m.Matcher]++
+				allMatchers[m.Matcher]++
+			}
+		}
+		switch size := p.bodySize(); {
+		case size < 0:
+			bodyFiles++
+		case size == 0:
+			sizes[0]++
+		default:
+			bar := len(sizes) - 1
+			for b, bucket := range bodySizeBuckets {
+				if size < bucket.limit {
+					bar = b + 1
+					break
+				}
+			}
+			sizes[bar]++
+		}
+		key := p.requestKey()
+		if _, ok := requests[key]; !ok {
+			order = append(order, key)
+		}
+		requests[key] = append(requests[key], i)
+	}
+
+	schema := sim.Meta.SchemaVersion
+	if schema == "" {
+		schema = "unknown"
+	}
+	fmt.Printf("%d pair(s), schema %s\n", len(pairs), schema)
+	writeStatsCounts("HOST", hosts)
+	writeStatsCounts("METHOD", methods)
+	writeStatsCounts("STATUS", statuses)
+
+	fields := make([]string, 0, len(matchers))
+	for field := range matchers {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	fmt.Printf("\n%-20s %s\n", "FIELD", "MATCHERS")
+	for _, field := range fields {
+		fmt.Printf("%-20s %s\n", field, countList(matchers[field]))
+	}
+	fmt.Printf("%-20s %s\n", "(all)", countList(allMatchers))
+
+	labels := []string{"empty"}
+	for _, bucket := range bodySizeBuckets {
+		labels = append(labels, bucket.label)
+	}
+	labels = append(labels, ">= 1 MiB")
+	most := 1
+	for _, n := range sizes {
+		if n > most {
+			most = n
+		}
+	}
+	fmt.Printf("\n%-20s %s\n", "BODY SIZE", "PAIRS")
+	for b, n := range sizes {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("%-20s %-8d %s", labels[b], n, strings.Repeat("#", (n*40+most-1)/most)), " "))
+	}
+	if bodyFiles > 0 {
+		fmt.Printf("%-20s %d\n", "bodyFile", bodyFiles)
+	}
+
+	var duplicates []string
+	for _, key := range order {
+		if indexes := requests[key]; len(indexes) > 1 {
+			ids := make([]string, len(indexes))
+			for i, index := range indexes {
+				ids[i] = strconv.Itoa(index)
+			}
+			duplicates = append(duplicates, fmt.Sprintf("pairs %s: %s", strings.Join(ids, ", "), pairs[indexes[0]].describe()))
+		}
+	}
+	if len(duplicates) == 0 {
+		fmt.Println("\nNo duplicate request matchers")
+		return
+	}
+	fmt.Printf("\n%d set(s) of pairs with the same request matchers; Hoverfly only serves the first of each:\n  %s\n",
+		len(duplicates), strings.Join(duplicates, "\n  "))
+}
+
+// writeStatsCounts prints a table of pair counts, most frequent first.
+func writeStatsCounts(title string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Printf("\n%-40s %s\n", title, "PAIRS")
+	for _, k := range keys {
+		fmt.Printf("%-40s %d\n", truncate(k, 40), counts[k])
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Timings is the HAR breakdown of an entry's time in milliseconds; -1
+// marks phases that don't apply.
+type Timings struct {
+	Blocked float64 `json:"blocked,omitempty"`
+	DNS     float64 `json:"dns,omitempty"`
+	Connect float64 `json:"connect,omitempty"`
+	SSL     float64 `json:"ssl,omitempty"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// streamReceiveMs is how long a body must take to arrive after the first
+// byte before the response is considered streamed.
+const streamReceiveMs = 500
+
+// transferMode classifies how the response body was delivered: "chunked"
+// when sent with chunked transfer encoding, "stream" for event streams and
+// bodies that kept arriving long after the first byte, or "" otherwise.
+func transferMode(entry Entry) string {
+	res := entry.Response
+	if strings.Contains(strings.ToLower(res.Content.MimeType), "text/event-stream") {
+		return "stream"
+	}
+	chunked := false
+	for _, h := range res.Headers {
+		if strings.EqualFold(h.Name, "Transfer-Encoding") && strings.Contains(strings.ToLower(h.Value), "chunked") {
+			chunked = true
+		}
+	}
+	if t := entry.Timings; t != nil && t.Receive >= streamReceiveMs && t.Receive > t.Wait {
+		return "stream"
+	}
+	if chunked {
+		return "chunked"
+	}
+	return ""
+}
+
+// timeToFirstByte returns the recorded wait time, or -1 when the HAR has
+// no timings.
+func timeToFirstByte(entry Entry) int {
+	if entry.Timings == nil || entry.Timings.Wait < 0 {
+		return -1
+	}
+	return int(math.Round(entry.Timings.Wait))
+}
+
+// addStreamingLabels labels p with transfer:<mode> and ttfb:<ms>.
+func addStreamingLabels(p *Pair, entry Entry) {
+	if mode := transferMode(entry); mode != "" {
+		p.Labels = append(p.Labels, "transfer:"+mode)
+	}
+	if ttfb := timeToFirstByte(entry); ttfb >= 0 {
+		p.Labels = append(p.Labels, fmt.Sprintf("ttfb:%d", ttfb))
+	}
+}
+
+// applyTTFBDelay approximates the recorded time to first byte with a fixed
+// delay. Hoverfly delays the whole response, so for streamed bodies the
+// rest of the transfer is not reproduced.
+func applyTTFBDelay(p *Pair, entry Entry) {
+	if ttfb := timeToFirstByte(entry); ttfb > p.Response.FixedDelay {
+		p.Response.FixedDelay = ttfb
+	}
+}
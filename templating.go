@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// templateRule enables Hoverfly response templating for the pairs it
+// selects and rewrites recorded values into template expressions, e.g.
+// replacing a captured timestamp with {{ now "" "unix" }}.
+type templateRule struct {
+	Host          string                 `json:"host"`
+	Path          string                 `json:"path"`
+	Method        string                 `json:"method"`
+	Substitutions []templateSubstitution `json:"substitutions"`
+}
+
+type templateSubstitution struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+}
+
+// readTemplateRules loads a JSON or YAML file holding a list of rules.
+func readTemplateRules(path string) ([]templateRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLPath(path) {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	var rules []templateRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rules, nil
+}
+
+func (r templateRule) selector() *pairSelector {
+	return &pairSelector{host: r.Host, path: r.Path, method: r.Method}
+}
+
+// applyTemplateRules turns on templating for the pair if any rule selects
+// it. Braces already present in the recording are escaped first so that
+// only the configured substitutions are evaluated by Hoverfly.
+func applyTemplateRules(p *Pair, rules []templateRule) {
+	var matched []templateRule
+	for _, r := range rules {
+		if r.selector().matches(*p) {
+			matched = append(matched, r)
+		}
+	}
+	if len(matched) == 0 || p.Response.EncodedBody {
+		return
+	}
+
+	p.Response.Templated = true
+	p.Response.Body = escapeTemplateSyntax(p.Response.Body)
+	for name, values := range p.Response.Headers {
+		for i, v := range values {
+			p.Response.Headers[name][i] = escapeTemplateSyntax(v)
+		}
+	}
+	for _, r := range matched {
+		for _, s := range r.Substitutions {
+			if s.Find == "" {
+				continue
+			}
+			p.Response.Body = strings.ReplaceAll(p.Response.Body, s.Find, s.Replace)
+			for name, values := range p.Response.Headers {
+				for i, v := range values {
+					p.Response.Headers[name][i] = strings.ReplaceAll(v, s.Find, s.Replace)
+				}
+			}
+		}
+	}
+}
+
+// escapeTemplateSyntax escapes Handlebars mustaches so Hoverfly's template
+// engine emits them literally. Mustaches that are already escaped are left
+// alone, so escaping twice is harmless.
+func escapeTemplateSyntax(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i])
+		if i == 0 || s[i-1] != '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteString("{{")
+		s = s[i+2:]
+	}
+}
+
+// hasTemplateSyntax reports whether a non-templated response contains
+// mustaches. Hoverfly serves these verbatim, but they break as soon as
+// someone turns templating on for the pair, so they are worth flagging.
+func hasTemplateSyntax(res Response) bool {
+	if res.Templated || res.EncodedBody {
+		return false
+	}
+	return strings.Contains(res.Body, "{{")
+}
+
+func runEscapeTemplates(args []string) {
+	editSimulation("escape-templates", args, func(flags *flag.FlagSet, _ *pairSelector) func() error {
+		return func() error { return nil }
+	}, func(p *Pair) bool {
+		if !p.Response.EncodedBody {
+			p.Response.Body = escapeTemplateSyntax(p.Response.Body)
+		}
+		return true
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/format"
+	"strconv"
+	"text/template"
+)
+
+// renderTestcontainers emits a Go source file embedding the simulation and
+// a StartHoverfly helper that runs Hoverfly via testcontainers-go with the
+// simulation already imported, so integration tests get a one-call setup.
+func renderTestcontainers(sim Simulation, opts outputOptions) ([]byte, error) {
+	data, err := json.Marshal(sim)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := opts.goPackage
+	if pkg == "" {
+		pkg = "fixtures"
+	}
+	image := opts.hoverflyImage
+	if image == "" {
+		image = "spectolabs/hoverfly:latest"
+	}
+
+	var buf bytes.Buffer
+	err = testcontainersTemplate.Execute(&buf, struct {
+		Package    string
+		Image      string
+		Simulation string
+	}{pkg, image, string(data)})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+var testcontainersTemplate = template.Must(template.New("testcontainers").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`// Code generated by har-to-hoverfly; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Image is the Hoverfly image StartHoverfly runs.
+const Image = {{quote .Image}}
+
+// Simulation is the Hoverfly simulation converted from the HAR capture.
+const Simulation = {{quote .Simulation}}
+
+// Hoverfly is a running Hoverfly container with Simulation loaded.
+type Hoverfly struct {
+	Container testcontainers.Container
+	// ProxyURL is the address to configure as the HTTP proxy of the client
+	// under test.
+	ProxyURL string
+	// AdminURL is the base URL of the Hoverfly admin API.
+	AdminURL string
+}
+
+// StartHoverfly starts Hoverfly in simulate mode and imports Simulation.
+// Call Terminate when the test is done.
+func StartHoverfly(ctx context.Context) (*Hoverfly, error) {
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        Image,
+			ExposedPorts: []string{"8500/tcp", "8888/tcp"},
+			WaitingFor:   wait.ForHTTP("/api/v2/hoverfly/version").WithPort("8888/tcp"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start hoverfly: %w", err)
+	}
+
+	h := &Hoverfly{Container: c}
+	if err := h.init(ctx); err != nil {
+		c.Terminate(ctx)
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Hoverfly) init(ctx context.Context) error {
+	host, err := h.Container.Host(ctx)
+	if err != nil {
+		return err
+	}
+	proxyPort, err := h.Container.MappedPort(ctx, "8500/tcp")
+	if err != nil {
+		return err
+	}
+	adminPort, err := h.Container.MappedPort(ctx, "8888/tcp")
+	if err != nil {
+		return err
+	}
+	h.ProxyURL = fmt.Sprintf("http://%s:%s", host, proxyPort.Port())
+	h.AdminURL = fmt.Sprintf("http://%s:%s", host, adminPort.Port())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.AdminURL+"/api/v2/simulation", bytes.NewBufferString(Simulation))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to import simulation: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("failed to import simulation: %s: %s", res.Status, body)
+	}
+	return nil
+}
+
+// Terminate stops and removes the container.
+func (h *Hoverfly) Terminate(ctx context.Context) error {
+	return h.Container.Terminate(ctx)
+}
+`))
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// hostProtocols counts the protocol details seen for one host.
+type hostProtocols struct {
+	entries int
+	http    map[string]int
+	tls     map[string]int
+	ciphers map[string]int
+}
+
+func runTLSReport(args []string) {
+	flags := flag.NewFlagSet("tls-report", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to HAR file")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("You must provide a HAR file with --input")
+	}
+	har, err := readHAR(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to parse HAR: %v", err)
+	}
+
+	hosts := map[string]*hostProtocols{}
+	for _, entry := range har.Log.Entries {
+		host := parseURL(entry.Request.URL).Host
+		h, ok := hosts[host]
+		if !ok {
+			h = &hostProtocols{http: map[string]int{}, tls: map[string]int{}, ciphers: map[string]int{}}
+			hosts[host] = h
+		}
+		h.entries++
+		version := entry.Response.HTTPVersion
+		if version == "" {
+			version = entry.Request.HTTPVersion
+		}
+		if version != "" {
+			h.http[strings.ToLower(version)]++
+		}
+		if sd := entry.SecurityDetails; sd != nil {
+			if sd.Protocol != "" {
+				h.tls[sd.Protocol]++
+			}
+			if sd.Cipher != "" {
+				h.ciphers[sd.Cipher]++
+			}
+		}
+	}
+
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%-30s %-8s %-25s %-20s %s\n", "HOST", "ENTRIES", "HTTP", "TLS", "CIPHERS")
+	for _, host := range names {
+		h := hosts[host]
+		fmt.Printf("%-30s %-8d %-25s %-20s %s\n", truncate(host, 30), h.entries, countList(h.http), countList(h.tls), countList(h.ciphers))
+	}
+}
+
+// countList renders counts as "a(3),b(1)", most frequent first, or "-"
+// when the recorder captured nothing.
+func countList(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s(%d)", k, counts[k])
+	}
+	return strings.Join(parts, ",")
+}
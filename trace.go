@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// entryTracer records every conversion stage's decision for the entry
+// --trace-entry selects. Stages that transform the pair are traced by
+// diffing the pair before and after, so each one shows exactly which
+// matchers, headers or labels it touched. A nil tracer ignores everything,
+// so callers needn't check --trace-entry.
+type entryTracer struct {
+	index int
+	steps []string
+	last  map[string]string
+	pair  int
+}
+
+func newEntryTracer(index, entries int) (*entryTracer, error) {
+	if index < 0 {
+		return nil, nil
+	}
+	if index >= entries {
+		return nil, fmt.Errorf("entry %d doesn't exist; the HAR has %d entr(ies)", index, entries)
+	}
+	return &entryTracer{index: index, pair: -1}, nil
+}
+
+// step records a decision about entry i.
+func (t *entryTracer) step(i int, format string, args ...interface{}) {
+	if t == nil || i != t.index {
+		return
+	}
+	t.steps = append(t.steps, fmt.Sprintf(format, args...))
+}
+
+// stage records what a pipeline stage changed in the pair converted from
+// entry i. The first call records the pair as converted.
+func (t *entryTracer) stage(i int, name string, p Pair) {
+	if t == nil || i != t.index {
+		return
+	}
+	fields := flattenPair(p)
+	if t.last == nil {
+		names := make([]string, 0, len(fields))
+		for k := range fields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		t.step(i, "%s: %s", name, strings.Join(names, ", "))
+		t.last = fields
+		return
+	}
+	var changes []string
+	for k, v := range fields {
+		if old, ok := t.last[k]; !ok {
+			changes = append(changes, "+"+k)
+		} else if old != v {
+			changes = append(changes, "~"+k)
+		}
+	}
+	for k := range t.last {
+		if _, ok := fields[k]; !ok {
+			changes = append(changes, "-"+k)
+		}
+	}
+	t.last = fields
+	if len(changes) == 0 {
+		return
+	}
+	sort.Slice(changes, func(a, b int) bool { return changes[a][1:] < changes[b][1:] })
+	t.step(i, "%s: %s", name, strings.Join(changes, ", "))
+}
+
+// converted records the index of the pair entry i became.
+func (t *entryTracer) converted(i, pair int) {
+	if t != nil && i == t.index {
+		t.pair = pair
+	}
+}
+
+// renumber follows the traced pair to its index after pairs were
+// rewritten; moved maps old indexes to new ones.
+func (t *entryTracer) renumber(moved []int) {
+	if t != nil && t.pair >= 0 && t.pair < len(moved) {
+		t.pair = moved[t.pair]
+	}
+}
+
+// flattenPair maps the matchers, headers, labels and other fields of a pair
+// to their JSON, keyed by dotted paths such as request.headers.Accept.
+func flattenPair(p Pair) map[string]string {
+	var doc map[string]interface{}
+	data, _ := json.Marshal(p)
+	json.Unmarshal(data, &doc)
+	fields := map[string]string{}
+	var walk func(prefix string, v interface{}, depth int)
+	walk = func(prefix string, v interface{}, depth int) {
+		if m, ok := v.(map[string]interface{}); ok && depth < 3 {
+			for k, child := range m {
+				walk(prefix+"."+k, child, depth+1)
+			}
+			return
+		}
+		value, _ := json.Marshal(v)
+		fields[prefix[1:]] = string(value)
+	}
+	walk("", doc, 0)
+	return fields
+}
+
+// write prints the trace, ending with the final pair when the entry was
+// converted.
+func (t *entryTracer) write(w io.Writer, pairs []Pair) {
+	if t == nil {
+		return
+	}
+	if t.pair >= 0 && t.pair < len(pairs) {
+		t.stage(t.index, "after conversion (--group-by-response, --emit-weights, --weighted-responses, --openapi paths, --method-defaults)", pairs[t.pair])
+	}
+	fmt.Fprintf(w, "Trace of entry %d:\n", t.index)
+	for _, s := range t.steps {
+		fmt.Fprintf(w, "  %s\n", s)
+	}
+	if t.pair < 0 || t.pair >= len(pairs) {
+		fmt.Fprintln(w, "  no pair")
+		return
+	}
+	data, _ := json.MarshalIndent(pairs[t.pair], "  ", "  ")
+	fmt.Fprintf(w, "  final pair %d:\n  %s\n", t.pair, data)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// tracingHeaderModes are the accepted values of --tracing-headers: drop
+// the matchers, drop them and echo the request's values into responses
+// that carried them, or keep them as recorded.
+var tracingHeaderModes = []string{"strip", "echo", "keep"}
+
+// tracingHeaderNames are the distributed tracing and correlation headers of
+// W3C Trace Context, B3, Jaeger, Datadog, AWS X-Ray and Google Cloud.
+// Their values are new for every request, so matching them exactly only
+// matches the recording.
+var tracingHeaderNames = headerNameSet("Traceparent,Tracestate,Traceresponse,Baggage,B3,Uber-Trace-Id,X-Amzn-Trace-Id,X-Cloud-Trace-Context,Sentry-Trace,X-Request-Id,X-Correlation-Id")
+
+var tracingHeaderPrefixes = []string{"X-B3-", "X-Datadog-", "Uberctx-", "Ot-Baggage-"}
+
+func isTracingHeader(name string) bool {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	if tracingHeaderNames[name] {
+		return true
+	}
+	for _, prefix := range tracingHeaderPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripTracingHeaders drops the tracing header matchers of p and returns
+// their names.
+func stripTracingHeaders(p *Pair) []string {
+	var stripped []string
+	for name := range p.Request.Headers {
+		if isTracingHeader(name) {
+			delete(p.Request.Headers, name)
+			stripped = append(stripped, textproto.CanonicalMIMEHeaderKey(name))
+		}
+	}
+	return stripped
+}
+
+// echoTracingHeaders templates the tracing headers the recorded response
+// returned from its request, so that each replay returns the caller's own
+// trace instead of the recorded one. Templating is turned on for the pair
+// with braces already in the recording escaped, as --template-config does.
+// It returns the headers templated.
+func echoTracingHeaders(p *Pair, req HarRequest, res HarResponse) []string {
+	if p.Response.EncodedBody {
+		return nil
+	}
+	sent := map[string]bool{}
+	for _, h := range req.Headers {
+		if isTracingHeader(h.Name) {
+			sent[textproto.CanonicalMIMEHeaderKey(h.Name)] = true
+		}
+	}
+	var echoed []string
+	for _, h := range res.Headers {
+		name := textproto.CanonicalMIMEHeaderKey(h.Name)
+		if !sent[name] || containsString(echoed, name) {
+			continue
+		}
+		echoed = append(echoed, name)
+	}
+	if len(echoed) == 0 {
+		return nil
+	}
+	if !p.Response.Templated {
+		p.Response.Templated = true
+		p.Response.Body = escapeTemplateSyntax(p.Response.Body)
+		for name, values := range p.Response.Headers {
+			for i, v := range values {
+				p.Response.Headers[name][i] = escapeTemplateSyntax(v)
+			}
+		}
+	}
+	if p.Response.Headers == nil {
+		p.Response.Headers = Header{}
+	}
+	for _, name := range echoed {
+		for existing := range p.Response.Headers {
+			if strings.EqualFold(existing, name) {
+				delete(p.Response.Headers, existing)
+			}
+		}
+		// Hoverfly keys request headers by their canonical names.
+		p.Response.Headers[name] = []string{fmt.Sprintf("{{ Request.Header.%s }}", name)}
+	}
+	return echoed
+}
+
+// writeTracingReport logs the tracing headers dropped from matchers and
+// echoed into responses, with the number of pairs each was seen in.
+func writeTracingReport(stripped, echoed map[string]int) {
+	counts := func(m map[string]int) string {
+		names := make([]string, 0, len(m))
+		for name, n := range m {
+			names = append(names, fmt.Sprintf("%s (%d)", name, n))
+		}
+		sort.Strings(names)
+		return strings.Join(names, ", ")
+	}
+	if len(stripped) > 0 {
+		log.Printf("Dropped tracing header matchers, whose values change on every request; --tracing-headers keep retains them: %s", counts(stripped))
+	}
+	if len(echoed) > 0 {
+		log.Printf("Templated responses to echo the caller's tracing headers: %s", counts(echoed))
+	}
+}
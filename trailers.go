@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// Hoverfly can't send HTTP trailers. Recorders that capture them put them
+// in a non-standard _trailers array on the response; otherwise only the
+// Trailer header announcing them survives.
+
+type trailerPair struct {
+	index              int
+	method, host, path string
+	recorded, missing  []string
+}
+
+// responseTrailers returns the trailers recorded for res and the names
+// announced in its Trailer header that weren't recorded.
+func responseTrailers(res HarResponse) ([]HarHeader, []string) {
+	seen := map[string]bool{}
+	for _, t := range res.Trailers {
+		seen[textproto.CanonicalMIMEHeaderKey(t.Name)] = true
+	}
+	var missing []string
+	for _, h := range res.Headers {
+		if !strings.EqualFold(h.Name, "Trailer") {
+			continue
+		}
+		for _, name := range splitList(h.Value) {
+			name = textproto.CanonicalMIMEHeaderKey(name)
+			if !seen[name] {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+		}
+	}
+	return res.Trailers, missing
+}
+
+// foldTrailers approximates trailers as response headers, which is where
+// gRPC-web and most HTTP clients also accept them (a "trailers-only"
+// response). Headers already present win over trailers of the same name.
+func foldTrailers(p *Pair, trailers []HarHeader) {
+	if p.Response.Headers == nil {
+		p.Response.Headers = Header{}
+	}
+	present := map[string]bool{}
+	for name := range p.Response.Headers {
+		present[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	for _, t := range trailers {
+		name := textproto.CanonicalMIMEHeaderKey(t.Name)
+		if present[name] {
+			continue
+		}
+		p.Response.Headers[t.Name] = append(p.Response.Headers[t.Name], t.Value)
+	}
+}
+
+// writeTrailerReport lists the pairs whose responses carried trailers.
+func writeTrailerReport(w io.Writer, pairs []trailerPair, folded bool) {
+	if len(pairs) == 0 {
+		return
+	}
+	action := "dropped; use --trailers=headers to keep them as headers"
+	if folded {
+		action = "kept as response headers"
+	}
+	fmt.Fprintf(w, "Trailers on %d pair(s) (%s):\n", len(pairs), action)
+	fmt.Fprintf(w, "%-6s %-30s %-10s %-50s %s\n", "PAIR", "HOST", "METHOD", "PATH", "TRAILERS")
+	for _, t := range pairs {
+		names := append([]string{}, t.recorded...)
+		for _, name := range t.missing {
+			names = append(names, name+" (not recorded)")
+		}
+		fmt.Fprintf(w, "%-6d %-30s %-10s %-50s %s\n", t.index, t.host, t.method, truncate(t.path, 50), strings.Join(names, ","))
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// repairURL parses a request URL from a HAR, fixing the mistakes hand-made
+// and converted HARs commonly contain: surrounding or embedded whitespace,
+// backslashes, a missing scheme and an empty path. It returns the repairs
+// made, and an error for URLs that can't identify a destination.
+func repairURL(raw string) (*url.URL, []string, error) {
+	var repairs []string
+	s := strings.TrimSpace(raw)
+	if s != raw {
+		repairs = append(repairs, "trimmed whitespace")
+	}
+	if s == "" {
+		return nil, nil, fmt.Errorf("empty URL")
+	}
+	if strings.ContainsAny(s, " \t") {
+		s = strings.NewReplacer(" ", "%20", "\t", "%09").Replace(s)
+		repairs = append(repairs, "escaped spaces")
+	}
+	if strings.Contains(s, `\`) {
+		s = strings.ReplaceAll(s, `\`, "/")
+		repairs = append(repairs, "replaced backslashes")
+	}
+	if strings.HasPrefix(s, "//") {
+		s = "http:" + s
+		repairs = append(repairs, "added http scheme")
+	} else if isRelativeURL(s) {
+		return nil, repairs, fmt.Errorf("relative URL has no host; set --base-url or record the page URL")
+	} else if !strings.Contains(s, "://") && !strings.HasPrefix(s, "/") && !hasNonHTTPScheme(s) {
+		s = "http://" + s
+		repairs = append(repairs, "added http scheme")
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, repairs, err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, repairs, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return nil, repairs, fmt.Errorf("no host")
+	}
+	if u.Path == "" {
+		u.Path = "/"
+		repairs = append(repairs, "added / path")
+	}
+	return u, repairs, nil
+}
+
+// resolveURL resolves a relative request URL, which some recorders store,
+// against base. It reports whether raw was relative and resolved.
+func resolveURL(raw string, base *url.URL) (string, bool) {
+	s := strings.TrimSpace(raw)
+	if base == nil || !isRelativeURL(s) {
+		return raw, false
+	}
+	ref, err := url.Parse(s)
+	if err != nil {
+		return raw, false
+	}
+	return base.ResolveReference(ref).String(), true
+}
+
+// isRelativeURL reports whether s is a path, query or scheme-relative
+// reference rather than an absolute URL or a bare host.
+func isRelativeURL(s string) bool {
+	for _, prefix := range []string{"/", "./", "../", "?"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageBaseURLs maps page IDs to the URL each page loaded. HAR 1.2 has no
+// page URL field, but browsers record it as the page title.
+func pageBaseURLs(pages []Page) map[string]*url.URL {
+	bases := map[string]*url.URL{}
+	for _, page := range pages {
+		if u, err := url.Parse(page.Title); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+			bases[page.ID] = u
+		}
+	}
+	return bases
+}
+
+// parseBaseURL parses the --base-url flag, returning nil when it is unset.
+func parseBaseURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute http(s) URL", raw)
+	}
+	return u, nil
+}
+
+// hasNonHTTPScheme reports whether s starts with a scheme such as data: or
+// blob: that has no authority. host:port is not mistaken for one.
+func hasNonHTTPScheme(s string) bool {
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return false
+	}
+	if rest := s[i+1:]; rest != "" && rest[0] >= '0' && rest[0] <= '9' {
+		return false
+	}
+	for _, r := range s[:i] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseURL parses and repairs a URL for reporting, returning an empty URL
+// when it can't be. Conversion uses repairURL so failures are reported.
+func parseURL(raw string) *url.URL {
+	u, _, err := repairURL(raw)
+	if err != nil {
+		return &url.URL{}
+	}
+	return u
+}
+
+type urlProblem struct {
+	entry   int
+	url     string
+	problem string
+}
+
+// writeURLReport logs repaired URLs and entries skipped for invalid ones.
+func writeURLReport(repaired, invalid []urlProblem) {
+	if len(repaired) > 0 {
+		log.Printf("Repaired %d request URL(s):\n  %s", len(repaired), strings.Join(describeURLProblems(repaired), "\n  "))
+	}
+	if len(invalid) > 0 {
+		log.Printf("Skipped %d entr(ies) with invalid request URLs:\n  %s", len(invalid), strings.Join(describeURLProblems(invalid), "\n  "))
+	}
+}
+
+func describeURLProblems(problems []urlProblem) []string {
+	var lines []string
+	for _, p := range problems {
+		lines = append(lines, fmt.Sprintf("entry %d %q: %s", p.entry, p.url, p.problem))
+	}
+	return lines
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// endpointVariance collects every value observed for each field of one
+// endpoint across several captures.
+type endpointVariance struct {
+	runs   map[int]bool
+	values map[string]map[string]bool
+}
+
+func runVariance(args []string) {
+	flags := flag.NewFlagSet("variance", flag.ExitOnError)
+	showStable := flags.Bool("show-stable", false, "Also list endpoints whose fields never varied")
+	flags.Parse(args)
+
+	inputs := flags.Args()
+	if len(inputs) < 2 {
+		log.Fatal("variance needs at least two HAR files of the same journey")
+	}
+
+	endpoints := map[string]*endpointVariance{}
+	for run, path := range inputs {
+		har, err := readHAR(path)
+		if err != nil {
+			log.Fatalf("Failed to parse HAR: %v", err)
+		}
+		for _, entry := range har.Log.Entries {
+			u := parseURL(entry.Request.URL)
+			key := entry.Request.Method + " " + u.Host + u.Path
+			ev, ok := endpoints[key]
+			if !ok {
+				ev = &endpointVariance{runs: map[int]bool{}, values: map[string]map[string]bool{}}
+				endpoints[key] = ev
+			}
+			ev.runs[run] = true
+
+			fields := map[string]string{"status": fmt.Sprint(entry.Response.Status)}
+			for k, vs := range u.Query() {
+				fields["query."+k] = strings.Join(vs, ",")
+			}
+			if entry.Request.PostData != nil {
+				flattenBody("request.body", entry.Request.PostData.Text, fields)
+			}
+			flattenBody("response.body", entry.Response.Content.Text, fields)
+			for field, value := range fields {
+				if ev.values[field] == nil {
+					ev.values[field] = map[string]bool{}
+				}
+				ev.values[field][value] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(endpoints))
+	for k := range endpoints {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("%-60s %-6s %s\n", "ENDPOINT", "RUNS", "VARYING FIELDS (distinct values)")
+	for _, key := range keys {
+		ev := endpoints[key]
+		var varying []string
+		for field, values := range ev.values {
+			if len(values) > 1 {
+				varying = append(varying, fmt.Sprintf("%s(%d)", field, len(values)))
+			}
+		}
+		sort.Strings(varying)
+		if len(varying) == 0 && len(ev.runs) == len(inputs) && !*showStable {
+			continue
+		}
+		summary := strings.Join(varying, ", ")
+		if summary == "" {
+			summary = "-"
+		}
+		fmt.Printf("%-60s %d/%-4d %s\n", truncate(key, 60), len(ev.runs), len(inputs), summary)
+	}
+}
+
+// flattenBody records each leaf of a JSON body under a dotted path, with
+// array elements folded together under [*] so differing lengths don't
+// show up as noise. Non-JSON bodies are recorded whole.
+func flattenBody(prefix, body string, out map[string]string) {
+	if body == "" {
+		return
+	}
+	var v interface{}
+	if json.Unmarshal([]byte(body), &v) != nil {
+		out[prefix] = body
+		return
+	}
+	flattenJSON(prefix, v, out)
+}
+
+func flattenJSON(prefix string, v interface{}, out map[string]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			flattenJSON(prefix+"."+k, child, out)
+		}
+	case []interface{}:
+		for _, child := range t {
+			item := map[string]string{}
+			flattenJSON(prefix+"[*]", child, item)
+			for k, val := range item {
+				if prev, ok := out[k]; ok {
+					val = prev + "|" + val
+				}
+				out[k] = val
+			}
+		}
+	default:
+		data, _ := json.Marshal(t)
+		out[prefix] = string(data)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// vendorProfiles generalise requests signed or keyed per call by specific
+// vendors so that a replayed request still matches its recorded pair. Each
+// profile rewrites the pair's matchers in place and reports whether it
+// changed anything.
+var vendorProfiles = map[string]func(*Pair) bool{
+	"aws":    awsProfile,
+	"stripe": stripeProfile,
+	"auth0":  auth0Profile,
+}
+
+func vendorProfileNames() string {
+	names := make([]string, 0, len(vendorProfiles))
+	for name := range vendorProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// awsProfile relaxes SigV4: the signature, timestamp and session token
+// change on every call, while the signed service and region do not.
+func awsProfile(p *Pair) bool {
+	changed := false
+	if k, m, ok := headerMatcher(p.Request.Headers, "Authorization"); ok && strings.HasPrefix(m.Value, "AWS4-HMAC-SHA256") {
+		p.Request.Headers[k] = []FieldMatcher{{Matcher: "glob", Value: "AWS4-HMAC-SHA256 *"}}
+		changed = true
+	}
+	for _, name := range []string{"X-Amz-Date", "X-Amz-Security-Token"} {
+		changed = globHeader(p.Request.Headers, name) || changed
+	}
+	for _, name := range []string{"X-Amz-Signature", "X-Amz-Date", "X-Amz-Credential", "X-Amz-Security-Token"} {
+		if _, ok := p.Request.Query[name]; ok {
+			p.Request.Query[name] = []FieldMatcher{{Matcher: "glob", Value: "*"}}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// stripeProfile relaxes idempotency keys, which are random per request, and
+// secret keys so captures from different accounts/modes still match.
+func stripeProfile(p *Pair) bool {
+	changed := globHeader(p.Request.Headers, "Idempotency-Key")
+	if k, m, ok := headerMatcher(p.Request.Headers, "Authorization"); ok {
+		for _, prefix := range []string{"Bearer sk_", "Bearer rk_"} {
+			if strings.HasPrefix(m.Value, prefix) {
+				p.Request.Headers[k] = []FieldMatcher{{Matcher: "glob", Value: prefix + "*"}}
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// auth0Profile relaxes JWT bearer tokens and the client telemetry header, and
+// turns token endpoint bodies into partial JSON matchers that ignore the
+// one-time credentials in them.
+func auth0Profile(p *Pair) bool {
+	changed := globHeader(p.Request.Headers, "Auth0-Client")
+	if k, m, ok := headerMatcher(p.Request.Headers, "Authorization"); ok && isJWT(strings.TrimPrefix(m.Value, "Bearer ")) {
+		p.Request.Headers[k] = []FieldMatcher{{Matcher: "glob", Value: "Bearer *"}}
+		changed = true
+	}
+	if strings.HasSuffix(exactValue(p.Request.Path), "/oauth/token") {
+		var body map[string]interface{}
+		if json.Unmarshal([]byte(exactValue(p.Request.Body)), &body) == nil {
+			for _, field := range []string{"client_secret", "code", "code_verifier", "refresh_token", "password", "client_assertion"} {
+				delete(body, field)
+			}
+			if partial, err := json.Marshal(body); err == nil {
+				p.Request.Body = []FieldMatcher{{Matcher: "jsonpartial", Value: string(partial)}}
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// headerMatcher finds a header matcher by case-insensitive name, returning
+// the key it is stored under.
+func headerMatcher(headers map[string][]FieldMatcher, name string) (string, FieldMatcher, bool) {
+	for k, matchers := range headers {
+		if strings.EqualFold(k, name) && len(matchers) > 0 {
+			return k, matchers[0], true
+		}
+	}
+	return "", FieldMatcher{}, false
+}
+
+// globHeader replaces the named header's matcher with a wildcard so only
+// its presence is required.
+func globHeader(headers map[string][]FieldMatcher, name string) bool {
+	k, _, ok := headerMatcher(headers, name)
+	if !ok {
+		return false
+	}
+	headers[k] = []FieldMatcher{{Matcher: "glob", Value: "*"}}
+	return true
+}
+
+// isJWT reports whether token has the three dot-separated segments of a
+// compact JWT.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !strings.ContainsAny(token, " ")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// watcher reconverts a HAR as it is re-recorded. Entries are keyed by a
+// hash of their raw JSON, so only entries that are new or changed since the
+// previous pass go through conversion again. A nil pair records an entry
+// that was filtered out. Page URLs and comments feed into conversion too,
+// so every entry is converted afresh when the HAR's pages change.
+type watcher struct {
+	conv    *entryConverter
+	pages   string
+	entries map[[sha256.Size]byte]*Pair
+}
+
+// update converts the entries of data, reusing results for unchanged
+// entries, and returns the simulation pairs plus how many entries were
+// converted afresh and reused.
+func (w *watcher) update(data []byte) ([]Pair, int, int, error) {
+	fields, raws, err := rawHAREntries(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var compact bytes.Buffer
+	if raw, ok := fields["pages"]; ok {
+		if err := json.Compact(&compact, raw); err != nil {
+			return nil, 0, 0, fmt.Errorf("pages: %v", err)
+		}
+	}
+	if pages := compact.String(); w.conv.pageBases == nil || pages != w.pages {
+		var list []Page
+		if pages != "" {
+			if err := json.Unmarshal(compact.Bytes(), &list); err != nil {
+				return nil, 0, 0, fmt.Errorf("pages: %v", err)
+			}
+		}
+		w.conv.setPages(list)
+		w.pages, w.entries = pages, nil
+	}
+	next := make(map[[sha256.Size]byte]*Pair, len(raws))
+	var pairs []Pair
+	converted := 0
+	for i, raw := range raws {
+		// Hash the compacted form so re-indenting the file doesn't count
+		// as a change.
+		compact.Reset()
+		if err := json.Compact(&compact, raw); err != nil {
+			return nil, 0, 0, fmt.Errorf("entry %d: %v", i, err)
+		}
+		key := sha256.Sum256(compact.Bytes())
+		result, ok := w.entries[key]
+		if !ok {
+			if result, ok = next[key]; !ok {
+				// A bad entry is skipped, and as it is remembered like a
+				// filtered one it is only reported when it first appears.
+				var entry Entry
+				if err := json.Unmarshal(raw, &entry); err != nil {
+					log.Printf("Skipping entry %d that failed to parse: %v", i, err)
+				} else {
+					// Dates are normalised as decodeHARLazily does for
+					// convert, so --provenance finds the same day.
+					date, ok := normaliseStartedDateTime(entry.StartedDateTime)
+					if !ok {
+						date = ""
+					}
+					entry.StartedDateTime = date
+					shimEntry(&entry)
+					if prepared, ok := w.conv.prepare(i, entry); ok {
+						pair := w.conv.build(i, prepared, len(pairs))
+						result = &pair
+					}
+				}
+				converted++
+			}
+		}
+		next[key] = result
+		if result != nil {
+			pairs = append(pairs, *result)
+		}
+	}
+	w.entries = next
+	return pairs, converted, len(raws) - converted, nil
+}
+
+func runWatch(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to the HAR file being recorded")
+	outputFile := flags.String("output", "", "Path to the simulation file kept up to date")
+	format := flags.String("format", "", "Output format: "+outputFormatNames()+" (defaults to yaml for .yaml/.yml outputs, json otherwise)")
+	interval := flags.Duration("interval", 500*time.Millisecond, "How often to check the HAR for changes")
+	entryOpts := addEntryFlags(flags)
+	flags.Parse(args)
+
+	if *inputFile == "" || *outputFile == "" {
+		log.Fatal("watch needs --input and --output")
+	}
+	checkOptions(givenFlags(flags), entryOpts.rules())
+	if *format == "" {
+		*format = "json"
+		if isYAMLPath(*outputFile) {
+			*format = "yaml"
+		}
+	}
+	render, ok := outputFormats[*format]
+	if !ok {
+		log.Fatalf("Unknown --format %q: expected one of %s", *format, outputFormatNames())
+	}
+	entryOpts.parse()
+
+	// Only options that depend on a single entry are offered, so a cached
+	// result stays valid however the rest of the capture changes.
+	w := &watcher{conv: newEntryConverter(entryOpts, *inputFile)}
+
+	var lastMod time.Time
+	var lastSize int64
+	for {
+		info, err := os.Stat(*inputFile)
+		if err != nil {
+			log.Printf("Failed to stat %s: %v", *inputFile, err)
+		} else if !info.ModTime().Equal(lastMod) || info.Size() != lastSize {
+			lastMod, lastSize = info.ModTime(), info.Size()
+			start := time.Now()
+			if err := watchPass(w, *inputFile, *outputFile, render); err != nil {
+				// Recorders often write the HAR in several steps; a
+				// half-written file is retried on the next change.
+				log.Printf("Skipping update: %v", err)
+			} else {
+				log.Printf("Updated %s in %s", *outputFile, time.Since(start).Round(time.Millisecond))
+			}
+		}
+		time.Sleep(*interval)
+	}
+}
+
+func watchPass(w *watcher, inputFile, outputFile string, render func(Simulation, outputOptions) ([]byte, error)) error {
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return err
+	}
+	pairs, converted, reused, err := w.update(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse HAR: %v", err)
+	}
+	log.Printf("Converted %d new or changed entries, reused %d", converted, reused)
+
+	sim := Simulation{}
+	sim.Meta.SchemaVersion = "v5.3"
+	sim.Data.GlobalActions = GlobalActions{Delays: []GlobalDelay{}}
+	sim.Data.Pairs = pairs
+	output, err := render(sim, outputOptions{goPackage: "fixtures"})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputFile, output, 0644)
+}
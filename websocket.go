@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// WebSocketMessage is a frame Chrome records in _webSocketMessages on the
+// entry that upgraded the connection.
+type WebSocketMessage struct {
+	Type   string  `json:"type"`
+	Time   float64 `json:"time"`
+	Opcode int     `json:"opcode"`
+	Data   string  `json:"data"`
+}
+
+// isWebSocket reports whether the entry opened a WebSocket: it carries
+// recorded frames, or got a 101 upgrading to websocket.
+func isWebSocket(entry Entry) bool {
+	if len(entry.WebSocketMessages) > 0 {
+		return true
+	}
+	return entry.Response.Status == 101 && strings.EqualFold(headerValue(entry.Response.Headers, "Upgrade"), "websocket")
+}
+
+// webSocketCapture is one connection in the --websocket-frames file, with
+// the entry it was recorded on so it can be traced back to the HAR.
+type webSocketCapture struct {
+	Entry           int                `json:"entry"`
+	URL             string             `json:"url"`
+	Pageref         string             `json:"pageref,omitempty"`
+	StartedDateTime string             `json:"startedDateTime,omitempty"`
+	Messages        []WebSocketMessage `json:"messages"`
+}
+
+// webSockets collects the WebSocket entries conversion skipped. Hoverfly
+// only simulates request/response exchanges, so a pair for the upgrade
+// would answer 101 and then never speak the protocol.
+type webSockets struct {
+	captures []webSocketCapture
+	messages int
+}
+
+func (w *webSockets) add(i int, entry Entry) {
+	messages := entry.WebSocketMessages
+	if messages == nil {
+		messages = []WebSocketMessage{}
+	}
+	w.captures = append(w.captures, webSocketCapture{
+		Entry:           i,
+		URL:             entry.Request.URL,
+		Pageref:         entry.Pageref,
+		StartedDateTime: entry.StartedDateTime,
+		Messages:        messages,
+	})
+	w.messages += len(messages)
+}
+
+// write saves the frames of the skipped connections when given a path,
+// writing an empty list when there were none, and logs the connections.
+func (w *webSockets) write(path string) error {
+	if path != "" {
+		captures := w.captures
+		if captures == nil {
+			captures = []webSocketCapture{}
+		}
+		data, err := json.MarshalIndent(map[string]interface{}{"websockets": captures}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	if len(w.captures) == 0 {
+		return nil
+	}
+	urls := make([]string, len(w.captures))
+	for k, c := range w.captures {
+		urls[k] = fmt.Sprintf("entry %d %s (%d message(s))", c.Entry, c.URL, len(c.Messages))
+	}
+	saved := "; use --websocket-frames to keep their frames"
+	if path != "" {
+		saved = fmt.Sprintf("; %d frame(s) written to %s", w.messages, path)
+	}
+	log.Printf("Skipped %d WebSocket connection(s), which Hoverfly can't simulate as request/response pairs%s:\n  %s",
+		len(w.captures), saved, strings.Join(urls, "\n  "))
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Hoverfly has no random response selection, so --weighted-responses
+// approximates the observed mix of an endpoint's responses with a state
+// machine: the endpoint gets a cycle of slots, each a pair requiring its
+// slot number and advancing to the next, with every distinct response
+// given slots in proportion to how often it was recorded. An endpoint that
+// answered 200 nineteen times and 503 once serves one 503 in every 20
+// requests. Slots are interleaved so rare responses are spread over the
+// cycle rather than bunched at its end.
+
+// weightedEndpoint is a request matched by several pairs that returned
+// different responses.
+type weightedEndpoint struct {
+	pairs     []int
+	responses []weightedResponse
+	total     int
+}
+
+// weightedResponse is one distinct response of an endpoint: the first pair
+// that returned it and how many entries did.
+type weightedResponse struct {
+	pair  int
+	count int
+}
+
+// weightResponses rewrites the endpoints of pairs that returned more than
+// one distinct response into cycles of at most cycle slots. observed maps
+// pair indexes to the entries each stands for, as --group-by-response
+// records them; other pairs stand for one. It returns the new pairs, the
+// index of the pair each was made from, where each old pair went, and a
+// description of every endpoint rewritten.
+func weightResponses(pairs []Pair, observed map[int]int, cycle int) (out []Pair, sources, moved []int, rewritten []string) {
+	endpoints := map[string]*weightedEndpoint{}
+	responseIndex := map[string]int{}
+	responseOf := make([]int, len(pairs))
+	for i, p := range pairs {
+		key := requestKey(p)
+		e, ok := endpoints[key]
+		if !ok {
+			e = &weightedEndpoint{}
+			endpoints[key] = e
+		}
+		count := 1
+		if n, ok := observed[i]; ok {
+			count = n
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%t\x00%s", p.Response.EncodedBody, p.Response.Body)))
+		rkey := fmt.Sprintf("%s %d %x", key, p.Response.Status, sum)
+		k, ok := responseIndex[rkey]
+		if !ok {
+			k = len(e.responses)
+			responseIndex[rkey] = k
+			e.responses = append(e.responses, weightedResponse{pair: i})
+		}
+		e.responses[k].count += count
+		responseOf[i] = k
+		e.pairs = append(e.pairs, i)
+		e.total += count
+	}
+
+	moved = make([]int, len(pairs))
+	emitted := map[*weightedEndpoint]bool{}
+	for i, p := range pairs {
+		e := endpoints[requestKey(p)]
+		if len(e.responses) < 2 {
+			moved[i] = len(out)
+			out = append(out, p)
+			sources = append(sources, i)
+			continue
+		}
+		if emitted[e] {
+			continue
+		}
+		emitted[e] = true
+		stateKey := "sequence:weighted-" + strconv.Itoa(len(rewritten)+1)
+		slots := weightedSlots(e, cycle)
+		firstSlot := map[int]int{}
+		for s, k := range slots {
+			r := e.responses[k]
+			if _, ok := firstSlot[k]; !ok {
+				firstSlot[k] = len(out)
+			}
+			slot := copyPair(pairs[r.pair])
+			// Hoverfly initialises "sequence:" keys to "1" on load.
+			slot.Request.RequiresState = copyState(slot.Request.RequiresState)
+			if slot.Request.RequiresState == nil {
+				slot.Request.RequiresState = map[string]string{}
+			}
+			slot.Request.RequiresState[stateKey] = strconv.Itoa(s + 1)
+			slot.Response.TransitionsState = copyState(slot.Response.TransitionsState)
+			if slot.Response.TransitionsState == nil {
+				slot.Response.TransitionsState = map[string]string{}
+			}
+			slot.Response.TransitionsState[stateKey] = strconv.Itoa((s+1)%len(slots) + 1)
+			out = append(out, slot)
+			sources = append(sources, r.pair)
+		}
+		for _, old := range e.pairs {
+			moved[old] = firstSlot[responseOf[old]]
+		}
+		shares := make([]string, len(e.responses))
+		for k, r := range e.responses {
+			shares[k] = fmt.Sprintf("%d %.0f%%", pairs[r.pair].Response.Status, 100*float64(r.count)/float64(e.total))
+		}
+		rewritten = append(rewritten, fmt.Sprintf("%s: %s over %d request(s)", describeRequest(p), strings.Join(shares, ", "), len(slots)))
+	}
+	return out, sources, moved, rewritten
+}
+
+// weightedSlots lays out the cycle of e as the index of the response each
+// slot serves. The cycle has one slot per recorded entry up to cycle, and
+// at least one per response; slots are apportioned by largest remainder
+// and interleaved by smooth weighted round-robin.
+func weightedSlots(e *weightedEndpoint, cycle int) []int {
+	n := e.total
+	if n > cycle {
+		n = cycle
+	}
+	if n < len(e.responses) {
+		n = len(e.responses)
+	}
+	share := func(k int) float64 { return float64(e.responses[k].count) * float64(n) / float64(e.total) }
+	counts := make([]int, len(e.responses))
+	sum := 0
+	for k := range e.responses {
+		counts[k] = int(share(k))
+		if counts[k] < 1 {
+			counts[k] = 1
+		}
+		sum += counts[k]
+	}
+	for ; sum < n; sum++ {
+		best := 0
+		for k := range counts {
+			if share(k)-float64(counts[k]) > share(best)-float64(counts[best]) {
+				best = k
+			}
+		}
+		counts[best]++
+	}
+	for ; sum > n; sum-- {
+		best := -1
+		for k := range counts {
+			if counts[k] > 1 && (best < 0 || share(k)-float64(counts[k]) < share(best)-float64(counts[best])) {
+				best = k
+			}
+		}
+		counts[best]--
+	}
+
+	slots := make([]int, 0, n)
+	current := make([]int, len(counts))
+	for len(slots) < n {
+		best := 0
+		for k := range counts {
+			current[k] += counts[k]
+			if current[k] > current[best] {
+				best = k
+			}
+		}
+		current[best] -= n
+		slots = append(slots, best)
+	}
+	return slots
+}
+
+// writeWeightedReport lists the endpoints --weighted-responses rewrote.
+func writeWeightedReport(rewritten []string) {
+	if len(rewritten) == 0 {
+		return
+	}
+	log.Printf("Cycled %d endpoint(s) through their recorded responses in proportion:\n  %s", len(rewritten), strings.Join(rewritten, "\n  "))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWeightedSlots(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int
+		cycle  int
+		want   []int
+	}{
+		{"one slot per entry", []int{19, 1}, 20, []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"fewer entries than the cycle", []int{2, 2}, 10, []int{0, 1, 0, 1}},
+		{"apportioned to the cycle", []int{50, 30, 20}, 10, []int{0, 1, 2, 0, 0, 1, 0, 2, 1, 0}},
+		{"interleaved", []int{3, 2, 1}, 6, []int{0, 1, 0, 2, 1, 0}},
+		{"a slot per response beyond the cycle", []int{98, 1, 1}, 2, []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &weightedEndpoint{}
+			for k, count := range tt.counts {
+				e.responses = append(e.responses, weightedResponse{pair: k, count: count})
+				e.total += count
+			}
+			if got := weightedSlots(e, tt.cycle); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// addWeightLabels implements --emit-weights: every pair is labelled
+// weight:<share> with the share of the converted entries it stands for,
+// so load tools can replay the recorded traffic mix. A pair stands for
+// one entry, or under --group-by-response for every entry it grouped;
+// observed maps pair indexes to those counts.
+func addWeightLabels(pairs []Pair, observed map[int]int) {
+	counts := make([]int, len(pairs))
+	total := 0
+	for i := range pairs {
+		counts[i] = 1
+		if n, ok := observed[i]; ok {
+			counts[i] = n
+		}
+		total += counts[i]
+	}
+	for i := range pairs {
+		weight := strconv.FormatFloat(float64(counts[i])/float64(total), 'g', 4, 64)
+		pairs[i].Labels = append(pairs[i].Labels, fmt.Sprintf("weight:%s", weight))
+	}
+}